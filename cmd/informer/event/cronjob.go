@@ -14,43 +14,38 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+
+	"nautilus/pkg/util/metrics"
 )
 
 type CronJob interface {
-	HandleCronJob(obj interface{}, mode, cluster string) error
+	// HandleCronJob 处理定时任务的job事件, oldObj为更新前的job, 只有Update事件才有
+	HandleCronJob(oldObj, obj interface{}, mode, cluster string) error
 }
 
 type CronJobResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewCronJobResource(clientset *kubernetes.Clientset) *CronJobResource {
+func NewCronJobResource(clientset kubernetes.Interface) *CronJobResource {
 	return &CronJobResource{
 		clientset: clientset,
 	}
 }
 
-func (r *CronJobResource) HandleCronJob(obj interface{}, mode, cluster string) error {
+func (r *CronJobResource) HandleCronJob(oldObj, obj interface{}, mode, cluster string) error {
 	var (
-		data          = obj.(*batchv1.Job)
-		name          = data.ObjectMeta.Name       // job名称
-		successPodNum = data.Status.Succeeded      // 运行成功的pod数量
-		failPodNum    = data.Status.Failed         // 运行失败的pod数量
-		beginTime     = data.Status.StartTime      // job开始时间
-		finishTime    = data.Status.CompletionTime // job结束时间
-		jobResult     = 0                          // job运行结果 0 运行中 1 运行成功 2 运行失败
+		data       = obj.(*batchv1.Job)
+		name       = data.ObjectMeta.Name       // job名称
+		beginTime  = data.Status.StartTime      // job开始时间
+		finishTime = data.Status.CompletionTime // job结束时间
+		jobResult  = r.result(data)             // job运行结果 0 运行中 1 运行成功 2 运行失败
 	)
 
 	// 检查是否是业务的cronjob
 	if !r.filter(name) {
 		return nil
 	}
-
-	if successPodNum >= 1 {
-		jobResult = 1
-	} else if failPodNum >= 1 {
-		jobResult = 2
-	}
 	log.Infof("[cronjob] check %s job result: %d on mode: %s", name, jobResult, mode)
 
 	jobID, service, err := r.parseInfo(name)
@@ -58,12 +53,31 @@ func (r *CronJobResource) HandleCronJob(obj interface{}, mode, cluster string) e
 		return err
 	}
 
+	// 只在job由运行中变为结束时统计; 结束后的更新及重启informer时的全量同步不重复计数
+	if mode == Update && jobResult != 0 && oldObj != nil && r.result(oldObj.(*batchv1.Job)) == 0 {
+		result := metrics.ResultSuccess
+		if jobResult == 2 {
+			result = metrics.ResultFailed
+		}
+		metrics.CronjobRuns.WithLabelValues(service, result).Inc()
+	}
+
 	if err := r.callback(jobID, service, beginTime, finishTime, jobResult); err != nil {
 		return err
 	}
 	return nil
 }
 
+// result job运行结果: 0 运行中 1 运行成功 2 运行失败
+func (r *CronJobResource) result(job *batchv1.Job) int {
+	if job.Status.Succeeded >= 1 {
+		return 1
+	} else if job.Status.Failed >= 1 {
+		return 2
+	}
+	return 0
+}
+
 func (r *CronJobResource) filter(name string) bool {
 	re := regexp.MustCompile(`[\w+-]-cronjob-\d+-`)
 	if re == nil {
@@ -23,10 +23,10 @@ type Deployment interface {
 }
 
 type DeploymentResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewDeploymentResource(clientset *kubernetes.Clientset) *DeploymentResource {
+func NewDeploymentResource(clientset kubernetes.Interface) *DeploymentResource {
 	return &DeploymentResource{
 		clientset: clientset,
 	}
@@ -17,10 +17,10 @@ type Endpoint interface {
 }
 
 type EndpointResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewEndpointResource(clientset *kubernetes.Clientset) *EndpointResource {
+func NewEndpointResource(clientset kubernetes.Interface) *EndpointResource {
 	return &EndpointResource{
 		clientset: clientset,
 	}
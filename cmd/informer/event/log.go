@@ -23,10 +23,10 @@ type Log interface {
 }
 
 type LogResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewLogResouce(clientset *kubernetes.Clientset) *LogResource {
+func NewLogResouce(clientset kubernetes.Interface) *LogResource {
 	return &LogResource{
 		clientset: clientset,
 	}
@@ -14,6 +14,8 @@ import (
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+
+	"nautilus/pkg/util/metrics"
 )
 
 const (
@@ -22,6 +24,14 @@ const (
 	Delete = "delete"
 )
 
+// 资源类型
+const (
+	ResourceDeployment = "deployment"
+	ResourceEndpoint   = "endpoint"
+	ResourceCronJob    = "cronjob"
+	ResourceLog        = "log"
+)
+
 type Event interface {
 	Deployment
 	Endpoint
@@ -36,7 +46,7 @@ type handler struct {
 	Log
 }
 
-func NewEvent(clientset *kubernetes.Clientset) Event {
+func NewEvent(clientset kubernetes.Interface) Event {
 	return handler{
 		Deployment: NewDeploymentResource(clientset),
 		Endpoint:   NewEndpointResource(clientset),
@@ -46,7 +56,7 @@ func NewEvent(clientset *kubernetes.Clientset) Event {
 }
 
 // DeploymentEvent deployment事件
-func DeploymentEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
+func DeploymentEvent(e Event, cluster string, clientset kubernetes.Interface) {
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 
@@ -54,7 +64,9 @@ func DeploymentEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 	deploymentInformer := sharedInformer.Apps().V1().Deployments().Informer()
 	deploymentInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			e.HandleDeployment(obj, Create, cluster)
+			handle(ResourceDeployment, Create, func() error {
+				return e.HandleDeployment(obj, Create, cluster)
+			})
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			oldDep := oldObj.(*appsv1.Deployment)
@@ -62,7 +74,9 @@ func DeploymentEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 			if oldDep.ObjectMeta.ResourceVersion == newDep.ObjectMeta.ResourceVersion {
 				return
 			}
-			e.HandleDeployment(newObj, Update, cluster)
+			handle(ResourceDeployment, Update, func() error {
+				return e.HandleDeployment(newObj, Update, cluster)
+			})
 		},
 		DeleteFunc: func(obj interface{}) {},
 	})
@@ -70,7 +84,7 @@ func DeploymentEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 }
 
 // EndpointEvent endpoint事件
-func EndpointEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
+func EndpointEvent(e Event, cluster string, clientset kubernetes.Interface) {
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 
@@ -78,7 +92,9 @@ func EndpointEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 	endpointInformer := sharedInformer.Core().V1().Endpoints().Informer()
 	endpointInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			e.HandleEndpoint(obj, Create, cluster)
+			handle(ResourceEndpoint, Create, func() error {
+				return e.HandleEndpoint(obj, Create, cluster)
+			})
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			oldEnd := oldObj.(*corev1.Endpoints)
@@ -86,17 +102,21 @@ func EndpointEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 			if oldEnd.ObjectMeta.ResourceVersion == newEnd.ObjectMeta.ResourceVersion {
 				return
 			}
-			e.HandleEndpoint(newObj, Update, cluster)
+			handle(ResourceEndpoint, Update, func() error {
+				return e.HandleEndpoint(newObj, Update, cluster)
+			})
 		},
 		DeleteFunc: func(obj interface{}) {
-			e.HandleEndpoint(obj, Delete, cluster)
+			handle(ResourceEndpoint, Delete, func() error {
+				return e.HandleEndpoint(obj, Delete, cluster)
+			})
 		},
 	})
 	endpointInformer.Run(stopCh)
 }
 
 // LogEvent 发布日志事件
-func LogEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
+func LogEvent(e Event, cluster string, clientset kubernetes.Interface) {
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 
@@ -104,10 +124,14 @@ func LogEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 	eventInformer := sharedInformer.Core().V1().Events().Informer()
 	eventInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			e.HandleLog(obj, Create, cluster)
+			handle(ResourceLog, Create, func() error {
+				return e.HandleLog(obj, Create, cluster)
+			})
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
-			e.HandleLog(newObj, Update, cluster)
+			handle(ResourceLog, Update, func() error {
+				return e.HandleLog(newObj, Update, cluster)
+			})
 		},
 		DeleteFunc: func(obj interface{}) {},
 	})
@@ -115,7 +139,7 @@ func LogEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 }
 
 // CronjobEvent cronjob事件
-func CronjobEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
+func CronjobEvent(e Event, cluster string, clientset kubernetes.Interface) {
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 
@@ -123,7 +147,9 @@ func CronjobEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 	cronjobInformer := sharedInformer.Batch().V1().Jobs().Informer()
 	cronjobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			e.HandleCronJob(obj, Create, cluster)
+			handle(ResourceCronJob, Create, func() error {
+				return e.HandleCronJob(nil, obj, Create, cluster)
+			})
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			oldJob := oldObj.(*batchv1.Job)
@@ -131,11 +157,24 @@ func CronjobEvent(e Event, cluster string, clientset *kubernetes.Clientset) {
 			if oldJob.ObjectMeta.ResourceVersion == newJob.ObjectMeta.ResourceVersion {
 				return
 			}
-			e.HandleCronJob(newObj, Update, cluster)
+			handle(ResourceCronJob, Update, func() error {
+				return e.HandleCronJob(oldObj, newObj, Update, cluster)
+			})
 		},
 		DeleteFunc: func(obj interface{}) {
-			e.HandleCronJob(obj, Delete, cluster)
+			handle(ResourceCronJob, Delete, func() error {
+				return e.HandleCronJob(nil, obj, Delete, cluster)
+			})
 		},
 	})
 	cronjobInformer.Run(stopCh)
 }
+
+// handle 执行事件处理, 并记录处理耗时和错误
+func handle(resource, mode string, fn func() error) {
+	start := time.Now()
+	if err := fn(); err != nil {
+		metrics.EventErrors.WithLabelValues(resource, mode).Inc()
+	}
+	metrics.EventDuration.WithLabelValues(resource, mode).Observe(metrics.Since(start))
+}
@@ -7,10 +7,15 @@ package main
 
 import (
 	"flag"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
 
 	"nautilus/cmd/informer/event"
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
+	"nautilus/pkg/util/health"
+	"nautilus/pkg/util/metrics"
 )
 
 var (
@@ -28,10 +33,8 @@ func main() {
 	config.ParseConfig(*configFile)
 	config.InitLogger(config.Config().Log.Informer)
 
-	model.Connect("postgres",
-		config.Config().Postgres.Master,
-		config.Config().Postgres.Slave1,
-		config.Config().Postgres.Slave2)
+	driver, master, slaves := config.Database()
+	model.Connect(driver, master, slaves...)
 
 	clientset, err := config.GetClientset(*cluster)
 	if err != nil {
@@ -44,6 +47,22 @@ func main() {
 	go event.CronjobEvent(e, *cluster, clientset)
 	go event.LogEvent(e, *cluster, clientset)
 
+	if addr := config.Config().InformerAddress; addr != "" {
+		go serve(addr)
+	}
+
 	done := make(chan int)
 	<-done
 }
+
+// serve 提供informer的监控、健康检查接口
+func serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", health.Liveness())
+	mux.Handle("/readyz", health.Readiness())
+	mux.HandleFunc("/version", health.VersionHandler)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorf("informer listen and serve failed: %s", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -21,6 +22,9 @@ import (
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
 	"nautilus/pkg/router"
+	"nautilus/pkg/service/publish"
+	"nautilus/pkg/util/lock"
+	"nautilus/pkg/util/metrics"
 )
 
 var (
@@ -34,16 +38,33 @@ func main() {
 	config.ParseConfig(*configFile)
 	config.InitLogger(config.Config().Log.Server)
 
-	model.Connect("postgres",
-		config.Config().Postgres.Master,
-		config.Config().Postgres.Slave1,
-		config.Config().Postgres.Slave2)
+	driver, master, slaves := config.Database()
+	model.Connect(driver, master, slaves...)
+
+	// 子命令: migrate up|down [steps]|version
+	if flag.Arg(0) == "migrate" {
+		migrate(flag.Arg(1), flag.Arg(2))
+		return
+	}
+
+	if config.Config().Storage.AutoMigrate {
+		if _, err := model.Migrate("up", 0); err != nil {
+			log.Panicf("auto migrate database failed: %s", err)
+		}
+	}
+
+	lock.Init(config.Config().Lock)
+	metrics.MustRegister(metrics.NewPipelineCollector(model.CountPipelines))
 
 	r := gin.Default()
 	r.Use(cors.Default())
 	router.URLs(r)
 
 	ctx, cancel := context.WithCancel(context.Background())
+	go publish.RunArtifactCleaner(ctx, time.Hour)
+	if config.Config().Registry.Clean {
+		go publish.RunImageCleaner(ctx, 24*time.Hour)
+	}
 
 	quitSignal := make(chan os.Signal, 1)
 	signal.Notify(quitSignal, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -71,3 +92,19 @@ func main() {
 
 	time.Sleep(gracePeriod)
 }
+
+func migrate(action, steps string) {
+	n := 1
+	if steps != "" {
+		var err error
+		if n, err = strconv.Atoi(steps); err != nil {
+			log.Fatalf("invalid migrate steps: %s", steps)
+		}
+	}
+
+	version, err := model.Migrate(action, n)
+	if err != nil {
+		log.Fatalf("migrate %s failed: %s", action, err)
+	}
+	log.Infof("migrate %s success, current schema version: %d", action, version)
+}
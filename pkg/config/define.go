@@ -9,6 +9,9 @@ const (
 	ONLINE_DESC = "上线简介"
 	MODULE_NAME = "模块名"
 	BRANCH_NAME = "分支名"
+	SERVICE     = "服务"
+	RD_NAME     = "RD"
+	PM_NAME     = "PM"
 )
 
 // 数据库
@@ -16,20 +19,67 @@ const ()
 
 // 创建pipeline
 const (
-	PL_SEGMENT_IS_EMPTY      = "字段: %s 内容为空!"
-	PL_QUERY_MODULE_ERROR    = "查询模块: %s 信息失败!"
-	PL_EXEC_GIT_CHECK_ERROR  = "执行git分支检查失败: %s"
-	PL_RESULT_HANDLER_ERROR  = "结果处理失败: %s"
-	PL_GIT_CHECK_FAILED      = "git分支检查失败!"
-	PL_CREATE_PIPELINE_ERROR = "存储上线流程信息错误: %s"
+	PL_SEGMENT_IS_EMPTY        = "字段: %s 内容为空!"
+	PL_QUERY_MODULE_ERROR      = "查询模块: %s 信息失败!"
+	PL_EXEC_BRANCH_CHECK_ERROR = "执行分支检查失败: %s"
+	PL_BRANCH_CHECK_FAILED     = "模块: %s 分支: %s 不存在!"
+	PL_CREATE_PIPELINE_ERROR   = "存储上线流程信息错误: %s"
+	PL_VALIDATE_FAILED         = "上线单参数校验失败: %s"
+	PL_MODULE_LIST_EMPTY       = "变更模块列表为空!"
+	PL_MODULE_DUPLICATE        = "模块: %s 重复!"
+	PL_SERVICE_NOT_FOUND       = "服务: %s 不存在!"
+	PL_QUERY_SERVICE_ERROR     = "查询服务: %s 信息失败: %s"
+	PL_MODULE_NOT_BOUND        = "模块: %s 没有绑定到服务: %s!"
+	PL_SERVICE_BUSY            = "服务: %s 有未结束的上线单: %d(%s), 不能创建新的上线单!"
+)
+
+// 代码仓库webhook
+const (
+	HOOK_NOT_CONFIGURED    = "没有配置webhook签名密钥(hook.secret)!"
+	HOOK_SIGNATURE_INVALID = "webhook签名校验失败!"
+	HOOK_EVENT_UNSUPPORTED = "不支持的webhook事件: %s"
+	HOOK_PAYLOAD_ERROR     = "webhook内容json decode失败: %s"
+	HOOK_QUERY_ERROR       = "查询仓库: %s 绑定的服务失败: %s"
+	HOOK_CREATE_ERROR      = "服务: %s 创建上线单失败: %s"
+)
+
+// 编译包缓存
+const (
+	ART_QUERY_ERROR  = "查询编译包缓存失败: %s"
+	ART_SAVE_ERROR   = "记录模块: %s 编译包缓存失败: %s"
+	ART_DELETE_ERROR = "删除编译包缓存: %s 失败: %s"
+)
+
+// 镜像仓库
+const (
+	REG_NOT_CONFIGURED  = "没有配置镜像仓库(registry.kind)!"
+	REG_IMAGE_EMPTY     = "模块: %s 没有构建镜像!"
+	REG_IMAGE_NOT_FOUND = "镜像: %s:%s 在仓库中不存在, 请重新构建镜像!"
+	REG_QUERY_ERROR     = "查询镜像: %s 失败: %s"
+	REG_DELETE_ERROR    = "删除镜像: %s:%s 失败: %s"
+	REG_REFERENCE_ERROR = "查询镜像引用失败: %s"
+)
+
+// 变更记录
+const (
+	CL_QUERY_TAG_ERROR = "查询上次上线的tag失败: %s"
+	CL_BUILD_ERROR     = "生成模块: %s 变更记录失败: %s"
+	CL_CACHE_ERROR     = "读写模块: %s 变更记录缓存失败: %s"
 )
 
 // 打tag
 const (
-	TAG_OPERATE_FORBIDDEN  = "服务被上线单(%s)占用, 不能发布!"
 	TAG_QUERY_UPDATE_ERROR = "查询变更模块信息失败: %s"
 	TAG_BUILD_FAILED       = "打tag失败: %+v"
 	TAG_UPDATE_DB_ERROR    = "更新tag信息失败: %s"
+	TAG_MERGE_INVALID      = "分支合并检查结果: %s 不合法!"
+	TAG_MERGE_UPDATE_ERROR = "更新分支合并检查结果失败: %s"
+	TAG_BUILD_FILE_ERROR   = "读取模块: %s 构建文件失败: %s"
+	TAG_BUILD_FILE_INVALID = "模块: %s 构建配置不合法: %s"
+	TAG_BUILD_WRITE_ERROR  = "生成模块: %s 构建脚本失败: %s"
+	TAG_RESOLVE_ERROR      = "获取模块: %s 分支: %s 的提交失败: %s"
+	TAG_UPDATE_COMMIT_FAIL = "记录模块: %s 提交失败: %s"
+	TAG_MODULES_FAILED     = "模块打tag失败: %s"
 	PKG_UPDATE_DB_ERROR    = "更新编译包信息失败: %s"
 )
 
@@ -46,6 +96,7 @@ const (
 	DB_QUERY_PHASES_ERROR           = "查询pipeline对应阶段错误: %s"
 	DB_UPDATE_PIPELINE_ERROR        = "更新pipeline状态失败: %s"
 	DB_WRITE_LOCK_ERROR             = "服务占锁: %v 失败: %s"
+	DB_RELEASE_LOCK_ERROR           = "服务释放锁: %v 失败: %s"
 	DB_QUERY_MODULE_BINDING_ERROR   = "查询服务与模块绑定信息失败: %s"
 	DB_IMAGE_CREATE_OR_UPDATE_ERROR = "创建或更新镜像失败: %s"
 )
@@ -57,11 +108,14 @@ const (
 )
 
 const (
-	CM_DECODE_DATA_ERROR = "json decode数据错误: %s"
-	CM_BUILD_YAML_ERROR  = "创建configmap yaml失败: %s"
-	CM_K8S_EXEC_FAILED   = "K8S创建configmap失败: %s"
-	CM_PUBLISH_FAILED    = "K8S发布configmap失败: %s"
-	CM_UPDATE_DB_ERROR   = "更新configmap记录失败: %s"
+	CM_DECODE_DATA_ERROR   = "json decode数据错误: %s"
+	CM_BUILD_YAML_ERROR    = "创建configmap yaml失败: %s"
+	CM_K8S_EXEC_FAILED     = "K8S创建configmap失败: %s"
+	CM_PUBLISH_FAILED      = "K8S发布configmap失败: %s"
+	CM_UPDATE_DB_ERROR     = "更新configmap记录失败: %s"
+	CM_VERSION_QUERY_ERROR = "查询configmap版本: %d 失败: %s"
+	CM_K8S_RESTART_FAILED  = "K8S重启deployment: %s 失败: %s"
+	CM_PHASE_INVALID       = "配置阶段: %s 不合法!"
 )
 
 // 构建镜像
@@ -76,6 +130,17 @@ const (
 	IMG_QUERY_IMAGE_IS_BUILED    = "查询镜像信息已构建!"
 	IMG_CREATE_IMAGE_INFO_ERROR  = "写镜像信息到数据库失败: %s"
 	IMG_BUILD_FAILED             = "镜像构建失败"
+	IMG_MODULES_FAILED           = "模块构建镜像失败: %s"
+)
+
+// 单一镜像构建方式
+const (
+	REL_MODE_INVALID    = "构建方式: %s 不合法, 可选: layer, single!"
+	REL_MODE_SAVE_ERROR = "保存构建方式失败: %s"
+	REL_WRITE_ERROR     = "生成发布镜像Dockerfile失败: %s"
+	REL_BUILD_FAILED    = "构建发布镜像失败: %s"
+	REL_UPDATE_ERROR    = "记录发布镜像失败: %s"
+	REL_IMAGE_EMPTY     = "上线单: %d 没有构建发布镜像, 请重新构建镜像!"
 )
 
 const (
@@ -89,12 +154,22 @@ const (
 	PUB_INIT_CONTINAER_ERROR          = "生成initContainer失败: %s"
 )
 
+// K8S server-side apply
+const (
+	K8S_APPLY_CONFLICT = "K8S提交%s: %s/%s 字段被其他管理者持有: %s"
+)
+
 // 确认完成
 const (
 	FSH_UPDATE_ONLINE_GROUP_ERROR = "设置当前在线组、部署组失败: %s"
 	FSH_CREATE_FINISH_PHASE_ERROR = "记录完成阶段失败: %s"
 )
 
+// 上线失败、终止
+const (
+	CLS_CANNOT_EXECUTE = "上线单: %d 状态为: %s, 不能标记失败或终止!"
+)
+
 // 回滚
 const (
 	ROL_CANNOT_EXECUTE     = "不能执行回滚"
@@ -106,8 +181,76 @@ const (
 const (
 	CRON_PUBLISH_ERROR             = "发布cronjob失败: %s"
 	CRON_WRITE_DB_ERROR            = "数据库存储crontab失败: %s"
+	CRON_QUERY_DB_ERROR            = "数据库查询crontab失败: %s"
 	CRON_BUILD_YAML_ERROR          = "构建cronjob yaml失败: %s"
 	CRON_K8S_EXEC_FAILED           = "K8S创建cronjob yaml失败: %s"
 	CRON_CREATE_VOLUMES_ERROR      = "创建volumes失败: %s"
 	CRON_CREATE_VOLUME_MOUNT_ERROR = "挂载volume失败: %s"
 )
+
+// 服务锁
+const (
+	LOCK_HELD_BY_OTHER     = "服务: %s 被上线单(%d) 用户(%s) 于 %s 占用, 不能发布!"
+	LOCK_QUERY_ERROR       = "查询服务锁失败: %s"
+	LOCK_FORCE_UNLOCK_FAIL = "强制解锁失败: %s"
+)
+
+// 预览
+const (
+	PRE_RENDER_YAML_ERROR = "渲染资源: %s yaml失败: %s"
+	PRE_FETCH_LIVE_ERROR  = "获取线上资源: %s 失败: %s"
+	PRE_DIFF_ERROR        = "对比资源: %s 差异失败: %s"
+)
+
+// 自动扩缩容
+const (
+	ASC_PHASE_INVALID      = "阶段: %s 不支持自动扩缩容!"
+	ASC_REPLICAS_INVALID   = "副本数范围错误: min(%d) 必须大于0且不大于max(%d)!"
+	ASC_TARGET_EMPTY       = "至少配置一个扩缩容指标(CPU、内存或自定义指标)!"
+	ASC_METRIC_INVALID     = "自定义指标: %s 配置错误: %s"
+	ASC_DECODE_ERROR       = "自定义指标json decode失败: %s"
+	ASC_QUERY_ERROR        = "查询自动扩缩容配置失败: %s"
+	ASC_SAVE_ERROR         = "保存自动扩缩容配置失败: %s"
+	ASC_DELETE_ERROR       = "删除自动扩缩容配置失败: %s"
+	ASC_K8S_HPA_EXEC_ERROR = "K8S绑定HPA: %s 失败: %s"
+)
+
+// 调度与中断策略
+const (
+	POL_PDB_CONFLICT      = "minAvailable与maxUnavailable只能配置一个!"
+	POL_PDB_VALUE_INVALID = "PDB配置: %s 错误, 只支持整数或百分比!"
+	POL_SKEW_INVALID      = "打散最大偏差不能小于0!"
+	POL_QUERY_ERROR       = "查询调度与中断策略失败: %s"
+	POL_SAVE_ERROR        = "保存调度与中断策略失败: %s"
+	POL_K8S_PDB_EXEC_FAIL = "K8S处理PDB: %s 失败: %s"
+)
+
+// 调度配置
+const (
+	SCH_NODE_SELECTOR_ERROR = "节点标签配置错误: %s"
+	SCH_TOLERATION_ERROR    = "污点容忍配置错误: %s"
+	SCH_NODE_AFFINITY_ERROR = "节点亲和配置错误: %s"
+	SCH_CLASS_NAME_ERROR    = "%s名称: %s 不合法!"
+	SCH_QUERY_ERROR         = "查询调度配置失败: %s"
+	SCH_SAVE_ERROR          = "保存调度配置失败: %s"
+	SCH_QUERY_CRONTAB_ERROR = "查询定时任务: %d 失败: %s"
+)
+
+// 密钥
+const (
+	SEC_KEY_INVALID     = "secret加密密钥配置错误: %s"
+	SEC_NAME_INVALID    = "secret名称: %s 不合法!"
+	SEC_ENCRYPT_ERROR   = "加密secret: %s 失败: %s"
+	SEC_DECRYPT_ERROR   = "解密secret: %s 失败: %s"
+	SEC_QUERY_ERROR     = "查询secret失败: %s"
+	SEC_SAVE_ERROR      = "保存secret失败: %s"
+	SEC_DELETE_ERROR    = "删除secret失败: %s"
+	SEC_K8S_EXEC_FAILED = "K8S发布secret: %s 失败: %s"
+)
+
+// 存储卷
+const (
+	VOL_DECODE_ERROR = "存储卷配置json decode失败: %s"
+	VOL_SPEC_INVALID = "存储卷: %s 配置错误: %s"
+	VOL_SAVE_ERROR   = "保存存储卷配置失败: %s"
+)
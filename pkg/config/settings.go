@@ -27,10 +27,19 @@ const (
 )
 
 type Settings struct {
-	Address  string       `yaml:"address"`
-	Log      LogInfo      `yaml:"log"`
-	Postgres PostgresInfo `yaml:"postgres"`
-	K8S      K8SInfo      `yaml:"k8s"`
+	Address         string       `yaml:"address"`
+	InformerAddress string       `yaml:"informerAddress"`
+	Log             LogInfo      `yaml:"log"`
+	Storage         StorageInfo  `yaml:"storage"`
+	Postgres        PostgresInfo `yaml:"postgres"`
+	K8S             K8SInfo      `yaml:"k8s"`
+	Redis           RedisInfo    `yaml:"redis"`
+	RabbitMQ        RabbitMQInfo `yaml:"rabbitmq"`
+	Lock            LockInfo     `yaml:"lock"`
+	Secret          SecretInfo   `yaml:"secret"`
+	Build           BuildInfo    `yaml:"build"`
+	Registry        RegistryInfo `yaml:"registry"`
+	Hook            HookInfo     `yaml:"hook"`
 }
 
 type LogInfo struct {
@@ -38,6 +47,12 @@ type LogInfo struct {
 	Informer string `yaml:"informer"`
 }
 
+type StorageInfo struct {
+	Driver      string `yaml:"driver"`      // 存储驱动: postgres(默认)、sqlite3
+	SQLite      string `yaml:"sqlite"`      // sqlite数据源, 例如: /tmp/nautilus.db、file::memory:?cache=shared
+	AutoMigrate bool   `yaml:"autoMigrate"` // 启动时自动执行数据库迁移
+}
+
 type PostgresInfo struct {
 	Master string `yaml:"master"`
 	Slave1 string `yaml:"slave1"`
@@ -50,6 +65,55 @@ type K8SInfo struct {
 	ImageKey string `yaml:"imageKey"`
 }
 
+type RedisInfo struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	Pool     int    `yaml:"pool"`
+}
+
+type RabbitMQInfo struct {
+	Addr string `yaml:"addr"`
+}
+
+type LockInfo struct {
+	Driver string `yaml:"driver"` // redis、postgres
+	TTL    int    `yaml:"ttl"`    // 锁过期时间(秒)
+}
+
+type SecretInfo struct {
+	Key string `yaml:"key"` // 服务secret的加密密钥(base64编码的32字节AES密钥), 可用openssl rand -base64 32生成
+}
+
+type BuildInfo struct {
+	Mirror      string `yaml:"mirror"`      // 代码仓库本地镜像目录, 用于增量获取提交记录, 默认: /tmp/code/mirror
+	Workspace   string `yaml:"workspace"`   // 按构建插件生成的编译脚本、Dockerfile目录, 默认: /tmp/code/build
+	Artifact    string `yaml:"artifact"`    // 编译包缓存目录, 按模块、提交复用, 默认: /tmp/code/artifact
+	Retention   int    `yaml:"retention"`   // 编译包超过多少天未使用则清理, 默认: 7
+	Keep        int    `yaml:"keep"`        // 每个模块最多保留的编译包个数, 默认: 5
+	Concurrency int    `yaml:"concurrency"` // 多模块并发打tag、构建镜像的个数, 默认: 4
+}
+
+// RegistryInfo code层镜像仓库, kind为空时部署前不校验镜像, 也不清理
+type RegistryInfo struct {
+	Kind       string `yaml:"kind"`       // 仓库类型: registry(Docker Registry v2)、harbor
+	Repository string `yaml:"repository"` // code层镜像前缀, 与script/config.sh中IMAGE_REGISTRY一致, 例如: 10.12.28.4:80/code
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	Insecure   bool   `yaml:"insecure"` // 使用http访问仓库
+	Keep       int    `yaml:"keep"`     // 保留每个服务最近多少个成功上线单引用的镜像, 默认: 10
+	Clean      bool   `yaml:"clean"`    // 定期清理未被引用的镜像
+	Grace      int    `yaml:"grace"`    // 不清理构建时间在多少秒以内的镜像, 避免删除刚推送、尚未回调记录的镜像, 默认: 86400
+}
+
+// HookInfo 代码仓库webhook, secret为空时不接收webhook
+type HookInfo struct {
+	Secret   string   `yaml:"secret"`   // 签名密钥: GitHub、Gitea按HMAC-SHA256校验签名, GitLab校验X-Gitlab-Token
+	Branches []string `yaml:"branches"` // 发布分支, 这些分支有推送或合并时创建上线单
+	Creator  string   `yaml:"creator"`  // 上线单创建人, 默认: webhook
+	Build    bool     `yaml:"build"`    // 创建上线单后立即打tag并构建镜像
+}
+
 var (
 	setting Settings
 	lock    = new(sync.RWMutex)
@@ -98,8 +162,41 @@ func InitLogger(logFile string) {
 	log.SetLevel(log.InfoLevel)
 }
 
+// 存储驱动
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// Database 根据存储驱动返回数据库驱动、主库、从库
+func Database() (string, string, []string) {
+	if setting.Storage.Driver == DriverSQLite {
+		return DriverSQLite, setting.Storage.SQLite, nil
+	}
+
+	slaves := make([]string, 0)
+	for _, slave := range []string{setting.Postgres.Slave1, setting.Postgres.Slave2} {
+		if slave != "" {
+			slaves = append(slaves, slave)
+		}
+	}
+	return DriverPostgres, setting.Postgres.Master, slaves
+}
+
+// Clusters 返回已配置kubeconfig的集群
+func Clusters() []string {
+	clusters := make([]string, 0)
+	if setting.K8S.HP != "" {
+		clusters = append(clusters, HP)
+	}
+	if setting.K8S.XQ != "" {
+		clusters = append(clusters, XQ)
+	}
+	return clusters
+}
+
 // GetClientset get client-go clientset
-func GetClientset(cluster string) (*kubernetes.Clientset, error) {
+func GetClientset(cluster string) (kubernetes.Interface, error) {
 	var clusterConfig string
 	switch cluster {
 	case HP:
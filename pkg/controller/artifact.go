@@ -0,0 +1,43 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/service/publish"
+)
+
+func QueryArtifact(c *gin.Context) {
+	type params struct {
+		Module string `form:"module"` // 为空时查询全部模块
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	artifacts, err := publish.QueryArtifacts(data.Module)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, artifacts)
+}
+
+// CleanArtifact 按保留策略立即清理编译包缓存
+func CleanArtifact(c *gin.Context) {
+	cleaned, err := publish.CleanArtifacts()
+	if err != nil {
+		log.Errorf("clean build artifacts failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, map[string]int{"cleaned": cleaned})
+}
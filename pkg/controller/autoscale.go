@@ -0,0 +1,87 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/service/publish"
+)
+
+func SetAutoscale(c *gin.Context) {
+	type params struct {
+		Service     string `form:"service" binding:"required"`
+		Phase       string `form:"phase" binding:"required"`        // sandbox、online
+		MinReplicas int32  `form:"min_replicas" binding:"required"` // 最小副本数
+		MaxReplicas int32  `form:"max_replicas" binding:"required"` // 最大副本数
+		TargetCPU   int32  `form:"target_cpu"`                      // CPU平均利用率(%)
+		TargetMem   int32  `form:"target_mem"`                      // 内存平均利用率(%)
+		Metrics     string `form:"metrics"`                         // 自定义指标json: [{"type": "pods", "name": "qps", "target": "100"}]
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	autoscale := &model.ServiceAutoscale{
+		Service:     data.Service,
+		Phase:       data.Phase,
+		MinReplicas: data.MinReplicas,
+		MaxReplicas: data.MaxReplicas,
+		TargetCPU:   data.TargetCPU,
+		TargetMem:   data.TargetMem,
+		Metrics:     data.Metrics,
+	}
+	if err := publish.SetAutoscale(autoscale); err != nil {
+		log.Errorf("set service: %s autoscale failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, autoscale)
+}
+
+func QueryAutoscale(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	autoscales, err := publish.QueryAutoscale(data.Service)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, autoscales)
+}
+
+func DeleteAutoscale(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+		Phase   string `form:"phase" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.DeleteAutoscale(data.Service, data.Phase); err != nil {
+		log.Errorf("delete service: %s autoscale failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
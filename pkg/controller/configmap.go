@@ -21,6 +21,11 @@ func ConfigMap(c *gin.Context) {
 		Namespace string `form:"namespace" binding:"required"` // 命名空间
 		Service   string `form:"service" binding:"required"`   // 服务
 		Pair      string `form:"pair" binding:"required"`      // kv键值对
+		Phase     string `form:"phase"`                        // 为空修改公共配置, sandbox/online修改阶段覆盖配置
+		Username  string `form:"username" binding:"required"`  // 发布人
+		Restart   bool   `form:"restart"`                      // 重启在线组使新的环境变量生效
+		DryRun    bool   `form:"dry_run"`                      // 只渲染不发布
+		Diff      bool   `form:"diff"`                         // 渲染并与线上对比
 	}
 
 	var data params
@@ -41,10 +46,107 @@ func ConfigMap(c *gin.Context) {
 		return
 	}
 
-	if err := publish.NewConfigMap(namespace, service, pair, pairInfo); err != nil {
+	if data.DryRun || data.Diff {
+		manifests, err := publish.PreviewConfigMap(namespace, service, data.Phase, pairInfo, data.Diff)
+		if err != nil {
+			log.Errorf("preview configmap failed: %+v", err)
+			ResponseFailed(c, err.Error())
+			return
+		}
+		ResponseSuccess(c, manifests)
+		return
+	}
+
+	if err := publish.NewConfigMap(namespace, service, data.Phase, pair, data.Username, data.Restart); err != nil {
 		log.Errorf("publish configmap failed: %+v", err)
 		ResponseFailed(c, fmt.Sprintf(config.CM_PUBLISH_FAILED, err))
 		return
 	}
 	ResponseSuccess(c, nil)
 }
+
+// ConfigMapApply 将阶段最新的配置发布到在线组并重启, 例如沙盒验证后把公共配置推到全量
+func ConfigMapApply(c *gin.Context) {
+	type params struct {
+		Service  string `form:"service" binding:"required"`
+		Phase    string `form:"phase" binding:"required"`
+		Username string `form:"username" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	log.Infof("user: %s apply service: %s phase: %s configmap", data.Username, data.Service, data.Phase)
+	if err := publish.ApplyConfigMap(data.Service, data.Phase); err != nil {
+		log.Errorf("apply configmap failed: %+v", err)
+		ResponseFailed(c, fmt.Sprintf(config.CM_PUBLISH_FAILED, err))
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+func ConfigMapVersions(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	versions, err := publish.QueryConfigMapVersions(data.Service)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, versions)
+}
+
+func ConfigMapDiff(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+		From    int    `form:"from" binding:"required"` // 对比的旧版本
+		To      int    `form:"to" binding:"required"`   // 对比的新版本
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	diff, err := publish.DiffConfigMap(data.Service, data.From, data.To)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, diff)
+}
+
+func ConfigMapRollback(c *gin.Context) {
+	type params struct {
+		Namespace string `form:"namespace" binding:"required"`
+		Service   string `form:"service" binding:"required"`
+		Version   int    `form:"version" binding:"required"` // 回滚到的版本
+		Username  string `form:"username" binding:"required"`
+		Restart   bool   `form:"restart"` // 重启在线组使回滚后的环境变量生效
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.RollbackConfigMap(data.Namespace, data.Service, data.Version, data.Username, data.Restart); err != nil {
+		log.Errorf("rollback configmap failed: %+v", err)
+		ResponseFailed(c, fmt.Sprintf(config.CM_PUBLISH_FAILED, err))
+		return
+	}
+	ResponseSuccess(c, nil)
+}
@@ -12,6 +12,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"nautilus/pkg/config"
+	"nautilus/pkg/model"
 	"nautilus/pkg/service/publish"
 )
 
@@ -21,6 +22,15 @@ func BuildCronJob(c *gin.Context) {
 		Service   string `form:"service" binding:"required"`
 		Command   string `form:"command" binding:"required"`
 		Schedule  string `form:"schedule" binding:"required"`
+		DryRun    bool   `form:"dry_run"` // 只渲染不发布
+		Diff      bool   `form:"diff"`    // 渲染并与线上对比
+
+		// 调度配置, 均为空时调度到定时节点池(aggregate=cronjob)
+		NodeSelector  string `form:"node_selector"`
+		Tolerations   string `form:"tolerations"`
+		NodeAffinity  string `form:"node_affinity"`
+		PriorityClass string `form:"priority_class"`
+		RuntimeClass  string `form:"runtime_class"`
 	}
 
 	var data params
@@ -29,7 +39,26 @@ func BuildCronJob(c *gin.Context) {
 		return
 	}
 
-	name, err := publish.NewCronjob(data.Namespace, data.Service, data.Command, data.Schedule)
+	scheduling := &model.Scheduling{
+		NodeSelector:  data.NodeSelector,
+		Tolerations:   data.Tolerations,
+		NodeAffinity:  data.NodeAffinity,
+		PriorityClass: data.PriorityClass,
+		RuntimeClass:  data.RuntimeClass,
+	}
+
+	if data.DryRun || data.Diff {
+		manifests, err := publish.PreviewCronjob(data.Namespace, data.Service, data.Command, data.Schedule, scheduling, data.Diff)
+		if err != nil {
+			log.Errorf("preview cronjob failed: %+v", err)
+			ResponseFailed(c, err.Error())
+			return
+		}
+		ResponseSuccess(c, manifests)
+		return
+	}
+
+	name, err := publish.NewCronjob(data.Namespace, data.Service, data.Command, data.Schedule, scheduling)
 	if err != nil {
 		log.Errorf("publish cronjob failed: %+v", err)
 		ResponseFailed(c, fmt.Sprintf(config.CRON_PUBLISH_ERROR, err))
@@ -17,6 +17,8 @@ func Deploy(c *gin.Context) {
 		ID       int64  `form:"pipeline_id" binding:"required"`
 		Phase    string `form:"phase" binding:"required"`
 		Username string `form:"username" binding:"required"`
+		DryRun   bool   `form:"dry_run"` // 只渲染不发布
+		Diff     bool   `form:"diff"`    // 渲染并与线上对比
 	}
 
 	var data params
@@ -31,6 +33,17 @@ func Deploy(c *gin.Context) {
 		username = data.Username
 	)
 
+	if data.DryRun || data.Diff {
+		manifests, err := publish.PreviewDeploy(pid, phase, data.Diff)
+		if err != nil {
+			log.Errorf("preview deployment failed: %+v", err)
+			ResponseFailed(c, err.Error())
+			return
+		}
+		ResponseSuccess(c, manifests)
+		return
+	}
+
 	if err := publish.NewDeploy(pid, phase, username); err != nil {
 		log.Errorf("build deployment failed: %+v", err)
 		ResponseFailed(c, err.Error())
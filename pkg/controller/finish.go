@@ -31,3 +31,45 @@ func Finish(c *gin.Context) {
 	}
 	ResponseSuccess(c, nil)
 }
+
+// Fail 标记上线失败
+func Fail(c *gin.Context) {
+	type params struct {
+		ID       int64  `form:"pipeline_id" binding:"required"`
+		Username string `form:"username" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.NewFail(data.ID, data.Username); err != nil {
+		log.Errorf("fail pipeline handle failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// Terminate 终止上线单
+func Terminate(c *gin.Context) {
+	type params struct {
+		ID       int64  `form:"pipeline_id" binding:"required"`
+		Username string `form:"username" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.NewTerminate(data.ID, data.Username); err != nil {
+		log.Errorf("terminate pipeline handle failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
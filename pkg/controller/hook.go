@@ -0,0 +1,53 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/service/hook"
+	"nautilus/pkg/service/publish"
+)
+
+// GitHook 接收GitLab、Gitea、GitHub的推送及合并webhook, 发布分支变更时为绑定的服务创建上线单
+func GitHook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	created, err := hook.Git(c.Request.Header, body)
+	if err != nil {
+		log.Errorf("handle git webhook failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if config.Config().Hook.Build {
+		for _, item := range created {
+			if item.PipelineID > 0 {
+				go buildPipeline(item.PipelineID, item.Service)
+			}
+		}
+	}
+	ResponseSuccess(c, created)
+}
+
+// buildPipeline 依次打tag、构建镜像, 打tag失败时不再构建镜像
+func buildPipeline(pid int64, service string) {
+	if err := publish.NewBuildTag(pid, service, false, false); err != nil {
+		log.Errorf("webhook pipeline: %d build tag failed: %+v", pid, err)
+		return
+	}
+	if err := publish.NewBuildImage(pid, service, false); err != nil {
+		log.Errorf("webhook pipeline: %d build image failed: %+v", pid, err)
+		return
+	}
+	log.Infof("webhook pipeline: %d build tag and image success", pid)
+}
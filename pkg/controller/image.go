@@ -32,7 +32,7 @@ func BuildImage(c *gin.Context) {
 		service = data.Service
 	)
 
-	if err := publish.NewBuildImage(pid, service); err != nil {
+	if err := publish.NewBuildImage(pid, service, false); err != nil {
 		log.Errorf("build image pre handle failed: %+v", err)
 		ResponseFailed(c, err.Error())
 		return
@@ -40,6 +40,27 @@ func BuildImage(c *gin.Context) {
 	ResponseSuccess(c, nil)
 }
 
+// RetryImage 只重试镜像构建失败的模块, 已成功的模块跳过
+func RetryImage(c *gin.Context) {
+	type params struct {
+		ID      *int64 `form:"pipeline_id" binding:"required"`
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.NewBuildImage(*data.ID, data.Service, true); err != nil {
+		log.Errorf("retry build image failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
 func UpdateImage(c *gin.Context) {
 	type params struct {
 		ID       *int64 `form:"taskid" binding:"required"`
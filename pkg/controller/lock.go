@@ -0,0 +1,54 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/service/publish"
+)
+
+func QueryLock(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	owner, err := publish.QueryLock(data.Service)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, owner)
+}
+
+func ForceUnlock(c *gin.Context) {
+	type params struct {
+		Service  string `form:"service" binding:"required"`
+		Operator string `form:"operator" binding:"required"`
+		Reason   string `form:"reason" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	owner, err := publish.ForceUnlock(data.Service, data.Operator, data.Reason)
+	if err != nil {
+		log.Errorf("force unlock service: %s failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, owner)
+}
@@ -6,6 +6,8 @@
 package controller
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 
@@ -42,18 +44,63 @@ func CreatePipeline(c *gin.Context) {
 	)
 
 	cp := pipeline.NewCreatePipeline()
-	if err := cp.Handle(name, summary, creator, rd, qa, pm, service, moduleList); err != nil {
+	pid, err := cp.Handle(name, summary, creator, rd, qa, pm, service, moduleList)
+	if err != nil {
 		log.Errorf("create pipeline failed: %+v", err)
+		// 参数校验失败时返回各字段的错误
+		var verr *pipeline.ValidationError
+		if errors.As(err, &verr) {
+			Response(c, Failed, err.Error(), verr.Fields)
+			return
+		}
 		ResponseFailed(c, err.Error())
 		return
 	}
-	ResponseSuccess(c, nil)
+	ResponseSuccess(c, map[string]int64{"pipeline_id": pid})
 }
 
 func ListPipeline(c *gin.Context) {
 
 }
 
+// QueryPipeline 查询上线单及变更模块, 包括tag、分支合并检查结果
 func QueryPipeline(c *gin.Context) {
+	type params struct {
+		ID int64 `form:"pipeline_id" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	detail, err := pipeline.QueryPipeline(data.ID)
+	if err != nil {
+		log.Errorf("query pipeline failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, detail)
+}
+
+// Changelog 查询上线单各模块相对上次成功上线的提交及diffstat
+func Changelog(c *gin.Context) {
+	type params struct {
+		ID int64 `uri:"id" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBindUri(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
 
+	changelogs, err := pipeline.Changelog(data.ID)
+	if err != nil {
+		log.Errorf("query pipeline changelog failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, changelogs)
 }
@@ -0,0 +1,67 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/service/publish"
+)
+
+func SetPolicy(c *gin.Context) {
+	type params struct {
+		Service        string `form:"service" binding:"required"`
+		MinAvailable   string `form:"min_available"`           // PDB最少可用pod数, 例如: 1、50%
+		MaxUnavailable string `form:"max_unavailable"`         // PDB最多不可用pod数, 与min_available二选一
+		ZoneMaxSkew    int32  `form:"zone_max_skew"`           // 可用区打散最大偏差, 0表示不按可用区打散
+		ZoneHard       bool   `form:"zone_hard"`               // 可用区打散不满足时是否拒绝调度
+		NodeMaxSkew    int32  `form:"node_max_skew,default=1"` // 节点打散最大偏差, 0表示不按节点打散
+		NodeHard       bool   `form:"node_hard"`               // 节点打散不满足时是否拒绝调度
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	policy := &model.ServicePolicy{
+		Service:        data.Service,
+		MinAvailable:   data.MinAvailable,
+		MaxUnavailable: data.MaxUnavailable,
+		ZoneMaxSkew:    data.ZoneMaxSkew,
+		ZoneHard:       data.ZoneHard,
+		NodeMaxSkew:    data.NodeMaxSkew,
+		NodeHard:       data.NodeHard,
+	}
+	if err := publish.SetPolicy(policy); err != nil {
+		log.Errorf("set service: %s policy failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, policy)
+}
+
+func QueryPolicy(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	policy, err := publish.QueryPolicy(data.Service)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, policy)
+}
@@ -0,0 +1,53 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/service/publish"
+)
+
+func QueryImageTags(c *gin.Context) {
+	type params struct {
+		Module string `form:"module" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	tags, err := publish.QueryImageTags(data.Module)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, tags)
+}
+
+// CleanImages 立即清理未被引用的code层镜像, dry_run为true时只返回待删除的镜像
+func CleanImages(c *gin.Context) {
+	type params struct {
+		DryRun bool `form:"dry_run"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	deleted, err := publish.CleanImages(data.DryRun)
+	if err != nil {
+		log.Errorf("clean registry images failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, deleted)
+}
@@ -0,0 +1,57 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/service/publish"
+)
+
+// SetBuildMode 设置服务的构建方式: layer(默认)或single
+func SetBuildMode(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+		Mode    string `form:"mode"` // 为空时恢复默认的layer
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.SetBuildMode(data.Service, data.Mode); err != nil {
+		log.Errorf("set service: %s build mode failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+// UpdateRelease makerelease构建完成后上报发布镜像
+func UpdateRelease(c *gin.Context) {
+	type params struct {
+		ID    *int64 `form:"taskid" binding:"required"`
+		Image string `form:"image" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+
+	if err := publish.UpdateReleaseImage(*data.ID, data.Image); err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+	c.String(http.StatusOK, config.OK)
+}
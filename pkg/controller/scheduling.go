@@ -0,0 +1,68 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/service/publish"
+)
+
+func SetScheduling(c *gin.Context) {
+	type params struct {
+		Service       string `form:"service" binding:"required"`
+		JobID         int64  `form:"job_id"`         // 定时任务ID, 为空时配置服务本身
+		NodeSelector  string `form:"node_selector"`  // 节点标签(json), 例如: {"aggregate": "gpu"}
+		Tolerations   string `form:"tolerations"`    // 容忍(json), 与k8s tolerations格式一致
+		NodeAffinity  string `form:"node_affinity"`  // 节点亲和(json), 与k8s nodeAffinity格式一致
+		PriorityClass string `form:"priority_class"` // 优先级类
+		RuntimeClass  string `form:"runtime_class"`  // 运行时类
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	scheduling := &model.Scheduling{
+		Service:       data.Service,
+		CrontabID:     data.JobID,
+		NodeSelector:  data.NodeSelector,
+		Tolerations:   data.Tolerations,
+		NodeAffinity:  data.NodeAffinity,
+		PriorityClass: data.PriorityClass,
+		RuntimeClass:  data.RuntimeClass,
+	}
+	if err := publish.SetScheduling(scheduling); err != nil {
+		log.Errorf("set service: %s job: %d scheduling failed: %+v", data.Service, data.JobID, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, scheduling)
+}
+
+func QueryScheduling(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+		JobID   int64  `form:"job_id"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	scheduling, err := publish.QueryScheduling(data.Service, data.JobID)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, scheduling)
+}
@@ -0,0 +1,85 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/service/publish"
+)
+
+func SetSecret(c *gin.Context) {
+	type params struct {
+		Namespace string `form:"namespace" binding:"required"` // 命名空间
+		Service   string `form:"service" binding:"required"`   // 服务
+		Pair      string `form:"pair" binding:"required"`      // kv键值对, 只更新传入的key
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	var pairInfo map[string]string
+	if err := json.Unmarshal([]byte(data.Pair), &pairInfo); err != nil {
+		ResponseFailed(c, fmt.Sprintf(config.CM_DECODE_DATA_ERROR, err))
+		return
+	}
+
+	// NOTE: 不记录、不返回value
+	if err := publish.SetSecret(data.Namespace, data.Service, pairInfo); err != nil {
+		log.Errorf("set service: %s secret failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+func DeleteSecret(c *gin.Context) {
+	type params struct {
+		Namespace string   `form:"namespace" binding:"required"`
+		Service   string   `form:"service" binding:"required"`
+		Keys      []string `form:"keys" binding:"required"` // 要删除的key, 可传多个
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.DeleteSecret(data.Namespace, data.Service, data.Keys); err != nil {
+		log.Errorf("delete service: %s secret failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+func QuerySecret(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	keys, err := publish.QuerySecret(data.Service)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, keys)
+}
@@ -14,6 +14,8 @@ import (
 func Service(c *gin.Context) {
 	type params struct {
 		Service string `form:"service" binding:"required"`
+		DryRun  bool   `form:"dry_run"` // 只渲染不发布
+		Diff    bool   `form:"diff"`    // 渲染并与线上对比
 	}
 
 	var data params
@@ -24,6 +26,16 @@ func Service(c *gin.Context) {
 	serviceName := data.Service
 
 	se := publish.NewService()
+	if data.DryRun || data.Diff {
+		manifests, err := se.Preview(serviceName, data.Diff)
+		if err != nil {
+			ResponseFailed(c, err.Error())
+			return
+		}
+		ResponseSuccess(c, manifests)
+		return
+	}
+
 	if err := se.Handle(serviceName); err != nil {
 		ResponseFailed(c, err.Error())
 		return
@@ -12,6 +12,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"nautilus/pkg/config"
+	"nautilus/pkg/model"
 	"nautilus/pkg/service/publish"
 )
 
@@ -19,6 +20,7 @@ func BuildTag(c *gin.Context) {
 	type params struct {
 		ID      int64  `form:"pipeline_id" binding:"required"`
 		Service string `form:"service" binding:"required"`
+		Force   bool   `form:"force"` // 分支合并检查不通过时强制打tag
 	}
 
 	var data params
@@ -32,7 +34,7 @@ func BuildTag(c *gin.Context) {
 		serviceName = data.Service
 	)
 
-	if err := publish.NewBuildTag(pid, serviceName); err != nil {
+	if err := publish.NewBuildTag(pid, serviceName, data.Force, false); err != nil {
 		log.Errorf("build tag failed: %+v", err)
 		ResponseFailed(c, err.Error())
 		return
@@ -40,6 +42,28 @@ func BuildTag(c *gin.Context) {
 	ResponseSuccess(c, nil)
 }
 
+// RetryTag 只重试打tag失败的模块, 已成功的模块跳过
+func RetryTag(c *gin.Context) {
+	type params struct {
+		ID      int64  `form:"pipeline_id" binding:"required"`
+		Service string `form:"service" binding:"required"`
+		Force   bool   `form:"force"` // 分支合并检查不通过时强制打tag
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.NewBuildTag(data.ID, data.Service, data.Force, true); err != nil {
+		log.Errorf("retry build tag failed: %+v", err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
 func ReceiveTag(c *gin.Context) {
 	type params struct {
 		ID     int64  `form:"taskid" binding:"required"`
@@ -68,6 +92,38 @@ func ReceiveTag(c *gin.Context) {
 	c.String(http.StatusOK, config.OK)
 }
 
+func ReceiveMerge(c *gin.Context) {
+	type params struct {
+		ID      int64  `form:"taskid" binding:"required"`
+		Module  string `form:"module" binding:"required"`
+		Status  string `form:"status" binding:"required"`
+		Base    string `form:"base"`
+		Ahead   int    `form:"ahead"`
+		Behind  int    `form:"behind"`
+		Commits string `form:"commits"` // 落后的提交, 每行一个
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+
+	check := &model.PipelineUpdate{
+		MergeStatus:  data.Status,
+		MergeBase:    data.Base,
+		MergeAhead:   data.Ahead,
+		MergeBehind:  data.Behind,
+		MergeCommits: data.Commits,
+	}
+	if err := publish.NewReceiveMerge(data.ID, data.Module, check); err != nil {
+		log.Errorf("receive merge check failed: %+v", err)
+		c.String(http.StatusOK, err.Error())
+		return
+	}
+	c.String(http.StatusOK, config.OK)
+}
+
 func ReceivePkg(c *gin.Context) {
 	type params struct {
 		ID     int64  `form:"taskid" binding:"required"`
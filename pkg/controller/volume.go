@@ -0,0 +1,52 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/service/publish"
+)
+
+func SetVolume(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+		Volume  string `form:"volume"` // 存储卷配置(json), 为空时恢复hostPath约定目录
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	if err := publish.SetVolume(data.Service, data.Volume); err != nil {
+		log.Errorf("set service: %s volume failed: %+v", data.Service, err)
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, nil)
+}
+
+func QueryVolume(c *gin.Context) {
+	type params struct {
+		Service string `form:"service" binding:"required"`
+	}
+
+	var data params
+	if err := c.ShouldBind(&data); err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+
+	volumes, err := publish.QueryVolume(data.Service)
+	if err != nil {
+		ResponseFailed(c, err.Error())
+		return
+	}
+	ResponseSuccess(c, volumes)
+}
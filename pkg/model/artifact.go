@@ -0,0 +1,68 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// BuildArtifact 编译包缓存, 按模块、提交、构建配置唯一
+type BuildArtifact struct {
+	ID         int64
+	CodeModule string    `xorm:"varchar(50) notnull unique(module_commit)"`
+	CommitID   string    `xorm:"varchar(64) notnull unique(module_commit)"`
+	BuildHash  string    `xorm:"varchar(64) notnull unique(module_commit)"`
+	Path       string    `xorm:"varchar(255) notnull"`
+	Size       int64     `xorm:"bigint notnull"`
+	UseAt      time.Time `xorm:"timestamp notnull"`
+	CreateAt   time.Time `xorm:"timestamp notnull created"`
+}
+
+func GetArtifact(module, commitID, buildHash string) (*BuildArtifact, error) {
+	artifact := new(BuildArtifact)
+	if has, err := MEngine.Where("code_module = ? and commit_id = ? and build_hash = ?", module, commitID, buildHash).
+		Get(artifact); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return artifact, nil
+}
+
+func CreateArtifact(artifact *BuildArtifact) error {
+	artifact.UseAt = time.Now()
+	_, err := MEngine.Insert(artifact)
+	return err
+}
+
+// TouchArtifact 复用编译包时更新使用时间
+func TouchArtifact(id int64) error {
+	artifact := &BuildArtifact{UseAt: time.Now()}
+	if affected, err := MEngine.ID(id).Cols("use_at").Update(artifact); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// FindArtifacts 按模块、最近使用时间倒序返回编译包, module为空时返回全部
+func FindArtifacts(module string) ([]BuildArtifact, error) {
+	artifacts := make([]BuildArtifact, 0)
+	session := SEngine.Asc("code_module").Desc("use_at")
+	if module != "" {
+		session = session.Where("code_module = ?", module)
+	}
+	if err := session.Find(&artifacts); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+func DeleteArtifact(id int64) error {
+	_, err := MEngine.ID(id).Delete(new(BuildArtifact))
+	return err
+}
@@ -0,0 +1,83 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// ServiceAutoscale 服务在某个部署阶段的自动扩缩容配置, 渲染为绑定在线组deployment的HPA
+type ServiceAutoscale struct {
+	ID          int64
+	Service     string    `xorm:"varchar(32) notnull unique(service_phase)"`
+	Phase       string    `xorm:"varchar(20) notnull unique(service_phase)"`
+	MinReplicas int32     `xorm:"int notnull"`
+	MaxReplicas int32     `xorm:"int notnull"`
+	TargetCPU   int32     `xorm:"int notnull"` // CPU平均利用率(%), 0表示不按CPU扩缩
+	TargetMem   int32     `xorm:"int notnull"` // 内存平均利用率(%), 0表示不按内存扩缩
+	Metrics     string    `xorm:"text"`        // 自定义指标(json)
+	CreateAt    time.Time `xorm:"timestamp notnull created"`
+	UpdateAt    time.Time `xorm:"timestamp notnull updated"`
+}
+
+// GetAutoscale 获取服务在指定阶段的自动扩缩容配置, 未配置返回NotFound
+func GetAutoscale(service, phase string) (*ServiceAutoscale, error) {
+	autoscale := new(ServiceAutoscale)
+	if has, err := SEngine.Where("service=? and phase=?", service, phase).Get(autoscale); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return autoscale, nil
+}
+
+// FindAutoscales 获取服务全部阶段的自动扩缩容配置
+func FindAutoscales(service string) ([]ServiceAutoscale, error) {
+	autoscales := make([]ServiceAutoscale, 0)
+	if err := SEngine.Where("service=?", service).Asc("id").Find(&autoscales); err != nil {
+		return nil, err
+	}
+	return autoscales, nil
+}
+
+// SaveAutoscale 创建或更新服务在指定阶段的自动扩缩容配置
+func SaveAutoscale(autoscale *ServiceAutoscale) error {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	stored := new(ServiceAutoscale)
+	has, err := session.Where("service=? and phase=?", autoscale.Service, autoscale.Phase).Get(stored)
+	if err != nil {
+		return err
+	}
+
+	if has {
+		cols := []string{"min_replicas", "max_replicas", "target_cpu", "target_mem", "metrics"}
+		if _, err := session.ID(stored.ID).Cols(cols...).Update(autoscale); err != nil {
+			return err
+		}
+		autoscale.ID = stored.ID
+	} else {
+		if _, err := session.Insert(autoscale); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// DeleteAutoscale 删除服务在指定阶段的自动扩缩容配置
+func DeleteAutoscale(service, phase string) error {
+	if affected, err := MEngine.Where("service=? and phase=?", service, phase).Delete(new(ServiceAutoscale)); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
@@ -10,9 +10,13 @@ import (
 	"sync"
 
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
 	"xorm.io/xorm"
 	"xorm.io/xorm/names"
+	"xorm.io/xorm/schemas"
+
+	"nautilus/pkg/model/migrate"
 )
 
 var (
@@ -59,3 +63,71 @@ func Connect(driver, master string, slaves ...string) {
 		SEngine = eg.Slave()
 	})
 }
+
+// IsPostgres 当前存储是否为postgres
+func IsPostgres() bool {
+	return MEngine != nil && MEngine.Dialect().URI().DBType == schemas.POSTGRES
+}
+
+// Tables 返回全部模型, 用于校验表结构
+func Tables() []interface{} {
+	return []interface{}{
+		new(Cluster),
+		new(Namespace),
+		new(Service),
+		new(ServiceLock),
+		new(ServiceLockAudit),
+		new(ServiceAutoscale),
+		new(ServicePolicy),
+		new(ServiceSecret),
+		new(ConfigmapVersion),
+		new(CodeModule),
+		new(ModuleBinding),
+		new(Pipeline),
+		new(PipelineUpdate),
+		new(PipelineImage),
+		new(PipelinePhase),
+		new(Changelog),
+		new(BuildArtifact),
+		new(Crontab),
+		new(Scheduling),
+	}
+}
+
+// Migrate 在主库上执行数据库迁移. action: up、down、version
+func Migrate(action string, steps int) (int, error) {
+	m, err := migrate.New(MEngine)
+	if err != nil {
+		return 0, err
+	}
+
+	switch action {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down(steps)
+	case "version":
+	default:
+		return 0, fmt.Errorf("unknown migrate action: %s", action)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return m.Version()
+}
+
+// PingMaster 检查主库连接
+func PingMaster() error {
+	if MEngine == nil {
+		return fmt.Errorf("master database not connected")
+	}
+	return MEngine.Ping()
+}
+
+// PingSlave 检查从库连接
+func PingSlave() error {
+	if SEngine == nil {
+		return fmt.Errorf("slave database not connected")
+	}
+	return SEngine.Ping()
+}
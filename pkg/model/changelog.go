@@ -0,0 +1,36 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// Changelog 模块两个tag之间的变更记录缓存
+type Changelog struct {
+	ID         int64
+	CodeModule string    `xorm:"varchar(50) notnull unique(module_tags)"`
+	FromTag    string    `xorm:"varchar(50) notnull unique(module_tags)"`
+	ToTag      string    `xorm:"varchar(50) notnull unique(module_tags)"`
+	Content    string    `xorm:"text notnull"`
+	CreateAt   time.Time `xorm:"timestamp notnull created"`
+}
+
+func GetChangelog(module, fromTag, toTag string) (*Changelog, error) {
+	changelog := new(Changelog)
+	if has, err := SEngine.Where("code_module = ? and from_tag = ? and to_tag = ?", module, fromTag, toTag).
+		Get(changelog); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return changelog, nil
+}
+
+func CreateChangelog(changelog *Changelog) error {
+	_, err := MEngine.Insert(changelog)
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// 公共配置, 各阶段在此基础上覆盖
+const CONFIG_BASE = ""
+
+// ConfigmapVersion configmap的发布历史, 版本号按服务递增.
+// Phase为空表示公共配置, 否则为该阶段的覆盖配置.
+type ConfigmapVersion struct {
+	ID       int64
+	Service  string    `xorm:"varchar(32) notnull unique(service_version)"`
+	Version  int       `xorm:"int notnull unique(service_version)"`
+	Phase    string    `xorm:"varchar(20) notnull"`
+	Data     string    `xorm:"text notnull"`
+	Creator  string    `xorm:"varchar(50) notnull"`
+	Comment  string    `xorm:"varchar(200) notnull"`
+	CreateAt time.Time `xorm:"timestamp notnull created"`
+}
+
+// SaveConfigmapVersion 记录新的configmap版本, 公共配置同时更新服务当前的configmap
+func SaveConfigmapVersion(version *ConfigmapVersion) error {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	latest := new(ConfigmapVersion)
+	has, err := session.Where("service=?", version.Service).Desc("version").Get(latest)
+	if err != nil {
+		return err
+	}
+	version.Version = 1
+	if has {
+		version.Version = latest.Version + 1
+	}
+
+	if _, err := session.Insert(version); err != nil {
+		return err
+	}
+	if version.Phase != CONFIG_BASE {
+		return session.Commit()
+	}
+
+	service := &Service{Configmap: version.Data}
+	if affected, err := session.Where("name = ?", version.Service).Cols("configmap").Update(service); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return session.Commit()
+}
+
+// GetConfigmapVersion 获取服务指定版本的configmap, 不存在返回NotFound
+func GetConfigmapVersion(service string, version int) (*ConfigmapVersion, error) {
+	cv := new(ConfigmapVersion)
+	if has, err := MEngine.Where("service=? and version=?", service, version).Get(cv); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return cv, nil
+}
+
+// GetLatestConfigmapVersion 获取服务公共配置或阶段覆盖配置的最新版本, 不存在返回NotFound.
+// 保存配置后立即合并发布, 与GetConfigmapVersion一样从主库读取, 避免从库延迟发布旧的配置
+func GetLatestConfigmapVersion(service, phase string) (*ConfigmapVersion, error) {
+	cv := new(ConfigmapVersion)
+	if has, err := MEngine.Where("service=? and phase=?", service, phase).Desc("version").Get(cv); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return cv, nil
+}
+
+// FindConfigmapVersions 获取服务的configmap发布历史, 按版本倒序
+func FindConfigmapVersions(service string) ([]ConfigmapVersion, error) {
+	versions := make([]ConfigmapVersion, 0)
+	if err := SEngine.Where("service=?", service).Desc("version").Find(&versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
@@ -14,14 +14,59 @@ type Crontab struct {
 	UpdateAt  time.Time `xorm:"timestamp notnull updated"`
 }
 
-func CreateCrontab(namespace, service, command, schedule string) (int64, error) {
+// CreateCrontab 在同一事务内创建定时任务及其调度配置, 返回定时任务id
+func CreateCrontab(namespace, service, command, schedule string, scheduling *Scheduling) (int64, error) {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+
 	crontab := new(Crontab)
 	crontab.Namespace = namespace
 	crontab.Service = service
 	crontab.Command = command
 	crontab.Schedule = schedule
-	if _, err := MEngine.Insert(crontab); err != nil {
+	if _, err := session.Insert(crontab); err != nil {
 		return 0, err
 	}
-	return crontab.ID, nil
+
+	scheduling.Service = service
+	scheduling.CrontabID = crontab.ID
+	if _, err := session.Insert(scheduling); err != nil {
+		return 0, err
+	}
+	return crontab.ID, session.Commit()
+}
+
+func GetCrontab(crontabID int64) (*Crontab, error) {
+	crontab := new(Crontab)
+	if has, err := SEngine.ID(crontabID).Get(crontab); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return crontab, nil
+}
+
+// GetCrontabByCommand 服务在命名空间下执行相同命令的定时任务
+func GetCrontabByCommand(namespace, service, command string) (*Crontab, error) {
+	crontab := new(Crontab)
+	if has, err := SEngine.Where("namespace = ? AND service = ? AND command = ?", namespace, service, command).
+		Desc("id").Get(crontab); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return crontab, nil
+}
+
+// FindCrontabs 服务在命名空间下的定时任务
+func FindCrontabs(namespace, service string) ([]Crontab, error) {
+	crontabs := make([]Crontab, 0)
+	if err := SEngine.Where("namespace = ? AND service = ?", namespace, service).Asc("id").Find(&crontabs); err != nil {
+		return nil, err
+	}
+	return crontabs, nil
 }
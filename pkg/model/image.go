@@ -20,7 +20,9 @@ type PipelineImage struct {
 	ImageURL   string    `xorm:"varchar(200)"`        // 对应代码模块镜像地址
 	ImageTag   string    `xorm:"varchar(50)"`         // 对应代码模块镜像tag
 	Status     int       `xorm:"int notnull"`
+	BuildLog   string    `xorm:"text notnull"` // 镜像构建的输出
 	CreateAt   time.Time `xorm:"timestamp notnull created"`
+	UpdateAt   time.Time `xorm:"timestamp notnull updated"`
 }
 
 type ImageUnionQuery struct {
@@ -35,6 +37,14 @@ const (
 	PIFailed             // 构建失败
 )
 
+// ImageStatusName 模块构建状态对应的名称
+var ImageStatusName = map[int]string{
+	PIWait:    "wait",
+	PIProcess: "process",
+	PISuccess: "success",
+	PIFailed:  "failed",
+}
+
 func ImageSession() *xorm.Session {
 	return SEngine.Table("pipeline").Alias("p").
 		Join("INNER", []string{"pipeline_image", "pi"}, "p.id = pi.pipeline_id")
@@ -82,7 +92,7 @@ func CreateOrUpdatePipelineImage(pipelineID int64, service, codeModule, imageURL
 
 	table.ImageURL = imageURL
 	table.ImageTag = imageTag
-	if affected, err := MEngine.Cols("iamge_url", "image_tag", "update_at").
+	if affected, err := MEngine.Cols("image_url", "image_tag", "update_at").
 		Where("pipeline_id=? and service=? and code_module=?", pipelineID, service, codeModule).Update(table); err != nil {
 		return err
 	} else if affected == 0 {
@@ -91,6 +101,18 @@ func CreateOrUpdatePipelineImage(pipelineID int64, service, codeModule, imageURL
 	return nil
 }
 
+// UpdateImageStatus 记录模块镜像构建的状态及输出
+func UpdateImageStatus(pipelineID int64, codeModule string, status int, output string) error {
+	image := &PipelineImage{Status: status, BuildLog: output}
+	if affected, err := MEngine.Cols("status", "build_log", "update_at").
+		Where("pipeline_id=? and code_module=?", pipelineID, codeModule).Update(image); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
 func FindImages(pipelineID int64) ([]PipelineImage, error) {
 	images := make([]PipelineImage, 0)
 	if err := SEngine.Where("pipeline_id = ?", pipelineID).Find(&images); err != nil {
@@ -99,6 +121,17 @@ func FindImages(pipelineID int64) ([]PipelineImage, error) {
 	return images, nil
 }
 
+// FindActiveImages 未结束的上线单(待上线、上线中、回滚中)的镜像
+func FindActiveImages() ([]PipelineImage, error) {
+	images := make([]PipelineImage, 0)
+	if err := SEngine.Table("pipeline_image").Alias("pi").
+		Join("INNER", []string{"pipeline", "p"}, "p.id = pi.pipeline_id").
+		In("p.status", PLWait, PLProcess, PLRollbacking).Select("pi.*").Find(&images); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
 func QueryLatestSuccessModuleImage(service, codeModule string) (*ImageUnionQuery, error) {
 	image := new(ImageUnionQuery)
 	if has, err := ImageSession().Where("p.status=? and p.service=? and pi.code_module=?",
@@ -0,0 +1,147 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// ServiceLock 服务锁, 同一时间一个服务只能被一个上线单占用
+type ServiceLock struct {
+	ID         int64
+	Service    string    `xorm:"varchar(32) notnull unique"`
+	Owner      string    `xorm:"varchar(100) notnull"` // 持有者标识
+	PipelineID int64     `xorm:"bigint notnull"`
+	Username   string    `xorm:"varchar(50) notnull"`
+	Since      time.Time `xorm:"timestamp notnull"`
+	ExpireAt   time.Time `xorm:"timestamp notnull"`
+}
+
+// ServiceLockAudit 强制解锁记录
+type ServiceLockAudit struct {
+	ID         int64
+	Service    string    `xorm:"varchar(32) notnull"`
+	PipelineID int64     `xorm:"bigint notnull"`
+	Username   string    `xorm:"varchar(50) notnull"`
+	Since      time.Time `xorm:"timestamp"`
+	Operator   string    `xorm:"varchar(50) notnull"`
+	Reason     string    `xorm:"text"`
+	CreateAt   time.Time `xorm:"timestamp notnull created"`
+}
+
+// GetServiceLock 返回服务当前未过期的锁
+func GetServiceLock(service string) (*ServiceLock, error) {
+	sl := new(ServiceLock)
+	if has, err := MEngine.Where("service=? and expire_at>?", service, time.Now()).Get(sl); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return sl, nil
+}
+
+// TryServiceLock 在advisory锁保护下占用服务锁, 同一持有者重复占锁视为续期.
+// 返回当前持有者以及是否占锁成功.
+func TryServiceLock(service, owner string, pipelineID int64, username string, ttl time.Duration) (*ServiceLock, bool, error) {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, false, err
+	}
+
+	// 事务级advisory锁, 事务结束自动释放; sqlite写操作本身串行, 不需要
+	if IsPostgres() {
+		if _, err := session.Exec("select pg_advisory_xact_lock(hashtext(?))", "service_lock:"+service); err != nil {
+			return nil, false, err
+		}
+	}
+
+	now := time.Now()
+	sl := new(ServiceLock)
+	has, err := session.Where("service=?", service).Get(sl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if has && sl.ExpireAt.After(now) && sl.Owner != owner {
+		return sl, false, session.Commit()
+	}
+
+	if !has {
+		sl.Service = service
+		sl.Owner = owner
+		sl.PipelineID = pipelineID
+		sl.Username = username
+		sl.Since = now
+		sl.ExpireAt = now.Add(ttl)
+		if _, err := session.Insert(sl); err != nil {
+			return nil, false, err
+		}
+		return sl, true, session.Commit()
+	}
+
+	// 接管过期锁或者同一持有者续期
+	if sl.Owner != owner {
+		sl.Since = now
+	}
+	sl.Owner = owner
+	sl.PipelineID = pipelineID
+	sl.Username = username
+	sl.ExpireAt = now.Add(ttl)
+	if _, err := session.ID(sl.ID).Cols("owner", "pipeline_id", "username", "since", "expire_at").Update(sl); err != nil {
+		return nil, false, err
+	}
+	return sl, true, session.Commit()
+}
+
+// RenewServiceLock 持有者续期
+func RenewServiceLock(service, owner string, ttl time.Duration) error {
+	sl := new(ServiceLock)
+	sl.ExpireAt = time.Now().Add(ttl)
+	if affected, err := MEngine.Cols("expire_at").Where("service=? and owner=? and expire_at>?",
+		service, owner, time.Now()).Update(sl); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// ReleaseServiceLock 持有者释放锁
+func ReleaseServiceLock(service, owner string) error {
+	if _, err := MEngine.Where("service=? and owner=?", service, owner).Delete(new(ServiceLock)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ForceReleaseServiceLock 强制释放锁, 返回被释放的锁
+func ForceReleaseServiceLock(service string) (*ServiceLock, error) {
+	sl, err := GetServiceLock(service)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := MEngine.ID(sl.ID).Delete(new(ServiceLock)); err != nil {
+		return nil, err
+	}
+	return sl, nil
+}
+
+// CreateLockAudit 记录强制解锁
+func CreateLockAudit(service string, pipelineID int64, username string, since time.Time, operator, reason string) error {
+	audit := new(ServiceLockAudit)
+	audit.Service = service
+	audit.PipelineID = pipelineID
+	audit.Username = username
+	audit.Since = since
+	audit.Operator = operator
+	audit.Reason = reason
+	if _, err := MEngine.Insert(audit); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package migrate
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"xorm.io/xorm"
+)
+
+//go:embed sql
+var files embed.FS
+
+// 迁移文件命名规则: 版本号_名称.up.sql / 版本号_名称.down.sql
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// SchemaMigration 记录已执行的迁移版本
+type SchemaMigration struct {
+	Version   int       `xorm:"int pk"`
+	Name      string    `xorm:"varchar(100) notnull"`
+	AppliedAt time.Time `xorm:"timestamp notnull"`
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load 加载对应数据库驱动的全部迁移, 按版本号升序
+func Load(driver string) ([]Migration, error) {
+	dir := path.Join("sql", driver)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported migration driver: %s", driver)
+	}
+
+	migrations := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := files.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			migrations[version] = m
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	result := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration: %04d_%s missing up file", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// Migrator 基于schema_migration表的版本迁移
+type Migrator struct {
+	engine     *xorm.Engine
+	migrations []Migration
+}
+
+func New(engine *xorm.Engine) (*Migrator, error) {
+	migrations, err := Load(engine.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	if err := engine.Sync2(new(SchemaMigration)); err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		engine:     engine,
+		migrations: migrations,
+	}, nil
+}
+
+// Version 返回当前数据库版本, 未执行过迁移返回0
+func (m *Migrator) Version() (int, error) {
+	sm := new(SchemaMigration)
+	if has, err := m.engine.Desc("version").Get(sm); err != nil {
+		return 0, err
+	} else if !has {
+		return 0, nil
+	}
+	return sm.Version, nil
+}
+
+// Latest 返回最新的迁移版本
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up 执行全部未执行的迁移
+func (m *Migrator) Up() error {
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range m.migrations {
+		if item.Version <= current {
+			continue
+		}
+		if err := m.apply(item, item.Up, true); err != nil {
+			return fmt.Errorf("migrate up %04d_%s failed: %s", item.Version, item.Name, err)
+		}
+		log.Infof("migrate up %04d_%s success", item.Version, item.Name)
+	}
+	return nil
+}
+
+// Down 回退steps个版本
+func (m *Migrator) Down(steps int) error {
+	current, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		item := m.migrations[i]
+		if item.Version > current {
+			continue
+		}
+		if err := m.apply(item, item.Down, false); err != nil {
+			return fmt.Errorf("migrate down %04d_%s failed: %s", item.Version, item.Name, err)
+		}
+		log.Infof("migrate down %04d_%s success", item.Version, item.Name)
+		steps--
+	}
+	return nil
+}
+
+// apply 在同一事务中执行迁移并记录版本
+func (m *Migrator) apply(item Migration, sql string, up bool) error {
+	session := m.engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if sql != "" {
+		if _, err := session.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	if up {
+		sm := &SchemaMigration{Version: item.Version, Name: item.Name, AppliedAt: time.Now()}
+		if _, err := session.Insert(sm); err != nil {
+			return err
+		}
+	} else {
+		if _, err := session.Where("version=?", item.Version).Delete(new(SchemaMigration)); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
@@ -0,0 +1,4 @@
+alter table service add column if not exists lock varchar(100) not null default '';
+
+drop table if exists service_lock_audit;
+drop table if exists service_lock;
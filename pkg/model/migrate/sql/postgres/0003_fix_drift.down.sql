@@ -0,0 +1,2 @@
+alter table pipeline_image drop column if exists update_at;
+alter table pipeline alter column pm type varchar(200);
@@ -0,0 +1,5 @@
+--
+-- 与模型定义保持一致
+--
+alter table pipeline alter column pm type varchar(500);
+alter table pipeline_image add column if not exists update_at timestamp not null default now();
@@ -0,0 +1,15 @@
+--
+-- 服务调度与中断策略: PodDisruptionBudget、topologySpreadConstraints
+--
+create table if not exists service_policy (
+    id serial primary key,
+    service varchar(32) not null unique,             -- 服务名
+    min_available varchar(20) not null default '',   -- PDB最少可用pod数, 例如: 1、50%
+    max_unavailable varchar(20) not null default '', -- PDB最多不可用pod数, 与min_available二选一
+    zone_max_skew int not null default 0,            -- 可用区打散最大偏差, 0表示不按可用区打散
+    zone_hard bool not null default false,           -- 可用区打散不满足时是否拒绝调度
+    node_max_skew int not null default 1,            -- 节点打散最大偏差, 0表示不按节点打散
+    node_hard bool not null default false,           -- 节点打散不满足时是否拒绝调度
+    create_at timestamp not null default now(),
+    update_at timestamp not null default now()
+);
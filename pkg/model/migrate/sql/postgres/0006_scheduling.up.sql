@@ -0,0 +1,16 @@
+--
+-- 调度配置: crontab_id为0时作用于服务的业务deployment, 否则作用于对应的定时任务
+--
+create table if not exists scheduling (
+    id serial primary key,
+    service varchar(32) not null,                    -- 服务名
+    crontab_id int not null default 0,               -- 定时任务ID
+    node_selector text,                              -- 节点标签(json), 为空时使用默认节点池
+    tolerations text,                                -- 污点容忍(json)
+    node_affinity text,                              -- 节点亲和(json)
+    priority_class varchar(253) not null default '', -- PriorityClass名称
+    runtime_class varchar(253) not null default '',  -- RuntimeClass名称
+    create_at timestamp not null default now(),
+    update_at timestamp not null default now(),
+    unique (service, crontab_id)
+);
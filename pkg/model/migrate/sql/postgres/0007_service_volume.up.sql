@@ -0,0 +1,4 @@
+--
+-- 服务存储卷配置(json), 为空时代码、日志使用hostPath
+--
+alter table service add column if not exists volume text default '';
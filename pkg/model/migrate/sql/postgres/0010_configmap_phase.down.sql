@@ -0,0 +1,2 @@
+alter table pipeline drop column if exists config_version;
+alter table configmap_version drop column if exists phase;
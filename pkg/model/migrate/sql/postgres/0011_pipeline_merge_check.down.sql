@@ -0,0 +1,5 @@
+alter table pipeline_update drop column if exists merge_commits;
+alter table pipeline_update drop column if exists merge_behind;
+alter table pipeline_update drop column if exists merge_ahead;
+alter table pipeline_update drop column if exists merge_base;
+alter table pipeline_update drop column if exists merge_status;
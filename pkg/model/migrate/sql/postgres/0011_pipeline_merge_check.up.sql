@@ -0,0 +1,9 @@
+--
+-- 分支合并检查结果: 发布分支相对主干(或上次发布的tag)领先、落后的提交数
+-- merge_status: skip 主干发布不检查, pass 已包含主干, blocked 会丢失主干提交被阻止, override 强制发布
+--
+alter table pipeline_update add column if not exists merge_status varchar(20) not null default '';
+alter table pipeline_update add column if not exists merge_base varchar(100) not null default '';
+alter table pipeline_update add column if not exists merge_ahead int not null default 0;
+alter table pipeline_update add column if not exists merge_behind int not null default 0;
+alter table pipeline_update add column if not exists merge_commits text not null default '';
@@ -0,0 +1,3 @@
+alter table pipeline_image drop column if exists build_log;
+alter table pipeline_update drop column if exists tag_log;
+alter table pipeline_update drop column if exists tag_status;
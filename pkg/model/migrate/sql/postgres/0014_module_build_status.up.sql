@@ -0,0 +1,7 @@
+--
+-- 模块级构建状态及日志: 多模块并发构建时单独记录每个模块的结果, 重试时跳过已成功的模块
+-- tag_status/pipeline_image.status: 0 待构建, 1 构建中, 2 构建成功, 3 构建失败
+--
+alter table pipeline_update add column if not exists tag_status int not null default 0;
+alter table pipeline_update add column if not exists tag_log text not null default '';
+alter table pipeline_image add column if not exists build_log text not null default '';
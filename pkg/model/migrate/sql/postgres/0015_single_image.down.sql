@@ -0,0 +1,2 @@
+alter table pipeline drop column if exists release_image;
+alter table service drop column if exists build_mode;
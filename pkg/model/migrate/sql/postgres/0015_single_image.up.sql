@@ -0,0 +1,6 @@
+--
+-- 单一镜像构建方式: 镜像阶段将服务基础镜像与全部模块代码构建为一个发布镜像, 部署时不再使用init容器拷贝代码
+-- service.build_mode: 空或layer 代码层镜像+init容器(默认), single 单一发布镜像
+--
+alter table service add column if not exists build_mode varchar(20) not null default '';
+alter table pipeline add column if not exists release_image varchar(300) not null default '';
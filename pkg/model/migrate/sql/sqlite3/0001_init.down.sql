@@ -0,0 +1,10 @@
+drop table if exists crontab;
+drop table if exists pipeline_phase;
+drop table if exists pipeline_image;
+drop table if exists pipeline_update;
+drop table if exists pipeline;
+drop table if exists module_binding;
+drop table if exists code_module;
+drop table if exists service;
+drop table if exists namespace;
+drop table if exists cluster;
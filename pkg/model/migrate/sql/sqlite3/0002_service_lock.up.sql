@@ -0,0 +1,28 @@
+--
+-- 服务锁
+--
+create table if not exists service_lock (
+    id integer primary key autoincrement,
+    service varchar(32) not null unique,             -- 服务名
+    owner varchar(100) not null,                     -- 持有者标识(pipeline:上线单ID、user:用户名)
+    pipeline_id int not null default 0,              -- 占锁的上线单
+    username varchar(50) not null default '',        -- 占锁的用户
+    since timestamp not null,                        -- 占锁时间
+    expire_at timestamp not null                     -- 过期时间
+);
+
+--
+-- 服务锁强制解锁记录
+--
+create table if not exists service_lock_audit (
+    id integer primary key autoincrement,
+    service varchar(32) not null,                    -- 服务名
+    pipeline_id int not null default 0,              -- 被解锁的上线单
+    username varchar(50) not null default '',        -- 被解锁的用户
+    since timestamp,                                 -- 原占锁时间
+    operator varchar(50) not null,                   -- 解锁操作人
+    reason text,                                     -- 解锁原因
+    create_at timestamp not null default current_timestamp
+);
+
+alter table service drop column lock;
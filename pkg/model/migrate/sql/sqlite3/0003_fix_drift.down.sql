@@ -0,0 +1 @@
+alter table pipeline_image drop column update_at;
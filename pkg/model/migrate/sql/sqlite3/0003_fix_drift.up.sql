@@ -0,0 +1,4 @@
+--
+-- 与模型定义保持一致(sqlite不限制varchar长度, 只需补充字段; 新增字段不支持非常量默认值)
+--
+alter table pipeline_image add column update_at timestamp;
@@ -0,0 +1,16 @@
+--
+-- 服务自动扩缩容(HPA)配置, 按阶段配置
+--
+create table if not exists service_autoscale (
+    id integer primary key autoincrement,
+    service varchar(32) not null,                    -- 服务名
+    phase varchar(20) not null,                      -- 部署阶段: sandbox、online
+    min_replicas int not null,                       -- 最小副本数
+    max_replicas int not null,                       -- 最大副本数
+    target_cpu int not null default 0,               -- CPU平均利用率(%), 0表示不按CPU扩缩
+    target_mem int not null default 0,               -- 内存平均利用率(%), 0表示不按内存扩缩
+    metrics text,                                    -- 自定义指标(json)
+    create_at timestamp not null default current_timestamp,
+    update_at timestamp not null default current_timestamp,
+    unique (service, phase)
+);
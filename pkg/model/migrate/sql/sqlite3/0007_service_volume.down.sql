@@ -0,0 +1 @@
+alter table service drop column volume;
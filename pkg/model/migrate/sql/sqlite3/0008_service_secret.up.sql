@@ -0,0 +1,12 @@
+--
+-- 服务secret, value为AES-GCM加密后的密文
+--
+create table if not exists service_secret (
+    id integer primary key autoincrement,
+    service varchar(32) not null,                    -- 服务名
+    name varchar(253) not null,                      -- secret的key
+    value text not null,                             -- 加密后的value
+    create_at timestamp not null default current_timestamp,
+    update_at timestamp not null default current_timestamp,
+    unique (service, name)
+);
@@ -0,0 +1,17 @@
+--
+-- configmap发布历史, 每次发布生成一个版本
+--
+create table if not exists configmap_version (
+    id integer primary key autoincrement,
+    service varchar(32) not null,                    -- 服务名
+    version int not null,                            -- 版本号, 按服务递增
+    data text not null,                              -- configmap键值对(json)
+    creator varchar(50) not null default '',         -- 发布人
+    comment varchar(200) not null default '',        -- 备注, 例如回滚来源
+    create_at timestamp not null default current_timestamp,
+    unique (service, version)
+);
+
+-- 已有的configmap作为第一个版本
+insert into configmap_version (service, version, data, comment)
+select name, 1, configmap, 'initial' from service where configmap is not null and configmap <> '';
@@ -0,0 +1,2 @@
+alter table pipeline drop column config_version;
+alter table configmap_version drop column phase;
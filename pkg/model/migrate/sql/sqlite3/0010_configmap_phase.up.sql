@@ -0,0 +1,6 @@
+--
+-- configmap按阶段覆盖: phase为空表示公共配置, 否则为该阶段的覆盖配置
+-- 上线单记录第一次部署时使用的公共配置版本, 后续阶段沿用, 配置随代码从沙盒推进到全量
+--
+alter table configmap_version add column phase varchar(20) not null default '';
+alter table pipeline add column config_version int not null default 0;
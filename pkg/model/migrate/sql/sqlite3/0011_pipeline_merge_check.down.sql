@@ -0,0 +1,5 @@
+alter table pipeline_update drop column merge_commits;
+alter table pipeline_update drop column merge_behind;
+alter table pipeline_update drop column merge_ahead;
+alter table pipeline_update drop column merge_base;
+alter table pipeline_update drop column merge_status;
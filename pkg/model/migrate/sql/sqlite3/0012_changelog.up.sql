@@ -0,0 +1,12 @@
+--
+-- 模块两个tag之间的变更记录缓存, tag不可变, 计算一次后复用
+--
+create table if not exists changelog (
+    id integer primary key autoincrement,
+    code_module varchar(50) not null,                -- 代码模块
+    from_tag varchar(50) not null default '',        -- 上次成功上线的tag, 首次上线为空
+    to_tag varchar(50) not null,                     -- 本次上线的tag
+    content text not null,                           -- 提交列表及diffstat(json)
+    create_at timestamp not null default current_timestamp,
+    unique (code_module, from_tag, to_tag)
+);
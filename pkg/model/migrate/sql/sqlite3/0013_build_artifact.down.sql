@@ -0,0 +1,2 @@
+alter table pipeline_update drop column code_commit;
+drop table if exists build_artifact;
@@ -0,0 +1,17 @@
+--
+-- 编译包缓存: 同一模块、同一提交、同一构建配置的编译包在上线单之间复用
+--
+create table if not exists build_artifact (
+    id integer primary key autoincrement,
+    code_module varchar(50) not null,                -- 代码模块
+    commit_id varchar(64) not null,                  -- 提交(git: sha, svn: r版本号)
+    build_hash varchar(64) not null,                 -- 构建配置的校验和
+    path varchar(255) not null,                      -- 编译包路径
+    size bigint not null default 0,                  -- 编译包大小(字节)
+    use_at timestamp not null default current_timestamp,         -- 最近一次使用时间, 用于过期清理
+    create_at timestamp not null default current_timestamp,
+    unique (code_module, commit_id, build_hash)
+);
+
+-- 上线单中模块打tag时的提交
+alter table pipeline_update add column code_commit varchar(64) not null default '';
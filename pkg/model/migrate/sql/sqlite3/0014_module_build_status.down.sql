@@ -0,0 +1,3 @@
+alter table pipeline_image drop column build_log;
+alter table pipeline_update drop column tag_log;
+alter table pipeline_update drop column tag_status;
@@ -0,0 +1,2 @@
+alter table pipeline drop column release_image;
+alter table service drop column build_mode;
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"nautilus/pkg/util/cm"
+	"nautilus/pkg/util/metrics"
 )
 
 type PipelinePhase struct {
@@ -30,6 +31,14 @@ const (
 	PHFailed             // 执行失败
 )
 
+// PhaseStatusName 阶段状态对应的名称
+var PhaseStatusName = map[int]string{
+	PHWait:    "wait",
+	PHProcess: "process",
+	PHSuccess: "success",
+	PHFailed:  "failed",
+}
+
 // 阶段名称
 const (
 	PHASE_IMAGE   = "image"
@@ -120,21 +129,37 @@ func UpdatePhase(pipelineID int64, kind, name string, status int) error {
 	} else if affected == 0 {
 		return NotFound
 	}
+	observePhase(pipelineID, kind, name, status)
 	return nil
 }
 
 func UpdatePhaseV2(pipelineID int64, kind, name string, status int) error {
 	phase := new(PipelinePhase)
 	phase.Status = status
-	if affected, err := MEngine.Cols("status", "resource_version").Where(
+	if affected, err := MEngine.Cols("status", "update_at").Where(
 		"pipeline_id=? and kind=? and name=?", pipelineID, kind, name).Update(phase); err != nil {
 		return err
 	} else if affected == 0 {
 		return NotFound
 	}
+	observePhase(pipelineID, kind, name, status)
 	return nil
 }
 
+// observePhase 阶段结束时记录阶段耗时
+func observePhase(pipelineID int64, kind, name string, status int) {
+	if !cm.Ini(status, []int{PHSuccess, PHFailed}) {
+		return
+	}
+
+	ph := new(PipelinePhase)
+	if has, err := MEngine.Where("pipeline_id=? and kind=? and name=?",
+		pipelineID, kind, name).Get(ph); err != nil || !has {
+		return
+	}
+	metrics.PhaseDuration.WithLabelValues(kind, name, PhaseStatusName[status]).Observe(metrics.Since(ph.CreateAt))
+}
+
 func RealtimeLog(pipelineID int64, kind, name, msg string) error {
 	phase := new(PipelinePhase)
 	if has, err := MEngine.Where("pipeline_id=? and kind=? and name=?",
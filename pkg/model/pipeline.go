@@ -6,23 +6,30 @@
 package model
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"xorm.io/xorm"
+
+	"nautilus/pkg/util/metrics"
 )
 
 type Pipeline struct {
-	ID       int64
-	Service  string    `xorm:"varchar(32) notnull"`
-	Name     string    `xorm:"varchar(100) notnull"`
-	Summary  string    `xorm:"text notnull"`
-	Creator  string    `xorm:"varchar(50) notnull"`
-	RD       string    `xorm:"varchar(500) notnull"`
-	QA       string    `xorm:"varchar(200)"`
-	PM       string    `xorm:"varchar(500) notnull"`
-	Status   int       `xorm:"int notnull"`
-	CreateAt time.Time `xorm:"timestamp notnull created"`
-	UpdateAt time.Time `xorm:"timestamp notnull updated"`
+	ID            int64
+	Service       string    `xorm:"varchar(32) notnull"`
+	Name          string    `xorm:"varchar(100) notnull"`
+	Summary       string    `xorm:"text notnull"`
+	Creator       string    `xorm:"varchar(50) notnull"`
+	RD            string    `xorm:"varchar(500) notnull"`
+	QA            string    `xorm:"varchar(200)"`
+	PM            string    `xorm:"varchar(500) notnull"`
+	Status        int       `xorm:"int notnull"`
+	ConfigVersion int       `xorm:"int notnull"`          // 第一次部署时使用的公共配置版本, 后续阶段沿用
+	ReleaseImage  string    `xorm:"varchar(300) notnull"` // single构建方式的发布镜像(地址:tag)
+	CreateAt      time.Time `xorm:"timestamp notnull created"`
+	UpdateAt      time.Time `xorm:"timestamp notnull updated"`
 }
 
 type PipelineUpdate struct {
@@ -31,10 +38,26 @@ type PipelineUpdate struct {
 	CodeModule   string    `xorm:"varchar(50) notnull"`
 	DeployBranch string    `xorm:"varchar(20)"`
 	CodeTag      string    `xorm:"varchar(50)"`
+	CodeCommit   string    `xorm:"varchar(64) notnull"` // 打tag时的提交
 	CodePkg      string    `xorm:"varchar(100)"`
+	MergeStatus  string    `xorm:"varchar(20) notnull"`  // 分支合并检查结果
+	MergeBase    string    `xorm:"varchar(100) notnull"` // 对比的基准: 主干或上次发布的tag
+	MergeAhead   int       `xorm:"int notnull"`          // 发布分支领先基准的提交数
+	MergeBehind  int       `xorm:"int notnull"`          // 发布分支落后基准的提交数, 不为0时会丢失基准上的提交
+	MergeCommits string    `xorm:"text notnull"`         // 落后的提交, 每行一个
+	TagStatus    int       `xorm:"int notnull"`          // 打tag、编译状态, 取值同镜像构建状态PIWait~PIFailed
+	TagLog       string    `xorm:"text notnull"`         // 打tag、编译的输出
 	CreateAt     time.Time `xorm:"timestamp notnull created"`
 }
 
+// 分支合并检查结果
+const (
+	MergeSkip     = "skip"     // 主干发布, 不检查
+	MergePass     = "pass"     // 发布分支已包含基准的全部提交
+	MergeBlocked  = "blocked"  // 会丢失基准上的提交, 阻止发布
+	MergeOverride = "override" // 会丢失基准上的提交, 强制发布
+)
+
 const (
 	PLWait            int = iota // 待上线
 	PLProcess                    // 上线中
@@ -46,6 +69,18 @@ const (
 	PLTerminate                  // 流程终止
 )
 
+// PipelineStatusName pipeline状态对应的名称
+var PipelineStatusName = map[int]string{
+	PLWait:            "wait",
+	PLProcess:         "process",
+	PLSuccess:         "success",
+	PLFailed:          "failed",
+	PLRollbacking:     "rollbacking",
+	PLRollbackSuccess: "rollback_success",
+	PLRollbackFailed:  "rollback_failed",
+	PLTerminate:       "terminate",
+}
+
 func GetPipeline(pipelineID int64) (*Pipeline, error) {
 	pipeline := new(Pipeline)
 	if has, err := SEngine.ID(pipelineID).Get(pipeline); err != nil {
@@ -79,6 +114,33 @@ func GetServiceLastSuccessPipeline(service string) (*Pipeline, error) {
 	return pipeline, nil
 }
 
+// ActivePipelineError 服务有上线中或回滚中的pipeline, 不能创建新的pipeline
+type ActivePipelineError struct {
+	Pipeline *Pipeline
+}
+
+func (e *ActivePipelineError) Error() string {
+	return fmt.Sprintf("service: %s has active pipeline: %d", e.Pipeline.Service, e.Pipeline.ID)
+}
+
+// GetActivePipeline 服务上线中或回滚中的pipeline
+func GetActivePipeline(service string) (*Pipeline, error) {
+	session := SEngine.NewSession()
+	defer session.Close()
+	return getActivePipeline(session, service)
+}
+
+func getActivePipeline(session *xorm.Session, service string) (*Pipeline, error) {
+	pipeline := new(Pipeline)
+	if has, err := session.Where("service = ?", service).In("status", PLProcess, PLRollbacking).
+		Desc("id").Get(pipeline); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return pipeline, nil
+}
+
 // FindPipelineInfo 根据service返回pipeline相关信息
 func FindPipelineInfo(service string) ([]Pipeline, error) {
 	pList := make([]Pipeline, 0)
@@ -89,6 +151,31 @@ func FindPipelineInfo(service string) ([]Pipeline, error) {
 	return pList, nil
 }
 
+// CountPipelines 按服务、状态统计pipeline数量
+func CountPipelines() ([]metrics.PipelineCount, error) {
+	type result struct {
+		Service string
+		Status  int
+		Total   int64
+	}
+
+	rows := make([]result, 0)
+	if err := SEngine.Table("pipeline").Select("service, status, count(*) as total").
+		GroupBy("service, status").Find(&rows); err != nil {
+		return nil, err
+	}
+
+	counts := make([]metrics.PipelineCount, 0, len(rows))
+	for _, row := range rows {
+		counts = append(counts, metrics.PipelineCount{
+			Service: row.Service,
+			Status:  PipelineStatusName[row.Status],
+			Total:   row.Total,
+		})
+	}
+	return counts, nil
+}
+
 func FindUpdateInfo(pipelineID int64) ([]PipelineUpdate, error) {
 	uqList := make([]PipelineUpdate, 0)
 	if err := SEngine.Where("pipeline_id = ?", pipelineID).Find(&uqList); err != nil {
@@ -97,12 +184,44 @@ func FindUpdateInfo(pipelineID int64) ([]PipelineUpdate, error) {
 	return uqList, nil
 }
 
-func CreatePipeline(name, summary, creator, rd, qa, pm, serviceName string, moduleInfoList []map[string]string) error {
+// FindPreviousTags 一次查询服务在指定上线单之前成功上线的各模块最近一次的tag, 没有成功上线过的模块不返回
+func FindPreviousTags(service string, pipelineID int64, modules []string) (map[string]string, error) {
+	updates := make([]PipelineUpdate, 0)
+	if err := SEngine.Table("pipeline_update").Alias("pu").
+		Join("INNER", []string{"pipeline", "p"}, "p.id = pu.pipeline_id").
+		Where("p.service = ? AND p.status = ? AND p.id < ? AND pu.code_tag <> ''", service, PLSuccess, pipelineID).
+		In("pu.code_module", modules).Desc("pu.pipeline_id").Select("pu.*").Find(&updates); err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, update := range updates {
+		if _, ok := tags[update.CodeModule]; !ok {
+			tags[update.CodeModule] = update.CodeTag
+		}
+	}
+	return tags, nil
+}
+
+// CreatePipeline 创建pipeline及各模块的上线分支, 服务有上线中、回滚中的pipeline时返回*ActivePipelineError
+func CreatePipeline(name, summary, creator, rd, qa, pm, serviceName string, moduleInfoList []map[string]string) (int64, error) {
 	session := MEngine.NewSession()
 	defer session.Close()
 
 	if err := session.Begin(); err != nil {
-		return err
+		return 0, err
+	}
+
+	// 与占用服务锁使用同一advisory锁, 在事务内检查服务没有上线中、回滚中的pipeline
+	if IsPostgres() {
+		if _, err := session.Exec("select pg_advisory_xact_lock(hashtext(?))", "service_lock:"+serviceName); err != nil {
+			return 0, err
+		}
+	}
+	if active, err := getActivePipeline(session, serviceName); err == nil {
+		return 0, &ActivePipelineError{Pipeline: active}
+	} else if !errors.Is(err, NotFound) {
+		return 0, err
 	}
 
 	pipeline := new(Pipeline)
@@ -114,7 +233,7 @@ func CreatePipeline(name, summary, creator, rd, qa, pm, serviceName string, modu
 	pipeline.PM = pm
 	pipeline.Service = serviceName
 	if _, err := session.Insert(pipeline); err != nil {
-		return err
+		return 0, err
 	}
 	log.Infof("create pipeline success. get pipeline id: %d", pipeline.ID)
 
@@ -127,20 +246,23 @@ func CreatePipeline(name, summary, creator, rd, qa, pm, serviceName string, modu
 		pipelineUpdate.CodeModule = moduleName
 		pipelineUpdate.DeployBranch = deployBranch
 		if _, err := session.Insert(pipelineUpdate); err != nil {
-			return err
+			return 0, err
 		}
 		log.Infof("create update info success. by code_module: %s branch: %s", moduleName, deployBranch)
 	}
-	return session.Commit()
+	if err := session.Commit(); err != nil {
+		return 0, err
+	}
+	return pipeline.ID, nil
 }
 
-func SetLock(serviceID int64, lock string) error {
-	service := new(Service)
-	service.Lock = lock
-	if _, err := MEngine.Cols("lock").ID(serviceID).Update(service); err != nil {
-		return err
-	}
-	return nil
+// HasWaitPipeline 服务是否有待上线的pipeline包含指定模块、分支. Exist生成的sql不带表别名, 这里使用表名
+func HasWaitPipeline(service, module, branch string) (bool, error) {
+	return SEngine.Table("pipeline").
+		Join("INNER", "pipeline_update", "pipeline.id = pipeline_update.pipeline_id").
+		Where("pipeline.service = ? AND pipeline.status = ? AND pipeline_update.code_module = ? AND pipeline_update.deploy_branch = ?",
+			service, PLWait, module, branch).
+		Exist()
 }
 
 func UpdateTag(pipelineID int64, moduleName, codeTag string) error {
@@ -171,6 +293,41 @@ func UpdateTag(pipelineID int64, moduleName, codeTag string) error {
 	return session.Commit()
 }
 
+// UpdateCommit 记录模块打tag使用的提交
+func UpdateCommit(pipelineID int64, moduleName, commitID string) error {
+	pu := &PipelineUpdate{CodeCommit: commitID}
+	if affected, err := MEngine.Where("pipeline_id=? and code_module=?", pipelineID, moduleName).
+		Cols("code_commit").Update(pu); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// UpdateTagStatus 记录模块打tag、编译的状态及输出
+func UpdateTagStatus(pipelineID int64, moduleName string, status int, output string) error {
+	pu := &PipelineUpdate{TagStatus: status, TagLog: output}
+	if affected, err := MEngine.Where("pipeline_id=? and code_module=?", pipelineID, moduleName).
+		Cols("tag_status", "tag_log").Update(pu); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+// UpdateMergeCheck 记录模块的分支合并检查结果
+func UpdateMergeCheck(pipelineID int64, moduleName string, check *PipelineUpdate) error {
+	if affected, err := MEngine.Where("pipeline_id=? and code_module=?", pipelineID, moduleName).
+		Cols("merge_status", "merge_base", "merge_ahead", "merge_behind", "merge_commits").Update(check); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
 func UpdatePkg(pipelineID int64, moduleName, codePkg string) error {
 	pu := new(PipelineUpdate)
 	pu.CodePkg = codePkg
@@ -194,6 +351,29 @@ func UpdateStatus(pipelineID int64, status int) error {
 	return nil
 }
 
+// UpdateConfigVersion 记录上线单使用的公共配置版本
+func UpdateConfigVersion(pipelineID int64, version int) error {
+	pipeline := new(Pipeline)
+	pipeline.ConfigVersion = version
+	if affected, err := MEngine.Cols("config_version").ID(pipelineID).Update(pipeline); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+func UpdateReleaseImage(pipelineID int64, image string) error {
+	pipeline := new(Pipeline)
+	pipeline.ReleaseImage = image
+	if affected, err := MEngine.Cols("release_image").ID(pipelineID).Update(pipeline); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
 func UpdateGroup(pipelineID, serviceID int64, onlineGroup, deployGroup string, status int) error {
 	session := MEngine.NewSession()
 	defer session.Close()
@@ -213,8 +393,7 @@ func UpdateGroup(pipelineID, serviceID int64, onlineGroup, deployGroup string, s
 	service := new(Service)
 	service.OnlineGroup = onlineGroup
 	service.DeployGroup = deployGroup
-	service.Lock = ""
-	if affected, err := session.ID(serviceID).Cols("online_group", "deploy_group", "lock").Update(service); err != nil {
+	if affected, err := session.ID(serviceID).Cols("online_group", "deploy_group").Update(service); err != nil {
 		return err
 	} else if affected == 0 {
 		return NotFound
@@ -0,0 +1,64 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// ServicePolicy 服务调度与中断策略
+type ServicePolicy struct {
+	ID             int64
+	Service        string    `xorm:"varchar(32) notnull unique"`
+	MinAvailable   string    `xorm:"varchar(20) notnull"` // PDB最少可用pod数, 例如: 1、50%
+	MaxUnavailable string    `xorm:"varchar(20) notnull"` // PDB最多不可用pod数, 与MinAvailable二选一
+	ZoneMaxSkew    int32     `xorm:"int notnull"`         // 可用区打散最大偏差, 0表示不按可用区打散
+	ZoneHard       bool      `xorm:"bool notnull"`        // 可用区打散不满足时是否拒绝调度
+	NodeMaxSkew    int32     `xorm:"int notnull"`         // 节点打散最大偏差, 0表示不按节点打散
+	NodeHard       bool      `xorm:"bool notnull"`        // 节点打散不满足时是否拒绝调度
+	CreateAt       time.Time `xorm:"timestamp notnull created"`
+	UpdateAt       time.Time `xorm:"timestamp notnull updated"`
+}
+
+// GetPolicy 获取服务的调度与中断策略, 未配置返回NotFound
+func GetPolicy(service string) (*ServicePolicy, error) {
+	policy := new(ServicePolicy)
+	if has, err := SEngine.Where("service=?", service).Get(policy); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return policy, nil
+}
+
+// SavePolicy 创建或更新服务的调度与中断策略
+func SavePolicy(policy *ServicePolicy) error {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	stored := new(ServicePolicy)
+	has, err := session.Where("service=?", policy.Service).Get(stored)
+	if err != nil {
+		return err
+	}
+
+	if has {
+		cols := []string{"min_available", "max_unavailable", "zone_max_skew", "zone_hard", "node_max_skew", "node_hard"}
+		if _, err := session.ID(stored.ID).Cols(cols...).Update(policy); err != nil {
+			return err
+		}
+		policy.ID = stored.ID
+	} else {
+		if _, err := session.Insert(policy); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
@@ -0,0 +1,70 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// Scheduling 调度配置, CrontabID为0时作用于服务的业务deployment, 否则作用于对应的定时任务
+type Scheduling struct {
+	ID            int64
+	Service       string    `xorm:"varchar(32) notnull unique(service_crontab)"`
+	CrontabID     int64     `xorm:"int notnull unique(service_crontab)"`
+	NodeSelector  string    `xorm:"text"`                 // 节点标签(json), 为空时使用默认节点池
+	Tolerations   string    `xorm:"text"`                 // 污点容忍(json)
+	NodeAffinity  string    `xorm:"text"`                 // 节点亲和(json)
+	PriorityClass string    `xorm:"varchar(253) notnull"` // PriorityClass名称
+	RuntimeClass  string    `xorm:"varchar(253) notnull"` // RuntimeClass名称
+	CreateAt      time.Time `xorm:"timestamp notnull created"`
+	UpdateAt      time.Time `xorm:"timestamp notnull updated"`
+}
+
+// GetScheduling 获取服务或定时任务的调度配置, 未配置返回NotFound
+func GetScheduling(service string, crontabID int64) (*Scheduling, error) {
+	scheduling := new(Scheduling)
+	if has, err := SEngine.Where("service=? and crontab_id=?", service, crontabID).Get(scheduling); err != nil {
+		return nil, err
+	} else if !has {
+		return nil, NotFound
+	}
+	return scheduling, nil
+}
+
+// SaveScheduling 创建或更新服务或定时任务的调度配置
+func SaveScheduling(scheduling *Scheduling) error {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	stored := new(Scheduling)
+	has, err := session.Where("service=? and crontab_id=?", scheduling.Service, scheduling.CrontabID).Get(stored)
+	if err != nil {
+		return err
+	}
+
+	if has {
+		cols := []string{"node_selector", "tolerations", "node_affinity", "priority_class", "runtime_class"}
+		if _, err := session.ID(stored.ID).Cols(cols...).Update(scheduling); err != nil {
+			return err
+		}
+		scheduling.ID = stored.ID
+	} else {
+		if _, err := session.Insert(scheduling); err != nil {
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// DeleteScheduling 删除服务或定时任务的调度配置
+func DeleteScheduling(service string, crontabID int64) error {
+	_, err := MEngine.Where("service=? and crontab_id=?", service, crontabID).Delete(new(Scheduling))
+	return err
+}
@@ -0,0 +1,197 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+
+	"nautilus/pkg/model/migrate"
+)
+
+// 使用空库执行全部迁移后, 校验模型与表结构一致
+func TestSchemaMatchesModels(t *testing.T) {
+	t.Run("sqlite3", func(t *testing.T) {
+		testSchema(t, "sqlite3", "file:schema_test?mode=memory&cache=shared")
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("NAUTILUS_TEST_POSTGRES")
+		if dsn == "" {
+			t.Skip("NAUTILUS_TEST_POSTGRES not set")
+		}
+		testSchema(t, "postgres", dsn)
+	})
+}
+
+// postgres需要外部数据库, 不依赖数据库静态比较两套迁移, 每个版本执行后的表、字段必须一致
+func TestMigrationParity(t *testing.T) {
+	postgres, err := migrate.Load("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := migrate.Load("sqlite3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("postgres migrations: %d, sqlite3 migrations: %d", len(postgres), len(sqlite))
+	}
+
+	pgSchema, liteSchema := make(map[string]map[string]bool), make(map[string]map[string]bool)
+	for i := range postgres {
+		pg, lite := postgres[i], sqlite[i]
+		if pg.Version != lite.Version || pg.Name != lite.Name {
+			t.Fatalf("migration: %04d_%s mismatch sqlite3: %04d_%s", pg.Version, pg.Name, lite.Version, lite.Name)
+		}
+		if err := parseSchema(pgSchema, pg.Up); err != nil {
+			t.Fatalf("postgres migration: %04d_%s %s", pg.Version, pg.Name, err)
+		}
+		if err := parseSchema(liteSchema, lite.Up); err != nil {
+			t.Fatalf("sqlite3 migration: %04d_%s %s", lite.Version, lite.Name, err)
+		}
+		if !reflect.DeepEqual(pgSchema, liteSchema) {
+			t.Fatalf("migration: %04d_%s schema mismatch\npostgres: %v\nsqlite3: %v", pg.Version, pg.Name, pgSchema, liteSchema)
+		}
+	}
+}
+
+var (
+	sqlComment  = regexp.MustCompile(`--[^\n]*`)
+	createTable = regexp.MustCompile(`(?s)^create table (?:if not exists )?(\w+) \((.*)\)$`)
+	dropTable   = regexp.MustCompile(`^drop table (?:if exists )?(\w+)$`)
+	addColumn   = regexp.MustCompile(`^alter table (\w+) add column (?:if not exists )?(\w+)`)
+	dropColumn  = regexp.MustCompile(`^alter table (\w+) drop column (?:if exists )?(\w+)`)
+	// 表约束, 不是字段
+	tableConstraint = regexp.MustCompile(`^(primary key|unique|foreign key|constraint|check)\b`)
+)
+
+// parseSchema 按迁移语句更新表、字段, 只处理建表、删表、增删字段, 其他语句(索引、数据、字段类型)不影响表结构
+func parseSchema(schema map[string]map[string]bool, sql string) error {
+	sql = strings.ToLower(sqlComment.ReplaceAllString(sql, ""))
+	for _, stmt := range strings.Split(sql, ";") {
+		stmt = strings.Join(strings.Fields(stmt), " ")
+		if match := createTable.FindStringSubmatch(stmt); match != nil {
+			cols := make(map[string]bool)
+			depth, start := 0, 0
+			body := match[2] + ","
+			for i, c := range body {
+				switch c {
+				case '(':
+					depth++
+				case ')':
+					depth--
+				case ',':
+					if depth > 0 {
+						continue
+					}
+					def := strings.TrimSpace(body[start:i])
+					start = i + 1
+					if def == "" || tableConstraint.MatchString(def) {
+						continue
+					}
+					cols[strings.Fields(def)[0]] = true
+				}
+			}
+			schema[match[1]] = cols
+		} else if match := dropTable.FindStringSubmatch(stmt); match != nil {
+			delete(schema, match[1])
+		} else if match := addColumn.FindStringSubmatch(stmt); match != nil {
+			if schema[match[1]] == nil {
+				return fmt.Errorf("add column: %s to unknown table: %s", match[2], match[1])
+			}
+			schema[match[1]][match[2]] = true
+		} else if match := dropColumn.FindStringSubmatch(stmt); match != nil {
+			if schema[match[1]] == nil {
+				return fmt.Errorf("drop column: %s from unknown table: %s", match[2], match[1])
+			}
+			delete(schema[match[1]], match[2])
+		}
+	}
+	return nil
+}
+
+func testSchema(t *testing.T, driver, dsn string) {
+	engine, err := xorm.NewEngine(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	engine.SetMapper(names.GonicMapper{})
+
+	m, err := migrate.New(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	checkSchema(t, engine)
+
+	// down之后可以重新up
+	if err := m.Down(m.Latest()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := m.Version(); err != nil || version != m.Latest() {
+		t.Fatalf("schema version: %d latest: %d error: %v", version, m.Latest(), err)
+	}
+}
+
+func checkSchema(t *testing.T, engine *xorm.Engine) {
+	for _, bean := range Tables() {
+		info, err := engine.TableInfo(bean)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dbCols, err := tableColumns(engine, info.Name)
+		if err != nil {
+			t.Errorf("table: %s not found in migrated schema: %s", info.Name, err)
+			continue
+		}
+
+		for _, col := range info.ColumnsSeq() {
+			if !dbCols[col] {
+				t.Errorf("table: %s missing column: %s", info.Name, col)
+			}
+		}
+		for col := range dbCols {
+			if info.GetColumn(col) == nil {
+				t.Errorf("table: %s column: %s not defined in model", info.Name, col)
+			}
+		}
+	}
+}
+
+// tableColumns 通过空查询获取表的全部字段, 兼容postgres、sqlite
+func tableColumns(engine *xorm.Engine, table string) (map[string]bool, error) {
+	rows, err := engine.DB().Query(fmt.Sprintf("select * from %s where 1 = 0", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]bool)
+	for _, name := range names {
+		cols[name] = true
+	}
+	return cols, nil
+}
@@ -0,0 +1,72 @@
+// Copyright @ 2022 OPS Inc.
+//
+// Author: Jinlong Yang
+//
+
+package model
+
+import (
+	"time"
+)
+
+// ServiceSecret 服务的secret, Value为加密后的密文
+type ServiceSecret struct {
+	ID       int64
+	Service  string    `xorm:"varchar(32) notnull unique(service_name)"`
+	Name     string    `xorm:"varchar(253) notnull unique(service_name)"`
+	Value    string    `xorm:"text notnull"`
+	CreateAt time.Time `xorm:"timestamp notnull created"`
+	UpdateAt time.Time `xorm:"timestamp notnull updated"`
+}
+
+// FindSecrets 获取服务的全部secret. 保存、删除后立即以查询结果发布, 从主库读取, 避免从库延迟丢失刚写入的key
+func FindSecrets(service string) ([]ServiceSecret, error) {
+	secrets := make([]ServiceSecret, 0)
+	if err := MEngine.Where("service=?", service).Asc("name").Find(&secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// SaveSecrets 创建或更新服务的secret, 未传入的key保持不变
+func SaveSecrets(service string, secrets []ServiceSecret) error {
+	session := MEngine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	for i := range secrets {
+		secret := &secrets[i]
+		secret.Service = service
+
+		stored := new(ServiceSecret)
+		has, err := session.Where("service=? and name=?", service, secret.Name).Get(stored)
+		if err != nil {
+			return err
+		}
+
+		if has {
+			if _, err := session.ID(stored.ID).Cols("value").Update(secret); err != nil {
+				return err
+			}
+			secret.ID = stored.ID
+		} else {
+			if _, err := session.Insert(secret); err != nil {
+				return err
+			}
+		}
+	}
+	return session.Commit()
+}
+
+// DeleteSecrets 删除服务指定的secret
+func DeleteSecrets(service string, names []string) error {
+	if affected, err := MEngine.Where("service=?", service).In("name", names).Delete(new(ServiceSecret)); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
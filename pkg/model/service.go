@@ -22,19 +22,26 @@ type Service struct {
 	QuotaMaxMem   string    `xorm:"varchar(20)"`
 	Replicas      int32     `xorm:"int"`
 	Configmap     string    `xorm:"text"`
+	Volume        string    `xorm:"text"` // 存储卷配置(json), 为空时代码、日志使用hostPath
 	ReserveTime   int       `xorm:"int"`
 	Port          int       `xorm:"int"`
 	ContainerPort int       `xorm:"int"`
 	OnlineGroup   string    `xorm:"varchar(20) notnull"`
 	DeployGroup   string    `xorm:"varchar(20) notnull"`
 	MultiPhase    bool      `xorm:"bool"`
-	Lock          string    `xorm:"varchar(100) notnull"`
+	BuildMode     string    `xorm:"varchar(20) notnull"` // 构建方式, 为空时同layer
 	RD            string    `xorm:"varchar(50) notnull"`
 	OP            string    `xorm:"varchar(50) notnull"`
 	CreateAt      time.Time `xorm:"timestamp notnull created"`
 	UpdateAt      time.Time `xorm:"timestamp notnull updated"`
 }
 
+// 服务构建方式
+const (
+	BuildModeLayer  = "layer"  // 各模块构建code层镜像, 部署时由init容器拷贝代码
+	BuildModeSingle = "single" // 镜像阶段将服务基础镜像与全部模块代码构建为一个发布镜像
+)
+
 type CodeModule struct {
 	ID       int64
 	Name     string    `xorm:"varchar(50) notnull"`
@@ -105,6 +112,22 @@ func GetCodeModuleInfoByID(moduleID int64) (*CodeModule, error) {
 	return codeModule, nil
 }
 
+func FindServices() ([]Service, error) {
+	services := make([]Service, 0)
+	if err := SEngine.Asc("id").Find(&services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+func FindCodeModules() ([]CodeModule, error) {
+	modules := make([]CodeModule, 0)
+	if err := SEngine.Asc("id").Find(&modules); err != nil {
+		return nil, err
+	}
+	return modules, nil
+}
+
 func FindServiceCodeModules(service string) ([]BindingUnionQuery, error) {
 	bindings := make([]BindingUnionQuery, 0)
 	if err := BindingSession().Where("s.name = ?", service).Find(&bindings); err != nil {
@@ -113,10 +136,21 @@ func FindServiceCodeModules(service string) ([]BindingUnionQuery, error) {
 	return bindings, nil
 }
 
-func UpdateConfigMap(name string, pair string) error {
+func UpdateBuildMode(name string, mode string) error {
+	service := new(Service)
+	service.BuildMode = mode
+	if affected, err := MEngine.Where("name = ?", name).Cols("build_mode").Update(service); err != nil {
+		return err
+	} else if affected == 0 {
+		return NotFound
+	}
+	return nil
+}
+
+func UpdateVolume(name string, volume string) error {
 	service := new(Service)
-	service.Configmap = pair
-	if affected, err := MEngine.Where("name = ?", name).Cols("configmap").Update(service); err != nil {
+	service.Volume = volume
+	if affected, err := MEngine.Where("name = ?", name).Cols("volume").Update(service); err != nil {
 		return err
 	} else if affected == 0 {
 		return NotFound
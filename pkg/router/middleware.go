@@ -6,7 +6,12 @@
 package router
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/gin-gonic/gin"
+
+	"nautilus/pkg/util/metrics"
 )
 
 // DefaultAuth 默认授权
@@ -18,3 +23,16 @@ func DefaultAuth(c *gin.Context) {
 func UserAuth(c *gin.Context) {
 	c.Next()
 }
+
+// Metrics 记录接口请求耗时
+func Metrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unknown"
+	}
+	status := strconv.Itoa(c.Writer.Status())
+	metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(metrics.Since(start))
+}
@@ -11,19 +11,37 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"nautilus/pkg/controller"
+	"nautilus/pkg/util/health"
+	"nautilus/pkg/util/metrics"
 )
 
 func URLs(r *gin.Engine) {
+	r.Use(Metrics)
+
 	/* web ui */
 	r.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "show front ui.")
 
 	})
 
+	// 监控指标、健康检查、构建信息
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.GET("/healthz", gin.WrapH(health.Liveness()))
+	r.GET("/readyz", gin.WrapH(health.Readiness()))
+	r.GET("/version", gin.WrapF(health.VersionHandler))
+
 	// 上线单
 	pipeline := r.Group("v1/pipeline", UserAuth)
 	{
 		pipeline.POST("/create", controller.CreatePipeline)
+		pipeline.GET("/query", controller.QueryPipeline)
+		pipeline.GET("/:id/changelog", controller.Changelog)
+	}
+
+	// 代码仓库webhook, 通过签名校验
+	hook := r.Group("v1/hook", DefaultAuth)
+	{
+		hook.POST("/git", controller.GitHook)
 	}
 
 	// 上线流程
@@ -31,14 +49,49 @@ func URLs(r *gin.Engine) {
 	{
 		// 发布流程
 		deploy.POST("/tag", controller.BuildTag)
+		deploy.POST("/tag/retry", controller.RetryTag)
 		deploy.GET("/tag", controller.ReceiveTag)
 		deploy.GET("/pkg", controller.ReceivePkg)
+		deploy.POST("/merge", controller.ReceiveMerge)
 		deploy.POST("/image/create", controller.BuildImage)
+		deploy.POST("/image/retry", controller.RetryImage)
 		deploy.GET("/image/update", controller.UpdateImage)
+		deploy.GET("/image/release", controller.UpdateRelease)
 		deploy.POST("/configmap", controller.ConfigMap)
 		deploy.POST("/service", controller.Service)
 		deploy.POST("/do", controller.Deploy)
 		deploy.POST("/finish", controller.Finish)
+		deploy.POST("/fail", controller.Fail)
+		deploy.POST("/terminate", controller.Terminate)
+	}
+
+	// 构建方式
+	build := r.Group("v1/build", UserAuth)
+	{
+		build.POST("/mode", controller.SetBuildMode)
+	}
+
+	// 编译包缓存
+	artifact := r.Group("v1/artifact", UserAuth)
+	{
+		artifact.GET("/query", controller.QueryArtifact)
+		artifact.POST("/clean", controller.CleanArtifact)
+	}
+
+	// 镜像仓库
+	reg := r.Group("v1/registry", UserAuth)
+	{
+		reg.GET("/tags", controller.QueryImageTags)
+		reg.POST("/clean", controller.CleanImages)
+	}
+
+	// configmap版本
+	configmap := r.Group("v1/configmap", UserAuth)
+	{
+		configmap.GET("/versions", controller.ConfigMapVersions)
+		configmap.GET("/diff", controller.ConfigMapDiff)
+		configmap.POST("/rollback", controller.ConfigMapRollback)
+		configmap.POST("/apply", controller.ConfigMapApply)
 	}
 
 	// 回滚流程
@@ -48,6 +101,50 @@ func URLs(r *gin.Engine) {
 		rollback.POST("/do", controller.Rollback)
 	}
 
+	// 服务锁
+	lock := r.Group("v1/lock", UserAuth)
+	{
+		lock.GET("/query", controller.QueryLock)
+		lock.POST("/unlock", controller.ForceUnlock)
+	}
+
+	// 自动扩缩容
+	autoscale := r.Group("v1/autoscale", UserAuth)
+	{
+		autoscale.GET("/query", controller.QueryAutoscale)
+		autoscale.POST("/set", controller.SetAutoscale)
+		autoscale.POST("/delete", controller.DeleteAutoscale)
+	}
+
+	// 调度与中断策略
+	policy := r.Group("v1/policy", UserAuth)
+	{
+		policy.GET("/query", controller.QueryPolicy)
+		policy.POST("/set", controller.SetPolicy)
+	}
+
+	// 节点池与调度
+	scheduling := r.Group("v1/scheduling", UserAuth)
+	{
+		scheduling.GET("/query", controller.QueryScheduling)
+		scheduling.POST("/set", controller.SetScheduling)
+	}
+
+	// 密钥
+	secret := r.Group("v1/secret", UserAuth)
+	{
+		secret.GET("/query", controller.QuerySecret)
+		secret.POST("/set", controller.SetSecret)
+		secret.POST("/delete", controller.DeleteSecret)
+	}
+
+	// 存储卷
+	volume := r.Group("v1/volume", UserAuth)
+	{
+		volume.GET("/query", controller.QueryVolume)
+		volume.POST("/set", controller.SetVolume)
+	}
+
 	// 定时任务
 	cron := r.Group("v1/cronjob", UserAuth)
 	{
@@ -0,0 +1,440 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package hook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/service/pipeline"
+	"nautilus/pkg/util/cm"
+)
+
+const (
+	DefaultCreator = "webhook" // 未配置hook.creator时的上线单创建人
+	maxNameLength  = 100       // 与pipeline.name字段长度一致
+)
+
+// Event 推送或合并事件, 各平台的webhook统一转换为该结构
+type Event struct {
+	Platform string   // gitlab、gitea、github
+	Repos    []string // 仓库的各种地址(http、ssh、web)
+	Branch   string   // 推送或合并的目标分支
+	Commit   string   // 分支最新提交
+	User     string   // 推送或合并人
+	Title    string   // 提交信息或合并请求标题
+}
+
+// Created webhook创建的上线单, 创建失败时(例如服务有上线中的上线单)pipeline_id为0并记录原因
+type Created struct {
+	PipelineID int64  `json:"pipeline_id"`
+	Service    string `json:"service"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Git 处理代码仓库的推送、合并webhook, 为绑定了仓库模块的每个服务创建上线单, 单个服务创建失败不影响其他服务.
+// 非发布分支、非合并完成的事件忽略, 返回空列表.
+func Git(header http.Header, body []byte) ([]Created, error) {
+	cfg := config.Config().Hook
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf(config.HOOK_NOT_CONFIGURED)
+	}
+	if !verifySignature(header, body, cfg.Secret) {
+		return nil, fmt.Errorf(config.HOOK_SIGNATURE_INVALID)
+	}
+
+	event, err := parseEvent(header, body)
+	if err != nil {
+		return nil, err
+	}
+	created := make([]Created, 0)
+	if event == nil {
+		return created, nil
+	}
+	if !cm.In(event.Branch, cfg.Branches) {
+		log.Infof("webhook %s repo: %v branch: %s is not release branch, skip", event.Platform, event.Repos, event.Branch)
+		return created, nil
+	}
+
+	bindings, err := findBindings(event.Repos)
+	if err != nil {
+		return nil, fmt.Errorf(config.HOOK_QUERY_ERROR, firstNonEmpty(event.Repos...), err)
+	}
+
+	creator := cfg.Creator
+	if creator == "" {
+		creator = DefaultCreator
+	}
+	name, summary := pipelineName(event), event.Title
+	if summary == "" {
+		summary = name
+	}
+
+	for _, binding := range bindings {
+		service := binding.Service
+		var moduleList []map[string]string
+		for _, module := range binding.Modules {
+			// 未上线的上线单打tag时取分支最新提交, 不需要重复创建
+			exists, err := model.HasWaitPipeline(service, module, event.Branch)
+			if err != nil {
+				return created, fmt.Errorf(config.HOOK_CREATE_ERROR, service, err)
+			}
+			if exists {
+				log.Infof("webhook service: %s module: %s branch: %s has wait pipeline, skip", service, module, event.Branch)
+				continue
+			}
+			moduleList = append(moduleList, map[string]string{"name": module, "branch": event.Branch})
+		}
+		if len(moduleList) == 0 {
+			continue
+		}
+
+		cp := pipeline.NewCreatePipeline()
+		pid, err := cp.Handle(name, summary, creator, event.User, "", event.User, service, moduleList)
+		if err != nil {
+			log.Errorf(config.HOOK_CREATE_ERROR, service, err)
+			created = append(created, Created{Service: service, Error: err.Error()})
+			continue
+		}
+		log.Infof("webhook %s create service: %s pipeline: %d modules: %v", event.Platform, service, pid, moduleList)
+		created = append(created, Created{PipelineID: pid, Service: service})
+	}
+	return created, nil
+}
+
+// verifySignature 校验webhook签名. GitHub: X-Hub-Signature-256, Gitea: X-Gitea-Signature, GitLab: X-Gitlab-Token
+func verifySignature(header http.Header, body []byte, secret string) bool {
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+
+	signature := header.Get("X-Gitea-Signature")
+	if signature == "" {
+		signature = strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	}
+	if signature == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// gitlab、gitea、github的仓库信息, 只保留需要的字段
+type gitlabProject struct {
+	HTTPURL string `json:"git_http_url"`
+	SSHURL  string `json:"git_ssh_url"`
+	WebURL  string `json:"web_url"`
+}
+
+type githubRepository struct {
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	HTMLURL  string `json:"html_url"`
+}
+
+type githubCommit struct {
+	Message string `json:"message"`
+}
+
+type githubUser struct {
+	Login    string `json:"login"`
+	Username string `json:"username"` // gitea
+}
+
+// parseEvent 按请求头识别平台及事件类型, 只处理分支推送及合并完成的合并请求, 其他事件(ping、打tag等)返回nil
+func parseEvent(header http.Header, body []byte) (*Event, error) {
+	switch {
+	case header.Get("X-Gitlab-Event") != "":
+		return parseGitlab(header.Get("X-Gitlab-Event"), body)
+	case header.Get("X-Gitea-Event") != "":
+		return parseGithub("gitea", header.Get("X-Gitea-Event"), body)
+	case header.Get("X-GitHub-Event") != "":
+		return parseGithub("github", header.Get("X-GitHub-Event"), body)
+	default:
+		return nil, fmt.Errorf(config.HOOK_EVENT_UNSUPPORTED, "missing event header")
+	}
+}
+
+func parseGitlab(kind string, body []byte) (*Event, error) {
+	switch kind {
+	case "Push Hook":
+		var payload struct {
+			Ref          string        `json:"ref"`
+			After        string        `json:"after"`
+			UserUsername string        `json:"user_username"`
+			Project      gitlabProject `json:"project"`
+			Commits      []struct {
+				ID      string `json:"id"`
+				Message string `json:"message"`
+			} `json:"commits"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf(config.HOOK_PAYLOAD_ERROR, err)
+		}
+		branch, ok := branchOf(payload.Ref)
+		if !ok || isDeleted(payload.After) {
+			return nil, nil
+		}
+
+		event := &Event{
+			Platform: "gitlab",
+			Repos:    []string{payload.Project.HTTPURL, payload.Project.SSHURL, payload.Project.WebURL},
+			Branch:   branch,
+			Commit:   payload.After,
+			User:     payload.UserUsername,
+		}
+		for _, commit := range payload.Commits {
+			if commit.ID == payload.After {
+				event.Title = firstLine(commit.Message)
+			}
+		}
+		return event, nil
+	case "Merge Request Hook":
+		var payload struct {
+			User struct {
+				Username string `json:"username"`
+			} `json:"user"`
+			Project          gitlabProject `json:"project"`
+			ObjectAttributes struct {
+				Action         string `json:"action"`
+				TargetBranch   string `json:"target_branch"`
+				Title          string `json:"title"`
+				MergeCommitSHA string `json:"merge_commit_sha"`
+			} `json:"object_attributes"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf(config.HOOK_PAYLOAD_ERROR, err)
+		}
+		attrs := payload.ObjectAttributes
+		// 已合并的合并请求修改标签等也会触发, 只处理合并动作
+		if attrs.Action != "merge" {
+			return nil, nil
+		}
+		return &Event{
+			Platform: "gitlab",
+			Repos:    []string{payload.Project.HTTPURL, payload.Project.SSHURL, payload.Project.WebURL},
+			Branch:   attrs.TargetBranch,
+			Commit:   attrs.MergeCommitSHA,
+			User:     payload.User.Username,
+			Title:    attrs.Title,
+		}, nil
+	default:
+		// 打tag等事件不需要处理
+		log.Infof("webhook gitlab event: %s ignored", kind)
+		return nil, nil
+	}
+}
+
+// parseGithub gitea的webhook与github格式一致
+func parseGithub(platform, kind string, body []byte) (*Event, error) {
+	switch kind {
+	case "push":
+		var payload struct {
+			Ref        string           `json:"ref"`
+			After      string           `json:"after"`
+			Deleted    bool             `json:"deleted"`
+			Repository githubRepository `json:"repository"`
+			HeadCommit *githubCommit    `json:"head_commit"`
+			Commits    []githubCommit   `json:"commits"`
+			Pusher     struct {
+				Name     string `json:"name"`
+				Username string `json:"username"` // gitea
+			} `json:"pusher"`
+			Sender githubUser `json:"sender"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf(config.HOOK_PAYLOAD_ERROR, err)
+		}
+		branch, ok := branchOf(payload.Ref)
+		if !ok || payload.Deleted || isDeleted(payload.After) {
+			return nil, nil
+		}
+
+		event := &Event{
+			Platform: platform,
+			Repos:    []string{payload.Repository.CloneURL, payload.Repository.SSHURL, payload.Repository.HTMLURL},
+			Branch:   branch,
+			Commit:   payload.After,
+			User:     firstNonEmpty(payload.Sender.Login, payload.Sender.Username, payload.Pusher.Username, payload.Pusher.Name),
+		}
+		if payload.HeadCommit != nil {
+			event.Title = firstLine(payload.HeadCommit.Message)
+		} else if len(payload.Commits) > 0 {
+			event.Title = firstLine(payload.Commits[len(payload.Commits)-1].Message)
+		}
+		return event, nil
+	case "pull_request":
+		var payload struct {
+			Action      string `json:"action"`
+			PullRequest struct {
+				Merged         bool        `json:"merged"`
+				Title          string      `json:"title"`
+				MergeCommitSHA string      `json:"merge_commit_sha"`
+				MergedBy       *githubUser `json:"merged_by"`
+				Base           struct {
+					Ref string `json:"ref"`
+				} `json:"base"`
+			} `json:"pull_request"`
+			Repository githubRepository `json:"repository"`
+			Sender     githubUser       `json:"sender"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf(config.HOOK_PAYLOAD_ERROR, err)
+		}
+		pr := payload.PullRequest
+		if payload.Action != "closed" || !pr.Merged {
+			return nil, nil
+		}
+
+		user := firstNonEmpty(payload.Sender.Login, payload.Sender.Username)
+		if pr.MergedBy != nil {
+			user = firstNonEmpty(pr.MergedBy.Login, pr.MergedBy.Username, user)
+		}
+		return &Event{
+			Platform: platform,
+			Repos:    []string{payload.Repository.CloneURL, payload.Repository.SSHURL, payload.Repository.HTMLURL},
+			Branch:   pr.Base.Ref,
+			Commit:   pr.MergeCommitSHA,
+			User:     user,
+			Title:    pr.Title,
+		}, nil
+	default:
+		// 打tag等事件不需要处理
+		log.Infof("webhook %s event: %s ignored", platform, kind)
+		return nil, nil
+	}
+}
+
+// binding 服务绑定的仓库模块
+type binding struct {
+	Service string
+	Modules []string
+}
+
+// findBindings 按仓库地址匹配模块, 返回绑定了这些模块的服务
+func findBindings(repos []string) ([]binding, error) {
+	addrs := make(map[string]bool)
+	for _, repo := range repos {
+		if addr := normalizeRepo(repo); addr != "" {
+			addrs[addr] = true
+		}
+	}
+
+	services, err := model.FindServices()
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []binding
+	for _, svc := range services {
+		modules, err := model.FindServiceCodeModules(svc.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		item := binding{Service: svc.Name}
+		for _, module := range modules {
+			if addrs[normalizeRepo(module.CodeModule.RepoAddr)] {
+				item.Modules = append(item.Modules, module.CodeModule.Name)
+			}
+		}
+		if len(item.Modules) > 0 {
+			bindings = append(bindings, item)
+		}
+	}
+	return bindings, nil
+}
+
+// normalizeRepo 将仓库地址统一为 主机/路径 以便比较, 例如:
+// git@gitlab.local:ops/ivr.git、ssh://git@gitlab.local:2222/ops/ivr.git、https://gitlab.local/ops/ivr -> gitlab.local/ops/ivr
+func normalizeRepo(repo string) string {
+	repo = strings.TrimSpace(repo)
+	if repo == "" {
+		return ""
+	}
+
+	var host, path string
+	if strings.Contains(repo, "://") {
+		u, err := url.Parse(repo)
+		if err != nil {
+			return ""
+		}
+		host, path = u.Hostname(), u.Path
+	} else {
+		// scp格式: [user@]host:path
+		i := strings.Index(repo, ":")
+		if i <= 0 {
+			return ""
+		}
+		host, path = repo[:i], repo[i+1:]
+		if j := strings.LastIndex(host, "@"); j >= 0 {
+			host = host[j+1:]
+		}
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || path == "" {
+		return ""
+	}
+	return strings.ToLower(host) + "/" + path
+}
+
+func branchOf(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", false
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), true
+}
+
+// isDeleted 删除分支时after为全0
+func isDeleted(commit string) bool {
+	return commit != "" && strings.Trim(commit, "0") == ""
+}
+
+func pipelineName(event *Event) string {
+	commit := event.Commit
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	name := fmt.Sprintf("%s@%s", event.Branch, commit)
+	if event.Title != "" {
+		name += " " + event.Title
+	}
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	return name
+}
+
+func firstLine(message string) string {
+	return strings.TrimSpace(strings.SplitN(message, "\n", 2)[0])
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/vcs"
+)
+
+// ModuleChangelog 模块本次上线相对上次成功上线的变更
+type ModuleChangelog struct {
+	Module  string `json:"module"`
+	FromTag string `json:"from_tag"` // 上次成功上线的tag, 首次上线为空
+	ToTag   string `json:"to_tag"`
+	*vcs.Changelog
+}
+
+// Changelog 生成上线单各模块的变更记录, 尚未打tag的模块不返回.
+// 两个tag之间的变更不会改变, 生成后缓存在库中.
+func Changelog(pid int64) ([]ModuleChangelog, error) {
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
+	}
+
+	updates, err := model.FindUpdateInfo(pid)
+	if err != nil {
+		return nil, fmt.Errorf(config.TAG_QUERY_UPDATE_ERROR, err)
+	}
+
+	previous, err := previousTags(pipeline, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	changelogs := make([]ModuleChangelog, 0, len(updates))
+	for _, update := range updates {
+		if update.CodeTag == "" {
+			log.Infof("pipeline: %d module: %s not tagged, skip changelog", pid, update.CodeModule)
+			continue
+		}
+
+		from := previous[update.CodeModule]
+		changelog, err := moduleChangelog(update.CodeModule, from, update.CodeTag)
+		if err != nil {
+			return nil, err
+		}
+		changelogs = append(changelogs, ModuleChangelog{
+			Module:    update.CodeModule,
+			FromTag:   from,
+			ToTag:     update.CodeTag,
+			Changelog: changelog,
+		})
+	}
+	return changelogs, nil
+}
+
+// previousTags 各模块在该上线单之前最近一次成功上线的tag
+func previousTags(pipeline *model.Pipeline, updates []model.PipelineUpdate) (map[string]string, error) {
+	modules := make([]string, 0, len(updates))
+	for _, update := range updates {
+		modules = append(modules, update.CodeModule)
+	}
+
+	tags, err := model.FindPreviousTags(pipeline.Service, pipeline.ID, modules)
+	if err != nil {
+		return nil, fmt.Errorf(config.CL_QUERY_TAG_ERROR, err)
+	}
+	return tags, nil
+}
+
+func moduleChangelog(module, from, to string) (*vcs.Changelog, error) {
+	cached, err := model.GetChangelog(module, from, to)
+	if err == nil {
+		changelog := new(vcs.Changelog)
+		if err := json.Unmarshal([]byte(cached.Content), changelog); err != nil {
+			return nil, fmt.Errorf(config.CL_CACHE_ERROR, module, err)
+		}
+		return changelog, nil
+	} else if !errors.Is(err, model.NotFound) {
+		return nil, fmt.Errorf(config.CL_CACHE_ERROR, module, err)
+	}
+
+	codeModule, err := model.GetCodeModuleInfo(module)
+	if err != nil {
+		return nil, fmt.Errorf(config.PL_QUERY_MODULE_ERROR, module)
+	}
+	repo, err := vcs.New(codeModule.RepoName)
+	if err != nil {
+		return nil, fmt.Errorf(config.CL_BUILD_ERROR, module, err)
+	}
+
+	changelog, err := repo.Changelog(codeModule.RepoAddr, from, to)
+	if err != nil {
+		return nil, fmt.Errorf(config.CL_BUILD_ERROR, module, err)
+	}
+	log.Infof("build module: %s changelog %s..%s commits: %d", module, from, to, len(changelog.Commits))
+
+	content, _ := json.Marshal(changelog)
+	if err := model.CreateChangelog(&model.Changelog{CodeModule: module, FromTag: from, ToTag: to, Content: string(content)}); err != nil {
+		// 并发生成时唯一索引冲突, 不影响本次返回
+		log.Errorf("cache module: %s changelog failed: %s", module, err)
+	}
+	return changelog, nil
+}
@@ -0,0 +1,57 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"nautilus/pkg/model"
+)
+
+func TestPreviousTags(t *testing.T) {
+	setup(t)
+
+	// 每个上线单的模块tag, 空tag表示未打tag
+	history := []struct {
+		status int
+		tags   map[string]string
+	}{
+		{model.PLSuccess, map[string]string{"ivr": "v1", "ivr_ui": "ui-v1"}},
+		{model.PLSuccess, map[string]string{"ivr": "v2"}},
+		{model.PLFailed, map[string]string{"ivr": "v3", "ivr_ui": "ui-v3"}},
+		{model.PLSuccess, map[string]string{"ivr": ""}},
+		{model.PLProcess, map[string]string{"ivr": "v4", "ivr_ui": "ui-v4"}},
+		{model.PLSuccess, map[string]string{"ivr": "v5"}},
+	}
+	var current *model.Pipeline
+	for i, h := range history {
+		pipeline := &model.Pipeline{Service: testService, Name: "release", Status: h.status}
+		mustInsert(t, pipeline)
+		for module, tag := range h.tags {
+			mustInsert(t, &model.PipelineUpdate{PipelineID: pipeline.ID, CodeModule: module, CodeTag: tag})
+		}
+		if i == 4 {
+			current = pipeline
+		}
+	}
+	// 其他服务的上线单不影响
+	other := &model.Pipeline{Service: "other", Name: "release", Status: model.PLSuccess}
+	mustInsert(t, other)
+	mustInsert(t, &model.PipelineUpdate{PipelineID: other.ID, CodeModule: "ivr", CodeTag: "other-v1"})
+
+	updates, err := model.FindUpdateInfo(current.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := previousTags(current, updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]string{"ivr": "v2", "ivr_ui": "ui-v1"}; !reflect.DeepEqual(tags, expect) {
+		t.Errorf("previous tags: %v, expect: %v", tags, expect)
+	}
+}
@@ -6,80 +6,190 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
-	"nautilus/pkg/util/cm"
+	"nautilus/pkg/util/vcs"
 )
 
+// FieldError 请求字段的校验错误, field与请求json字段一致, 例如: module_list[1].branch
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError 请求校验失败, 包含全部字段的错误
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return fmt.Sprintf(config.PL_VALIDATE_FAILED, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
 func NewCreatePipeline() *CreatePipeline {
 	return &CreatePipeline{}
 }
 
 type CreatePipeline struct{}
 
-func (cp *CreatePipeline) Handle(name, summary, creator, rd, qa, pm, service string, moduleList []map[string]string) error {
-	if err := cp.checkParam(name, summary, moduleList); err != nil {
-		return err
+// Handle 校验参数后创建上线单, 返回上线单ID. 参数不合法时返回*ValidationError
+func (cp *CreatePipeline) Handle(name, summary, creator, rd, qa, pm, service string, moduleList []map[string]string) (int64, error) {
+	moduleList = normalizeModules(moduleList)
+	if err := cp.checkParam(name, summary, rd, pm, service, moduleList); err != nil {
+		return 0, err
 	}
 
-	if err := model.CreatePipeline(name, summary, creator, rd, qa, pm, service, moduleList); err != nil {
-		return fmt.Errorf(config.PL_CREATE_PIPELINE_ERROR, err)
+	// 校验之后服务可能开始上线, 创建时在事务内再次检查
+	pid, err := model.CreatePipeline(name, summary, creator, rd, qa, pm, service, moduleList)
+	var active *model.ActivePipelineError
+	if errors.As(err, &active) {
+		verr := new(ValidationError)
+		verr.add("service", config.PL_SERVICE_BUSY, service, active.Pipeline.ID, model.PipelineStatusName[active.Pipeline.Status])
+		return 0, verr
+	} else if err != nil {
+		return 0, fmt.Errorf(config.PL_CREATE_PIPELINE_ERROR, err)
 	}
-	log.Infof("create pipeline success")
-	return nil
+	log.Infof("create pipeline: %d success", pid)
+	return pid, nil
 }
 
-func (cp *CreatePipeline) checkParam(name, summary string, moduleList []map[string]string) error {
+// normalizeModules 去掉模块名、分支名首尾的空白, 校验与保存使用同一结果
+func normalizeModules(moduleList []map[string]string) []map[string]string {
+	result := make([]map[string]string, 0, len(moduleList))
+	for _, item := range moduleList {
+		result = append(result, map[string]string{
+			"name":   strings.TrimSpace(item["name"]),
+			"branch": strings.TrimSpace(item["branch"]),
+		})
+	}
+	return result
+}
+
+// checkParam 校验全部字段后一并返回错误; 服务、模块绑定及其他字段都合法时才检查分支, 避免无效的仓库访问
+func (cp *CreatePipeline) checkParam(name, summary, rd, pm, service string, moduleList []map[string]string) error {
+	verr := new(ValidationError)
 	if strings.TrimSpace(name) == "" {
-		return fmt.Errorf(config.PL_SEGMENT_IS_EMPTY, config.ONLINE_NAME)
+		verr.add("name", config.PL_SEGMENT_IS_EMPTY, config.ONLINE_NAME)
 	}
 	if strings.TrimSpace(summary) == "" {
-		return fmt.Errorf(config.PL_SEGMENT_IS_EMPTY, config.ONLINE_DESC)
+		verr.add("summary", config.PL_SEGMENT_IS_EMPTY, config.ONLINE_DESC)
+	}
+	if strings.TrimSpace(rd) == "" {
+		verr.add("rd", config.PL_SEGMENT_IS_EMPTY, config.RD_NAME)
+	}
+	if strings.TrimSpace(pm) == "" {
+		verr.add("pm", config.PL_SEGMENT_IS_EMPTY, config.PM_NAME)
 	}
 
-	for _, item := range moduleList {
-		module := item["name"]
-		branch := item["branch"]
-		if strings.TrimSpace(module) == "" {
-			return fmt.Errorf(config.PL_SEGMENT_IS_EMPTY, config.MODULE_NAME)
+	bound, err := cp.checkService(service, verr)
+	if err != nil {
+		return err
+	}
+
+	if len(moduleList) == 0 {
+		verr.add("module_list", config.PL_MODULE_LIST_EMPTY)
+	}
+	seen := make(map[string]bool)
+	for i, item := range moduleList {
+		module, branch := item["name"], item["branch"]
+		field := fmt.Sprintf("module_list[%d]", i)
+
+		if module == "" {
+			verr.add(field+".name", config.PL_SEGMENT_IS_EMPTY, config.MODULE_NAME)
+		} else if seen[module] {
+			verr.add(field+".name", config.PL_MODULE_DUPLICATE, module)
+		} else if bound != nil && !bound[module] {
+			verr.add(field+".name", config.PL_MODULE_NOT_BOUND, module, service)
 		}
-		if strings.TrimSpace(branch) == "" {
-			return fmt.Errorf(config.PL_SEGMENT_IS_EMPTY, config.BRANCH_NAME)
+		seen[module] = true
+
+		if branch == "" {
+			verr.add(field+".branch", config.PL_SEGMENT_IS_EMPTY, config.BRANCH_NAME)
 		}
-		if err := cp.checkGit(module, branch); err != nil {
+	}
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+
+	for i, item := range moduleList {
+		module, branch := item["name"], item["branch"]
+		exists, err := cp.checkBranch(module, branch)
+		if err != nil {
 			return err
 		}
+		if !exists {
+			verr.add(fmt.Sprintf("module_list[%d].branch", i), config.PL_BRANCH_CHECK_FAILED, module, branch)
+		}
+	}
+	if len(verr.Fields) > 0 {
+		return verr
 	}
 	return nil
 }
 
-func (cp *CreatePipeline) checkGit(module, branch string) error {
-	codeModule, err := model.GetCodeModuleInfo(module)
+// checkService 检查服务存在且没有上线中、回滚中的上线单, 返回服务绑定的模块; 服务不合法时返回nil
+func (cp *CreatePipeline) checkService(service string, verr *ValidationError) (map[string]bool, error) {
+	if strings.TrimSpace(service) == "" {
+		verr.add("service", config.PL_SEGMENT_IS_EMPTY, config.SERVICE)
+		return nil, nil
+	}
+
+	if _, err := model.GetServiceInfo(service); errors.Is(err, model.NotFound) {
+		verr.add("service", config.PL_SERVICE_NOT_FOUND, service)
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf(config.PL_QUERY_SERVICE_ERROR, service, err)
+	}
+
+	active, err := model.GetActivePipeline(service)
+	if err == nil {
+		verr.add("service", config.PL_SERVICE_BUSY, service, active.ID, model.PipelineStatusName[active.Status])
+	} else if !errors.Is(err, model.NotFound) {
+		return nil, fmt.Errorf(config.PL_QUERY_SERVICE_ERROR, service, err)
+	}
+
+	bindings, err := model.FindServiceCodeModules(service)
 	if err != nil {
-		return fmt.Errorf(config.PL_QUERY_MODULE_ERROR, module)
+		return nil, fmt.Errorf(config.DB_QUERY_MODULE_BINDING_ERROR, err)
 	}
-	param := fmt.Sprintf("git ls-remote --heads %s %s | wc -l", codeModule.RepoAddr, branch)
-	log.Infof("git check param: %s", param)
-	output, err := cm.Call(param)
+	bound := make(map[string]bool)
+	for _, item := range bindings {
+		bound[item.CodeModule.Name] = true
+	}
+	return bound, nil
+}
+
+// checkBranch 按模块的仓库类型检查分支是否存在
+func (cp *CreatePipeline) checkBranch(module, branch string) (bool, error) {
+	codeModule, err := model.GetCodeModuleInfo(module)
 	if err != nil {
-		log.Errorf("exec git check command: %s error: %s", param, err)
-		return fmt.Errorf(config.PL_EXEC_GIT_CHECK_ERROR, err)
+		return false, fmt.Errorf(config.PL_QUERY_MODULE_ERROR, module)
 	}
-	tmpR := strings.Trim(string(output), "\n")
-	newR := strings.TrimSpace(tmpR)
-	result, err := strconv.Atoi(newR)
+
+	repo, err := vcs.New(codeModule.RepoName)
 	if err != nil {
-		log.Errorf("handle check result covert to int error: %s", err)
-		return fmt.Errorf(config.PL_RESULT_HANDLER_ERROR, err)
+		return false, fmt.Errorf(config.PL_EXEC_BRANCH_CHECK_ERROR, err)
 	}
-	if result == 0 {
-		return fmt.Errorf(config.PL_GIT_CHECK_FAILED)
+
+	log.Infof("%s check module: %s branch: %s", repo.Kind(), module, branch)
+	exists, err := repo.HasBranch(codeModule.RepoAddr, branch)
+	if err != nil {
+		log.Errorf("exec %s branch check error: %s", repo.Kind(), err)
+		return false, fmt.Errorf(config.PL_EXEC_BRANCH_CHECK_ERROR, err)
 	}
-	return nil
+	return exists, nil
 }
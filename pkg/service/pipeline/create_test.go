@@ -0,0 +1,224 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"nautilus/pkg/model"
+)
+
+const testService = "ivr"
+
+// 本地git仓库, 只有master、release两个分支
+var testRepo string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "pipeline_repo")
+	if err != nil {
+		panic(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "master"},
+		{"-c", "user.name=tester", "-c", "user.email=tester@local", "commit", "-q", "--allow-empty", "-m", "init"},
+		{"branch", "release"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			panic(string(output))
+		}
+	}
+	testRepo = dir
+
+	model.Connect("sqlite3", "file:pipeline_test?mode=memory&cache=shared")
+	if _, err := model.Migrate("up", 0); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setup 清空数据并写入测试服务, ivr绑定到服务, ivr_ui没有绑定
+func setup(t *testing.T) {
+	t.Helper()
+
+	for _, bean := range model.Tables() {
+		if _, err := model.MEngine.Where("1 = 1").Delete(bean); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	svc := &model.Service{Name: testService, Namespace: "default", ImageAddr: "registry.local/service/ivr:1.0.0", Replicas: 1, RD: "tester", OP: "tester"}
+	mustInsert(t, svc)
+	for _, name := range []string{"ivr", "ivr_ui"} {
+		module := &model.CodeModule{Name: name, Language: "python", RepoName: "GIT", RepoAddr: testRepo}
+		mustInsert(t, module)
+		if name == "ivr" {
+			mustInsert(t, &model.ModuleBinding{ServiceID: svc.ID, CodeModuleID: module.ID})
+		}
+	}
+}
+
+func mustInsert(t *testing.T, bean interface{}) {
+	t.Helper()
+
+	if _, err := model.MEngine.Insert(bean); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func modules(items ...string) []map[string]string {
+	result := make([]map[string]string, 0)
+	for i := 0; i+1 < len(items); i += 2 {
+		result = append(result, map[string]string{"name": items[i], "branch": items[i+1]})
+	}
+	return result
+}
+
+func TestCreatePipeline(t *testing.T) {
+	setup(t)
+
+	// 模块名、分支名首尾的空白在校验前去掉, 保存的也是去掉后的结果
+	pid, err := NewCreatePipeline().Handle("release", "summary", "tester", "tester", "", "tester", testService, modules(" ivr ", " release\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := model.FindUpdateInfo(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0].CodeModule != "ivr" || updates[0].DeployBranch != "release" {
+		t.Errorf("pipeline updates: %+v", updates)
+	}
+}
+
+func TestCreatePipelineValidation(t *testing.T) {
+	cases := []struct {
+		name    string
+		rd      string
+		pm      string
+		service string
+		modules []map[string]string
+		active  bool
+		fields  []string
+	}{
+		{
+			name:    "empty rd pm",
+			rd:      " ",
+			service: testService,
+			modules: modules("ivr", "release"),
+			fields:  []string{"rd", "pm"},
+		},
+		{
+			name:    "empty module list",
+			rd:      "tester",
+			pm:      "tester",
+			service: testService,
+			fields:  []string{"module_list"},
+		},
+		{
+			name:    "duplicate module",
+			rd:      "tester",
+			pm:      "tester",
+			service: testService,
+			modules: modules("ivr", "release", " ivr", "master"),
+			fields:  []string{"module_list[1].name"},
+		},
+		{
+			name:    "unbound module",
+			rd:      "tester",
+			pm:      "tester",
+			service: testService,
+			modules: modules("ivr", "release", "ivr_ui", "release"),
+			fields:  []string{"module_list[1].name"},
+		},
+		{
+			name:    "empty module name and branch",
+			rd:      "tester",
+			pm:      "tester",
+			service: testService,
+			modules: modules(" ", " "),
+			fields:  []string{"module_list[0].name", "module_list[0].branch"},
+		},
+		{
+			name:    "service not found",
+			rd:      "tester",
+			pm:      "tester",
+			service: "unknown",
+			modules: modules("ivr", "release"),
+			fields:  []string{"service"},
+		},
+		{
+			name:    "busy service",
+			rd:      "tester",
+			pm:      "tester",
+			service: testService,
+			modules: modules("ivr", "release"),
+			active:  true,
+			fields:  []string{"service"},
+		},
+		{
+			name:    "branch not found",
+			rd:      "tester",
+			pm:      "tester",
+			service: testService,
+			modules: modules("ivr", "feature"),
+			fields:  []string{"module_list[0].branch"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setup(t)
+			if c.active {
+				mustInsert(t, &model.Pipeline{Service: testService, Name: "online", Summary: "online", Creator: "tester", RD: "tester", PM: "tester", Status: model.PLProcess})
+			}
+
+			_, err := NewCreatePipeline().Handle("release", "summary", "tester", c.rd, "", c.pm, c.service, c.modules)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("create pipeline error: %v, want validation error", err)
+			}
+
+			fields := make([]string, 0, len(verr.Fields))
+			for _, field := range verr.Fields {
+				fields = append(fields, field.Field)
+			}
+			if !reflect.DeepEqual(fields, c.fields) {
+				t.Errorf("fields: %v want %v", fields, c.fields)
+			}
+		})
+	}
+}
+
+func TestCreatePipelineActive(t *testing.T) {
+	setup(t)
+
+	active := &model.Pipeline{Service: testService, Name: "online", Summary: "online", Creator: "tester", RD: "tester", PM: "tester", Status: model.PLRollbacking}
+	mustInsert(t, active)
+
+	// 校验通过后服务开始上线时, 创建在事务内检查到上线中的上线单
+	_, err := model.CreatePipeline("release", "summary", "tester", "tester", "", "tester", testService, modules("ivr", "release"))
+	var aerr *model.ActivePipelineError
+	if !errors.As(err, &aerr) || aerr.Pipeline.ID != active.ID {
+		t.Fatalf("create pipeline error: %v, want active pipeline: %d", err, active.ID)
+	}
+
+	count, err := model.MEngine.Where("service = ?", testService).Count(new(model.Pipeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("pipelines: %d want 1", count)
+	}
+}
@@ -4,3 +4,36 @@
 //
 
 package pipeline
+
+import (
+	"fmt"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+)
+
+// Detail 上线单及其变更模块、模块镜像
+type Detail struct {
+	Pipeline *model.Pipeline        `json:"pipeline"`
+	Updates  []model.PipelineUpdate `json:"updates"`
+	Images   []model.PipelineImage  `json:"images"`
+}
+
+// QueryPipeline 查询上线单详情, 评审时可查看各模块的tag及分支合并检查结果, 以及各模块打tag、构建镜像的状态和输出
+func QueryPipeline(pid int64) (*Detail, error) {
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
+	}
+
+	updates, err := model.FindUpdateInfo(pid)
+	if err != nil {
+		return nil, fmt.Errorf(config.TAG_QUERY_UPDATE_ERROR, err)
+	}
+
+	images, err := model.FindImages(pid)
+	if err != nil {
+		return nil, fmt.Errorf(config.IMG_QUERY_IS_BUILD_ERROR, err)
+	}
+	return &Detail{Pipeline: pipeline, Updates: updates, Images: images}, nil
+}
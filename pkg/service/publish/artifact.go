@@ -0,0 +1,151 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+)
+
+const (
+	ArtifactPackage          = "package.tar.gz"     // 缓存目录下的编译包, 与maketag一致
+	DefaultArtifactPath      = "/tmp/code/artifact" // 未配置build.artifact时的编译包缓存目录
+	DefaultArtifactRetention = 7                    // 编译包超过7天未使用则清理
+	DefaultArtifactKeep      = 5                    // 每个模块最多保留5个编译包
+)
+
+// buildHash 构建配置的摘要, 构建文件变化时不复用之前的编译包
+func buildHash(build *BuildConfig) string {
+	content, _ := json.Marshal(build)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// artifactDir 模块在指定提交、构建配置下的编译包缓存目录, maketag通过-k读写
+func artifactDir(module, commit, hash string) string {
+	root := config.Config().Build.Artifact
+	if root == "" {
+		root = DefaultArtifactPath
+	}
+	return filepath.Join(root, module, commit+"-"+hash)
+}
+
+// hasArtifact 编译包缓存是否存在, 存在时maketag跳过编译
+func hasArtifact(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ArtifactPackage))
+	return err == nil
+}
+
+// saveArtifact maketag成功后记录编译包缓存, 已记录时更新使用时间
+func saveArtifact(module, commit, hash string) error {
+	dir := artifactDir(module, commit, hash)
+	info, err := os.Stat(filepath.Join(dir, ArtifactPackage))
+	if err != nil {
+		return fmt.Errorf(config.ART_SAVE_ERROR, module, err)
+	}
+
+	artifact, err := model.GetArtifact(module, commit, hash)
+	if err == nil {
+		if err := model.TouchArtifact(artifact.ID); err != nil {
+			return fmt.Errorf(config.ART_SAVE_ERROR, module, err)
+		}
+		return nil
+	} else if !errors.Is(err, model.NotFound) {
+		return fmt.Errorf(config.ART_SAVE_ERROR, module, err)
+	}
+
+	artifact = &model.BuildArtifact{
+		CodeModule: module,
+		CommitID:   commit,
+		BuildHash:  hash,
+		Path:       dir,
+		Size:       info.Size(),
+	}
+	if err := model.CreateArtifact(artifact); err != nil {
+		return fmt.Errorf(config.ART_SAVE_ERROR, module, err)
+	}
+	log.Infof("save module: %s commit: %s artifact: %s size: %d", module, commit, dir, artifact.Size)
+	return nil
+}
+
+// QueryArtifacts 查询模块的编译包缓存, module为空时查询全部
+func QueryArtifacts(module string) ([]model.BuildArtifact, error) {
+	artifacts, err := model.FindArtifacts(module)
+	if err != nil {
+		return nil, fmt.Errorf(config.ART_QUERY_ERROR, err)
+	}
+	return artifacts, nil
+}
+
+// CleanArtifacts 清理超过保留天数未使用, 或超出每个模块保留个数的编译包, 返回清理的个数
+func CleanArtifacts() (int, error) {
+	artifacts, err := model.FindArtifacts("")
+	if err != nil {
+		return 0, fmt.Errorf(config.ART_QUERY_ERROR, err)
+	}
+
+	retention, keep := config.Config().Build.Retention, config.Config().Build.Keep
+	if retention <= 0 {
+		retention = DefaultArtifactRetention
+	}
+	if keep <= 0 {
+		keep = DefaultArtifactKeep
+	}
+	expire := time.Now().AddDate(0, 0, -retention)
+
+	// 按模块、最近使用时间倒序
+	var (
+		cleaned int
+		counts  = make(map[string]int)
+	)
+	for _, artifact := range artifacts {
+		counts[artifact.CodeModule]++
+		if counts[artifact.CodeModule] <= keep && artifact.UseAt.After(expire) {
+			continue
+		}
+
+		if err := os.RemoveAll(artifact.Path); err != nil {
+			return cleaned, fmt.Errorf(config.ART_DELETE_ERROR, artifact.Path, err)
+		}
+		if err := model.DeleteArtifact(artifact.ID); err != nil {
+			return cleaned, fmt.Errorf(config.ART_DELETE_ERROR, artifact.Path, err)
+		}
+		log.Infof("clean module: %s commit: %s artifact: %s last used at: %s",
+			artifact.CodeModule, artifact.CommitID, artifact.Path, artifact.UseAt.Format(time.RFC3339))
+		cleaned++
+	}
+	return cleaned, nil
+}
+
+// RunArtifactCleaner 定期清理编译包缓存, ctx取消时退出
+func RunArtifactCleaner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if cleaned, err := CleanArtifacts(); err != nil {
+				log.Errorf("clean build artifacts failed: %s", err)
+			} else if cleaned > 0 {
+				log.Infof("clean %d build artifacts success", cleaned)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nautilus/pkg/model"
+)
+
+func TestArtifactClean(t *testing.T) {
+	setup(t, "", "")
+
+	build, err := parseBuildConfig("go", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := buildHash(build)
+
+	// c0~c5依次更久未使用, c6超过保留天数
+	now := time.Now()
+	for i := 0; i <= 6; i++ {
+		commit := fmt.Sprintf("c%d", i)
+		dir := artifactDir("api", commit, hash)
+		if hasArtifact(dir) {
+			t.Fatalf("artifact: %s should not exist", dir)
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ArtifactPackage), []byte(commit), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// 重复保存只更新使用时间
+		for j := 0; j < 2; j++ {
+			if err := saveArtifact("api", commit, hash); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		useAt := now.Add(-time.Duration(i) * time.Hour)
+		if i == 6 {
+			useAt = now.AddDate(0, 0, -DefaultArtifactRetention-1)
+		}
+		if _, err := model.MEngine.Where("commit_id = ?", commit).Cols("use_at").
+			Update(&model.BuildArtifact{UseAt: useAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	artifacts, err := QueryArtifacts("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 7 {
+		t.Fatalf("artifacts: %d, want: 7", len(artifacts))
+	}
+
+	cleaned, err := CleanArtifacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleaned != 2 {
+		t.Errorf("cleaned: %d, want: 2", cleaned)
+	}
+	for i := 0; i <= 6; i++ {
+		dir := artifactDir("api", fmt.Sprintf("c%d", i), hash)
+		if want := i < DefaultArtifactKeep; hasArtifact(dir) != want {
+			t.Errorf("artifact: %s exists: %v, want: %v", dir, !want, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/cm"
+	"nautilus/pkg/util/k8s"
+)
+
+// 自定义指标类型
+const (
+	MetricPods     = "pods"     // pod指标的平均值
+	MetricExternal = "external" // 外部指标的平均值
+)
+
+// AutoscaleMetric 自定义扩缩容指标
+type AutoscaleMetric struct {
+	Type   string `json:"type"`   // pods、external
+	Name   string `json:"name"`   // 指标名
+	Target string `json:"target"` // 目标平均值, 例如: 100、500m
+}
+
+// SetAutoscale 保存服务在指定阶段的自动扩缩容配置, 服务已上线时立即绑定到在线组
+func SetAutoscale(autoscale *model.ServiceAutoscale) error {
+	if err := validateAutoscale(autoscale); err != nil {
+		return err
+	}
+
+	if err := checkLock(autoscale.Service, 0, ""); err != nil {
+		return err
+	}
+
+	svc, err := model.GetServiceInfo(autoscale.Service)
+	if err != nil {
+		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	if err := model.SaveAutoscale(autoscale); err != nil {
+		return fmt.Errorf(config.ASC_SAVE_ERROR, err)
+	}
+	log.Infof("save service: %s phase: %s autoscale success", svc.Name, autoscale.Phase)
+
+	// 第一次上线前没有在线组, 在确认完成时绑定
+	if svc.OnlineGroup == "" {
+		return nil
+	}
+
+	resource, err := k8s.New(svc.Namespace)
+	if err != nil {
+		return err
+	}
+	return bindHPA(resource, svc, autoscale.Phase, svc.OnlineGroup)
+}
+
+// DeleteAutoscale 删除服务在指定阶段的自动扩缩容配置及对应的HPA
+func DeleteAutoscale(service, phase string) error {
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
+	svc, err := model.GetServiceInfo(service)
+	if err != nil {
+		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	if err := model.DeleteAutoscale(service, phase); err != nil {
+		return fmt.Errorf(config.ASC_DELETE_ERROR, err)
+	}
+
+	resource, err := k8s.New(svc.Namespace)
+	if err != nil {
+		return err
+	}
+
+	name := k8s.GetHPAName(service, svc.ID, phase)
+	if err := resource.DeleteHPA(svc.Namespace, name); err != nil {
+		return fmt.Errorf(config.ASC_K8S_HPA_EXEC_ERROR, name, err)
+	}
+	log.Infof("delete service: %s phase: %s hpa: %s success", service, phase, name)
+	return nil
+}
+
+// QueryAutoscale 查询服务全部阶段的自动扩缩容配置
+func QueryAutoscale(service string) ([]model.ServiceAutoscale, error) {
+	autoscales, err := model.FindAutoscales(service)
+	if err != nil {
+		return nil, fmt.Errorf(config.ASC_QUERY_ERROR, err)
+	}
+	return autoscales, nil
+}
+
+func validateAutoscale(autoscale *model.ServiceAutoscale) error {
+	if !cm.In(autoscale.Phase, []string{model.PHASE_SANDBOX, model.PHASE_ONLINE}) {
+		return fmt.Errorf(config.ASC_PHASE_INVALID, autoscale.Phase)
+	}
+
+	if autoscale.MinReplicas < 1 || autoscale.MaxReplicas < autoscale.MinReplicas {
+		return fmt.Errorf(config.ASC_REPLICAS_INVALID, autoscale.MinReplicas, autoscale.MaxReplicas)
+	}
+
+	metrics, err := parseMetrics(autoscale.Metrics)
+	if err != nil {
+		return err
+	}
+
+	if autoscale.TargetCPU <= 0 && autoscale.TargetMem <= 0 && len(metrics) == 0 {
+		return fmt.Errorf(config.ASC_TARGET_EMPTY)
+	}
+	return nil
+}
+
+func parseMetrics(content string) ([]AutoscaleMetric, error) {
+	if content == "" {
+		return nil, nil
+	}
+
+	var metrics []AutoscaleMetric
+	if err := json.Unmarshal([]byte(content), &metrics); err != nil {
+		return nil, fmt.Errorf(config.ASC_DECODE_ERROR, err)
+	}
+
+	for _, metric := range metrics {
+		if !cm.In(metric.Type, []string{MetricPods, MetricExternal}) {
+			return nil, fmt.Errorf(config.ASC_METRIC_INVALID, metric.Name, "unsupported type: "+metric.Type)
+		}
+		if metric.Name == "" {
+			return nil, fmt.Errorf(config.ASC_METRIC_INVALID, metric.Name, "name is empty")
+		}
+		if _, err := resource.ParseQuantity(metric.Target); err != nil {
+			return nil, fmt.Errorf(config.ASC_METRIC_INVALID, metric.Name, err)
+		}
+	}
+	return metrics, nil
+}
+
+// phaseReplicas 返回阶段的部署副本数: 配置自动扩缩容时取最小副本数, 否则沙盒1个、全量取服务副本数
+func phaseReplicas(svc *model.Service, phase string) (int32, error) {
+	autoscale, err := model.GetAutoscale(svc.Name, phase)
+	if err == nil {
+		return autoscale.MinReplicas, nil
+	}
+	if !errors.Is(err, model.NotFound) {
+		return 0, fmt.Errorf(config.ASC_QUERY_ERROR, err)
+	}
+
+	if phase == model.PHASE_SANDBOX {
+		// 沙盒阶段默认1个副本
+		return 1, nil
+	}
+	return svc.Replicas, nil
+}
+
+// restoreReplicas 回滚组恢复的副本数. 配置自动扩缩容时取两组当前副本数的较大值并限制在[min, max],
+// 避免回滚后副本数骤降或与HPA争抢; 否则与部署时一致.
+func restoreReplicas(resource k8s.Resource, svc *model.Service, phase string, deployments ...string) (int32, error) {
+	autoscale, err := model.GetAutoscale(svc.Name, phase)
+	if errors.Is(err, model.NotFound) {
+		return phaseReplicas(svc, phase)
+	} else if err != nil {
+		return 0, fmt.Errorf(config.ASC_QUERY_ERROR, err)
+	}
+
+	replicas := autoscale.MinReplicas
+	for _, name := range deployments {
+		dep, err := resource.GetDeployment(svc.Namespace, name)
+		if err != nil {
+			log.Warnf("get deployment: %s replicas error: %s", name, err)
+			continue
+		}
+		if dep.Spec.Replicas != nil && *dep.Spec.Replicas > replicas {
+			replicas = *dep.Spec.Replicas
+		}
+	}
+
+	if replicas > autoscale.MaxReplicas {
+		replicas = autoscale.MaxReplicas
+	}
+	return replicas, nil
+}
+
+// releaseReplicas 阶段的HPA管理该deployment时, 副本数交给HPA并从apply的对象中去掉spec.replicas,
+// 避免重新部署时与HPA争抢副本数
+func releaseReplicas(resource k8s.Resource, svc *model.Service, phase string, dep *appsv1.Deployment) error {
+	managed, err := managedByHPA(resource, svc, phase, dep)
+	if err != nil || !managed {
+		return err
+	}
+
+	name := k8s.GetHPAName(svc.Name, svc.ID, phase)
+	if err := resource.HandoverReplicas(dep.Namespace, dep.Name); err != nil {
+		return fmt.Errorf(config.ASC_K8S_HPA_EXEC_ERROR, name, err)
+	}
+	dep.Spec.Replicas = nil
+	log.Infof("deployment: %s replicas managed by hpa: %s", dep.Name, name)
+	return nil
+}
+
+// managedByHPA 阶段的HPA当前是否管理该deployment
+func managedByHPA(resource k8s.Resource, svc *model.Service, phase string, dep *appsv1.Deployment) (bool, error) {
+	name := k8s.GetHPAName(svc.Name, svc.ID, phase)
+	hpa, err := resource.GetHPA(svc.Namespace, name)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf(config.ASC_K8S_HPA_EXEC_ERROR, name, err)
+	}
+	return hpa.Spec.ScaleTargetRef.Name == dep.Name, nil
+}
+
+// bindHPA 将阶段的HPA绑定到指定组的deployment, 阶段未配置自动扩缩容时删除HPA.
+// HPA名称不区分部署组, 蓝绿切换时只改变scaleTargetRef, 未绑定的组不受HPA控制.
+func bindHPA(resource k8s.Resource, svc *model.Service, phase, group string) error {
+	name := k8s.GetHPAName(svc.Name, svc.ID, phase)
+
+	autoscale, err := model.GetAutoscale(svc.Name, phase)
+	if errors.Is(err, model.NotFound) {
+		if err := resource.DeleteHPA(svc.Namespace, name); err != nil {
+			return fmt.Errorf(config.ASC_K8S_HPA_EXEC_ERROR, name, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(config.ASC_QUERY_ERROR, err)
+	}
+
+	hpa, err := renderHPA(svc, autoscale, group)
+	if err != nil {
+		return err
+	}
+	if err := resource.CreateOrUpdateHPA(svc.Namespace, hpa); err != nil {
+		return fmt.Errorf(config.ASC_K8S_HPA_EXEC_ERROR, name, err)
+	}
+	log.Infof("bind hpa: %s to deployment: %s success", name, hpa.Spec.ScaleTargetRef.Name)
+	return nil
+}
+
+func renderHPA(svc *model.Service, autoscale *model.ServiceAutoscale, group string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	var (
+		name           = k8s.GetHPAName(svc.Name, svc.ID, autoscale.Phase)
+		deploymentName = k8s.GetDeploymentName(svc.Name, svc.ID, autoscale.Phase, group)
+		minReplicas    = autoscale.MinReplicas
+	)
+
+	metrics, err := generateHPAMetrics(autoscale)
+	if err != nil {
+		return nil, err
+	}
+
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "autoscaling/v2",
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: svc.Namespace,
+			Labels: map[string]string{
+				"service": svc.Name,
+				"phase":   autoscale.Phase,
+			},
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deploymentName,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: autoscale.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}, nil
+}
+
+func generateHPAMetrics(autoscale *model.ServiceAutoscale) ([]autoscalingv2.MetricSpec, error) {
+	var specs []autoscalingv2.MetricSpec
+
+	utilization := func(name corev1.ResourceName, target int32) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &target,
+				},
+			},
+		}
+	}
+
+	if autoscale.TargetCPU > 0 {
+		specs = append(specs, utilization(corev1.ResourceCPU, autoscale.TargetCPU))
+	}
+	if autoscale.TargetMem > 0 {
+		specs = append(specs, utilization(corev1.ResourceMemory, autoscale.TargetMem))
+	}
+
+	metrics, err := parseMetrics(autoscale.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, metric := range metrics {
+		value := resource.MustParse(metric.Target)
+		target := autoscalingv2.MetricTarget{
+			Type:         autoscalingv2.AverageValueMetricType,
+			AverageValue: &value,
+		}
+		identifier := autoscalingv2.MetricIdentifier{Name: metric.Name}
+
+		switch metric.Type {
+		case MetricPods:
+			specs = append(specs, autoscalingv2.MetricSpec{
+				Type: autoscalingv2.PodsMetricSourceType,
+				Pods: &autoscalingv2.PodsMetricSource{Metric: identifier, Target: target},
+			})
+		case MetricExternal:
+			specs = append(specs, autoscalingv2.MetricSpec{
+				Type:     autoscalingv2.ExternalMetricSourceType,
+				External: &autoscalingv2.ExternalMetricSource{Metric: identifier, Target: target},
+			})
+		}
+	}
+	return specs, nil
+}
@@ -0,0 +1,108 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestAutoscaleFollowsOnlineGroup(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	hpaName := k8s.GetHPAName(testService, svc.ID, model.PHASE_ONLINE)
+	blue, green := createGroups(t, client, svc, 4)
+
+	autoscale := &model.ServiceAutoscale{
+		Service:     testService,
+		Phase:       model.PHASE_ONLINE,
+		MinReplicas: 2,
+		MaxReplicas: 6,
+		TargetCPU:   60,
+		Metrics:     `[{"type": "pods", "name": "qps", "target": "100"}]`,
+	}
+	if err := SetAutoscale(autoscale); err != nil {
+		t.Fatal(err)
+	}
+
+	hpaTarget := func() string {
+		t.Helper()
+		hpa, err := client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(context.TODO(), hpaName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get hpa: %s error: %s", hpaName, err)
+		}
+		if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 6 || len(hpa.Spec.Metrics) != 2 {
+			t.Fatalf("hpa spec: %+v", hpa.Spec)
+		}
+		return hpa.Spec.ScaleTargetRef.Name
+	}
+	if target := hpaTarget(); target != blue {
+		t.Fatalf("hpa target: %s want %s", target, blue)
+	}
+
+	// 部署组按最小副本数启动, HPA仍绑定在线组
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if replicas := getReplicas(t, client, green); replicas != 2 {
+		t.Errorf("deploy group replicas: %d want 2", replicas)
+	}
+
+	// 确认完成: HPA切换到新的在线组, 旧组缩成0
+	finishOnline(t, pipeline.ID)
+	if target := hpaTarget(); target != green {
+		t.Fatalf("hpa target after finish: %s want %s", target, green)
+	}
+	if replicas := getReplicas(t, client, blue); replicas != 0 {
+		t.Errorf("old group replicas: %d want 0", replicas)
+	}
+
+	// 模拟HPA扩容后回滚: 回滚组沿用当前副本数, HPA切回回滚组
+	scaleDeployment(t, client, green, 5)
+	if err := NewRollback(pipeline.ID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if target := hpaTarget(); target != blue {
+		t.Fatalf("hpa target after rollback: %s want %s", target, blue)
+	}
+	if replicas := getReplicas(t, client, blue); replicas != 5 {
+		t.Errorf("rollback group replicas: %d want 5", replicas)
+	}
+	if replicas := getReplicas(t, client, green); replicas != 0 {
+		t.Errorf("destroy group replicas: %d want 0", replicas)
+	}
+
+	// 删除配置同时删除HPA
+	if err := DeleteAutoscale(testService, model.PHASE_ONLINE); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(context.TODO(), hpaName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("hpa: %s not deleted: %v", hpaName, err)
+	}
+}
+
+func TestAutoscaleValidate(t *testing.T) {
+	cases := []model.ServiceAutoscale{
+		{Phase: "cronjob", MinReplicas: 1, MaxReplicas: 2, TargetCPU: 50},
+		{Phase: model.PHASE_ONLINE, MinReplicas: 0, MaxReplicas: 2, TargetCPU: 50},
+		{Phase: model.PHASE_ONLINE, MinReplicas: 3, MaxReplicas: 2, TargetCPU: 50},
+		{Phase: model.PHASE_ONLINE, MinReplicas: 1, MaxReplicas: 2},
+		{Phase: model.PHASE_ONLINE, MinReplicas: 1, MaxReplicas: 2, Metrics: `[{"type": "object", "name": "qps", "target": "1"}]`},
+		{Phase: model.PHASE_ONLINE, MinReplicas: 1, MaxReplicas: 2, Metrics: `[{"type": "pods", "name": "qps", "target": "abc"}]`},
+	}
+	for i := range cases {
+		if err := validateAutoscale(&cases[i]); err == nil {
+			t.Errorf("case %d: %+v should be invalid", i, cases[i])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"nautilus/pkg/config"
+)
+
+const (
+	DefaultBuildConcurrency = 4         // 未配置build.concurrency时的并发数
+	MaxBuildLog             = 64 * 1024 // 模块构建输出只保留最后64KB
+)
+
+// buildModules 按build.concurrency并发构建各模块, 单个模块失败不影响其他模块, 返回失败的模块及原因
+func buildModules(modules []string, build func(module string) error) map[string]error {
+	concurrency := config.Config().Build.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBuildConcurrency
+	}
+
+	var (
+		eg     errgroup.Group
+		mu     sync.Mutex
+		failed = make(map[string]error)
+	)
+	eg.SetLimit(concurrency)
+	for _, item := range modules {
+		module := item
+		eg.Go(func() error {
+			if err := build(module); err != nil {
+				mu.Lock()
+				failed[module] = err
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+	return failed
+}
+
+// failedModules 汇总失败的模块及原因, 全部成功时返回nil
+func failedModules(format string, failed map[string]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	modules := make([]string, 0, len(failed))
+	for module := range failed {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+
+	reasons := make([]string, 0, len(modules))
+	for _, module := range modules {
+		reasons = append(reasons, fmt.Sprintf("%s(%s)", module, failed[module]))
+	}
+	return fmt.Errorf(format, strings.Join(reasons, ", "))
+}
+
+// tailLog 截取构建输出的末尾, 失败原因一般在最后
+func tailLog(output string) string {
+	if len(output) <= MaxBuildLog {
+		return output
+	}
+	output = output[len(output)-MaxBuildLog:]
+	// 从完整的一行开始, 避免截断多字节字符
+	if i := strings.IndexByte(output, '\n'); i >= 0 {
+		output = output[i+1:]
+	}
+	return output
+}
@@ -0,0 +1,56 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nautilus/pkg/config"
+)
+
+func TestBuildModules(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+	modules := []string{"m1", "m2", "m3", "m4", "m5", "m6"}
+	failed := buildModules(modules, func(module string) error {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if module == "m2" || module == "m5" {
+			return fmt.Errorf("exit 1")
+		}
+		return nil
+	})
+
+	if peak > DefaultBuildConcurrency {
+		t.Errorf("concurrent builds: %d, limit: %d", peak, DefaultBuildConcurrency)
+	}
+	err := failedModules(config.TAG_MODULES_FAILED, failed)
+	if err == nil || err.Error() != fmt.Sprintf(config.TAG_MODULES_FAILED, "m2(exit 1), m5(exit 1)") {
+		t.Errorf("failed modules: %v", err)
+	}
+
+	output := strings.Repeat("line\n", MaxBuildLog)
+	if tail := tailLog(output); len(tail) > MaxBuildLog || !strings.HasPrefix(tail, "line\n") {
+		t.Errorf("tail log length: %d", len(tail))
+	}
+}
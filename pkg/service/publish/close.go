@@ -0,0 +1,46 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/cm"
+)
+
+// NewFail 将上线中的上线单标记为上线失败, 并释放上线单占用的服务锁
+func NewFail(pid int64, username string) error {
+	return closePipeline(pid, model.PLFailed, username)
+}
+
+// NewTerminate 终止待上线或上线中的上线单, 并释放上线单占用的服务锁.
+// 已发布的阶段不会回滚, 需要恢复时先回滚再终止.
+func NewTerminate(pid int64, username string) error {
+	return closePipeline(pid, model.PLTerminate, username)
+}
+
+// closePipeline 上线单结束于失败或终止时, 服务锁与确认完成、回滚一样随之释放
+func closePipeline(pid int64, status int, username string) error {
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
+	}
+
+	if !cm.Ini(pipeline.Status, []int{model.PLWait, model.PLProcess}) {
+		return fmt.Errorf(config.CLS_CANNOT_EXECUTE, pid, model.PipelineStatusName[pipeline.Status])
+	}
+
+	if err := model.UpdateStatus(pid, status); err != nil {
+		return fmt.Errorf(config.DB_UPDATE_PIPELINE_ERROR, err)
+	}
+	log.Infof("pipeline: %d closed by: %s with status: %s", pid, username, model.PipelineStatusName[status])
+
+	return releaseLock(pipeline.Service, pid, username)
+}
@@ -0,0 +1,63 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"testing"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestClosePipeline(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		close  func(pid int64, username string) error
+		want   int
+	}{
+		{name: "fail", status: model.PLProcess, close: NewFail, want: model.PLFailed},
+		{name: "terminate process", status: model.PLProcess, close: NewTerminate, want: model.PLTerminate},
+		{name: "terminate wait", status: model.PLWait, close: NewTerminate, want: model.PLTerminate},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			setup(t, k8s.BLUE, k8s.GREEN)
+			pipeline := createPipeline(t, c.status)
+
+			// 上线单占用服务锁
+			if err := checkLock(testService, pipeline.ID, "tester"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := c.close(pipeline.ID, "operator"); err != nil {
+				t.Fatal(err)
+			}
+
+			closed, err := model.GetPipeline(pipeline.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if closed.Status != c.want {
+				t.Errorf("pipeline status: %d want %d", closed.Status, c.want)
+			}
+
+			owner, err := QueryLock(testService)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner != nil {
+				t.Errorf("service lock not released: %+v", owner)
+			}
+
+			// 已结束的上线单不能再次标记
+			if err := c.close(pipeline.ID, "operator"); err == nil {
+				t.Error("close closed pipeline: want error")
+			}
+		})
+	}
+}
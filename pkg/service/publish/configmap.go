@@ -6,40 +6,342 @@
 package publish
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
+	"nautilus/pkg/util/cm"
 	"nautilus/pkg/util/k8s"
 )
 
-func NewConfigMap(namespace, service, pair string, data map[string]string) error {
-	configName := k8s.GetConfigmapName(service)
+// ConfigChecksumKey pod模板上configmap内容的校验和, 变化时触发滚动重启
+const ConfigChecksumKey = "nautilus/configmap-checksum"
 
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      configName,
-			Namespace: namespace,
-		},
-		Data: data,
+// NewConfigMap 记录服务公共配置(phase为空)或阶段覆盖配置的新版本, 随该阶段下次部署发布.
+// restart为true时立即发布到在线组并重启: 阶段配置只作用于该阶段, 公共配置先作用于沙盒(单阶段服务为全量).
+func NewConfigMap(namespace, service, phase, pair, username string, restart bool) error {
+	return publishConfigMap(namespace, service, phase, pair, username, "", restart)
+}
+
+// RollbackConfigMap 将服务的configmap回滚到指定版本, 回滚本身也记录为新版本
+func RollbackConfigMap(namespace, service string, version int, username string, restart bool) error {
+	cv, err := model.GetConfigmapVersion(service, version)
+	if err != nil {
+		return fmt.Errorf(config.CM_VERSION_QUERY_ERROR, version, err)
 	}
 
-	resource, err := k8s.New(namespace)
+	comment := fmt.Sprintf("rollback to v%d", version)
+	return publishConfigMap(namespace, service, cv.Phase, cv.Data, username, comment, restart)
+}
+
+// ApplyConfigMap 将阶段最新的配置发布到在线组并重启, 用于不上线代码时把沙盒验证过的公共配置推进到全量.
+// 只有这里把最新的公共配置推进到全量, 其他发布全量配置的操作沿用全量在线组的公共配置版本.
+func ApplyConfigMap(service, phase string) error {
+	if !cm.In(phase, []string{model.PHASE_SANDBOX, model.PHASE_ONLINE}) {
+		return fmt.Errorf(config.CM_PHASE_INVALID, phase)
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
+	svc, err := model.GetServiceInfo(service)
+	if err != nil {
+		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	resource, err := k8s.New(svc.Namespace)
 	if err != nil {
 		return err
 	}
-	if err := resource.CreateOrUpdateConfigMap(namespace, configMap); err != nil {
-		return fmt.Errorf(config.CM_K8S_EXEC_FAILED, err)
+	return applyOnline(resource, svc, phase, true)
+}
+
+// QueryConfigMapVersions 查询服务的configmap发布历史
+func QueryConfigMapVersions(service string) ([]model.ConfigmapVersion, error) {
+	versions, err := model.FindConfigmapVersions(service)
+	if err != nil {
+		return nil, fmt.Errorf(config.CM_VERSION_QUERY_ERROR, 0, err)
+	}
+	return versions, nil
+}
+
+// DiffConfigMap 对比服务两个configmap版本, 无差异返回空串
+func DiffConfigMap(service string, from, to int) (string, error) {
+	var contents []string
+	for _, version := range []int{from, to} {
+		cv, err := model.GetConfigmapVersion(service, version)
+		if err != nil {
+			return "", fmt.Errorf(config.CM_VERSION_QUERY_ERROR, version, err)
+		}
+
+		data, err := decodeConfig(cv.Data)
+		if err != nil {
+			return "", err
+		}
+
+		// 以yaml对比, key有序且每行一个
+		content, err := yaml.Marshal(data)
+		if err != nil {
+			return "", fmt.Errorf(config.CM_BUILD_YAML_ERROR, err)
+		}
+		contents = append(contents, string(content))
+	}
+
+	diff, err := k8s.DiffNamed(fmt.Sprintf("v%d", from), contents[0], fmt.Sprintf("v%d", to), contents[1])
+	if err != nil {
+		return "", fmt.Errorf(config.PRE_DIFF_ERROR, "ConfigMap", err)
+	}
+	return diff, nil
+}
+
+func publishConfigMap(namespace, service, phase, pair, username, comment string, restart bool) error {
+	if !cm.In(phase, []string{model.CONFIG_BASE, model.PHASE_SANDBOX, model.PHASE_ONLINE}) {
+		return fmt.Errorf(config.CM_PHASE_INVALID, phase)
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
 	}
-	log.Infof("deploy configmap: %s to k8s success", configName)
 
-	if err := model.UpdateConfigMap(service, pair); err != nil {
+	version := &model.ConfigmapVersion{
+		Service: service,
+		Phase:   phase,
+		Data:    pair,
+		Creator: username,
+		Comment: comment,
+	}
+	if err := model.SaveConfigmapVersion(version); err != nil {
 		return fmt.Errorf(config.CM_UPDATE_DB_ERROR, err)
 	}
-	log.Infof("record configmap: %s to db success", configName)
+	log.Infof("record service: %s phase: %q configmap version: %d to db success", service, phase, version.Version)
+
+	if !restart {
+		return nil
+	}
+
+	svc, err := model.GetServiceInfo(service)
+	if err != nil {
+		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	resource, err := k8s.New(namespace)
+	if err != nil {
+		return err
+	}
+	// 公共配置的修改按configPhases先作用于第一个部署阶段, 阶段覆盖配置不改变在线组的公共配置版本
+	for _, target := range configPhases(svc, phase) {
+		if err := applyOnline(resource, svc, target, phase == model.CONFIG_BASE); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// configPhases 配置修改立即生效的阶段: 阶段配置只影响该阶段, 公共配置先作用于第一个部署阶段
+func configPhases(svc *model.Service, phase string) []string {
+	if phase != model.CONFIG_BASE {
+		return []string{phase}
+	}
+	if svc.MultiPhase {
+		return []string{model.PHASE_SANDBOX}
+	}
+	return []string{model.PHASE_ONLINE}
+}
+
+// applyOnline 将阶段的合并配置发布到在线组的configmap, 并更新校验和触发滚动重启; 全量阶段同时更新定时任务的配置.
+// 全量阶段promote为false时沿用在线组的公共配置版本, 未经沙盒验证的公共配置不会发布到全量;
+// promote为true时使用最新的公共配置, 并记为在线组的版本.
+func applyOnline(resource k8s.Resource, svc *model.Service, phase string, promote bool) error {
+	// 第一次上线前没有在线组, 部署时会发布最新的配置
+	if svc.OnlineGroup == "" {
+		return nil
+	}
+
+	name := k8s.GetDeploymentName(svc.Name, svc.ID, phase, svc.OnlineGroup)
+	if _, err := resource.GetDeployment(svc.Namespace, name); k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(config.CM_K8S_RESTART_FAILED, name, err)
+	}
+
+	var (
+		baseVersion int
+		last        *model.Pipeline
+		err         error
+	)
+	if phase == model.PHASE_ONLINE {
+		if last, baseVersion, err = onlineBaseVersion(svc.Name); err != nil {
+			return err
+		}
+		if promote {
+			baseVersion = 0
+		}
+	}
+	data, version, err := mergeConfig(svc.Name, baseVersion, phase)
+	if err != nil {
+		return err
+	}
+
+	configMap := renderConfigMap(svc.Namespace, name, data)
+	if err := resource.CreateOrUpdateConfigMap(svc.Namespace, configMap); err != nil {
+		return fmt.Errorf(config.CM_K8S_EXEC_FAILED, err)
+	}
+	log.Infof("deploy configmap: %s to k8s success", configMap.Name)
+
+	checksum := configChecksum(data)
+	if err := resource.Restart(svc.Namespace, name, map[string]string{ConfigChecksumKey: checksum}); err != nil {
+		return fmt.Errorf(config.CM_K8S_RESTART_FAILED, name, err)
+	}
+	log.Infof("restart deployment: %s with configmap checksum: %s success", name, checksum)
+
+	if phase != model.PHASE_ONLINE {
+		return nil
+	}
+	if promote && last != nil && version != last.ConfigVersion {
+		if err := model.UpdateConfigVersion(last.ID, version); err != nil {
+			return fmt.Errorf(config.DB_UPDATE_PIPELINE_ERROR, err)
+		}
+		log.Infof("service: %s online base config version promoted to: %d", svc.Name, version)
+	}
+	// 定时任务与全量共用配置
+	return syncCronjobConfig(resource, svc, data)
+}
+
+// onlineBaseVersion 全量在线组使用的公共配置版本, 即最近一次上线成功的上线单固定的版本.
+// 上线单部署时没有公共配置返回noBaseVersion; 服务没有上线成功过时返回0, 使用最新的公共配置.
+func onlineBaseVersion(service string) (*model.Pipeline, int, error) {
+	last, err := model.GetServiceLastSuccessPipeline(service)
+	if errors.Is(err, model.NotFound) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, 0, err)
+	}
+	return last, pinnedVersion(last), nil
+}
+
+// pinnedVersion 上线单固定的公共配置版本, 部署时没有公共配置为noBaseVersion
+func pinnedVersion(pipeline *model.Pipeline) int {
+	if pipeline.ConfigVersion == 0 {
+		return noBaseVersion
+	}
+	return pipeline.ConfigVersion
+}
+
+// noBaseVersion 不合并公共配置
+const noBaseVersion = -1
+
+// mergeConfig 合并公共配置与阶段的覆盖配置, baseVersion为0时使用最新的公共配置, 为noBaseVersion时只有覆盖配置.
+// 返回合并结果及使用的公共配置版本.
+func mergeConfig(service string, baseVersion int, phase string) (map[string]string, int, error) {
+	var (
+		base *model.ConfigmapVersion
+		err  error
+	)
+	switch {
+	case baseVersion > 0:
+		base, err = model.GetConfigmapVersion(service, baseVersion)
+	case baseVersion == 0:
+		base, err = model.GetLatestConfigmapVersion(service, model.CONFIG_BASE)
+	default:
+		baseVersion = 0
+	}
+	if err != nil && !errors.Is(err, model.NotFound) {
+		return nil, 0, fmt.Errorf(config.CM_VERSION_QUERY_ERROR, baseVersion, err)
+	}
+
+	data := make(map[string]string)
+	if base != nil {
+		if data, err = decodeConfig(base.Data); err != nil {
+			return nil, 0, err
+		}
+		baseVersion = base.Version
+	}
+
+	override, err := latestConfig(service, phase)
+	if err != nil {
+		return nil, 0, err
+	}
+	return mergeData(data, override), baseVersion, nil
+}
+
+// latestConfig 获取公共配置或阶段覆盖配置的最新内容, 未配置时为空
+func latestConfig(service, phase string) (map[string]string, error) {
+	cv, err := model.GetLatestConfigmapVersion(service, phase)
+	if errors.Is(err, model.NotFound) {
+		return make(map[string]string), nil
+	} else if err != nil {
+		return nil, fmt.Errorf(config.CM_VERSION_QUERY_ERROR, 0, err)
+	}
+	return decodeConfig(cv.Data)
+}
+
+// mergeData 阶段覆盖配置覆盖公共配置中的同名key
+func mergeData(base, override map[string]string) map[string]string {
+	data := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		data[key] = value
+	}
+	for key, value := range override {
+		data[key] = value
+	}
+	return data
+}
+
+// renderDeployConfigMap 渲染上线单在指定阶段的configmap, 公共配置沿用上线单第一次部署时的版本
+func renderDeployConfigMap(pipeline *model.Pipeline, svc *model.Service, phase string) (*corev1.ConfigMap, int, error) {
+	data, version, err := mergeConfig(svc.Name, pipeline.ConfigVersion, phase)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	name := k8s.GetDeploymentName(svc.Name, svc.ID, phase, svc.DeployGroup)
+	return renderConfigMap(svc.Namespace, name, data), version, nil
+}
+
+func decodeConfig(pair string) (map[string]string, error) {
+	data := make(map[string]string)
+	if pair == "" {
+		return data, nil
+	}
+	if err := json.Unmarshal([]byte(pair), &data); err != nil {
+		return nil, fmt.Errorf(config.CM_DECODE_DATA_ERROR, err)
+	}
+	return data, nil
+}
+
+// configChecksum 计算configmap内容的校验和, 与key的顺序无关
+func configChecksum(data map[string]string) string {
+	// map序列化时key有序
+	content, _ := json.Marshal(data)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// renderConfigMap 渲染deployment、cronjob各自使用的configmap
+func renderConfigMap(namespace, resourceName string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8s.GetConfigmapName(resourceName),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"appid": resourceName,
+			},
+		},
+		Data: data,
+	}
+}
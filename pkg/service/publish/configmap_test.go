@@ -0,0 +1,212 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestConfigMapVersion(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	createDeployment(t, client, online, 3)
+
+	v1 := `{"LOG_FILE": "application.log"}`
+	v2 := `{"LOG_FILE": "application.log", "DEBUG": "true"}`
+	if err := NewConfigMap(testNamespace, testService, model.CONFIG_BASE, v1, "tester", false); err != nil {
+		t.Fatal(err)
+	}
+	// 单阶段服务修改公共配置直接作用于全量
+	if err := NewConfigMap(testNamespace, testService, model.CONFIG_BASE, v2, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+
+	want := configChecksum(map[string]string{"LOG_FILE": "application.log", "DEBUG": "true"})
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum := dep.Spec.Template.Annotations[ConfigChecksumKey]; checksum != want {
+		t.Errorf("online checksum: %s want %s", checksum, want)
+	}
+	cmap, err := client.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), k8s.GetConfigmapName(online), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmap.Data["DEBUG"] != "true" {
+		t.Errorf("online configmap data: %v", cmap.Data)
+	}
+
+	diff, err := DiffConfigMap(testService, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+DEBUG: \"true\"") {
+		t.Errorf("configmap diff: %s", diff)
+	}
+
+	if err := RollbackConfigMap(testNamespace, testService, 1, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := QueryConfigMapVersions(testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].Version != 3 || versions[0].Data != v1 || versions[0].Comment != "rollback to v1" {
+		t.Errorf("configmap versions: %+v", versions)
+	}
+
+	want = configChecksum(map[string]string{"LOG_FILE": "application.log"})
+	dep, err = client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum := dep.Spec.Template.Annotations[ConfigChecksumKey]; checksum != want {
+		t.Errorf("online checksum after rollback: %s want %s", checksum, want)
+	}
+}
+
+func TestConfigMapPhase(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	if err := NewConfigMap(testNamespace, testService, model.CONFIG_BASE, `{"DB_HOST": "db-1", "DEBUG": "false"}`, "tester", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConfigMap(testNamespace, testService, model.PHASE_SANDBOX, `{"DEBUG": "true"}`, "tester", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConfigMap(testNamespace, testService, "gray", `{}`, "tester", false); err == nil {
+		t.Error("invalid phase should be rejected")
+	}
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_SANDBOX, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 沙盒部署后出现新的公共配置, 不影响同一上线单的全量部署
+	if err := model.SaveConfigmapVersion(&model.ConfigmapVersion{Service: testService, Data: `{"DB_HOST": "db-2", "DEBUG": "false"}`, Creator: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := model.GetPipeline(pipeline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ConfigVersion != 1 {
+		t.Errorf("pipeline config version: %d want 1", p.ConfigVersion)
+	}
+
+	want := map[string]map[string]string{
+		model.PHASE_SANDBOX: {"DB_HOST": "db-1", "DEBUG": "true"},
+		model.PHASE_ONLINE:  {"DB_HOST": "db-1", "DEBUG": "false"},
+	}
+	for phase, data := range want {
+		name := k8s.GetDeploymentName(testService, svc.ID, phase, k8s.BLUE)
+		cmap, err := client.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), k8s.GetConfigmapName(name), metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("phase: %s configmap not created: %s", phase, err)
+		}
+		if !reflect.DeepEqual(cmap.Data, data) {
+			t.Errorf("phase: %s configmap data: %v want %v", phase, cmap.Data, data)
+		}
+
+		dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref := dep.Spec.Template.Spec.Containers[0].EnvFrom[0].ConfigMapRef; ref == nil || ref.Name != cmap.Name {
+			t.Errorf("phase: %s envFrom: %+v", phase, dep.Spec.Template.Spec.Containers[0].EnvFrom)
+		}
+		if checksum := dep.Spec.Template.Annotations[ConfigChecksumKey]; checksum != configChecksum(data) {
+			t.Errorf("phase: %s checksum: %s want %s", phase, checksum, configChecksum(data))
+		}
+	}
+
+	// 预览公共配置修改时对比全部阶段
+	manifests, err := PreviewConfigMap(testNamespace, testService, model.CONFIG_BASE, map[string]string{"DB_HOST": "db-3"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 2 || manifests[0].Status != DiffUpdate || !strings.Contains(manifests[0].Diff, "DEBUG: \"true\"") {
+		t.Fatalf("preview configmap: %+v", manifests)
+	}
+}
+
+func TestConfigMapOnlineBase(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	createGroups(t, client, svc, 3)
+	if _, err := model.MEngine.ID(svc.ID).Cols("multi_phase").Update(&model.Service{MultiPhase: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewConfigMap(testNamespace, testService, model.CONFIG_BASE, `{"DB_HOST": "db-1"}`, "tester", false); err != nil {
+		t.Fatal(err)
+	}
+	last := createPipeline(t, model.PLSuccess)
+	if err := model.UpdateConfigVersion(last.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	name, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	sandbox := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_SANDBOX, k8s.BLUE)
+	configData := func(name string) map[string]string {
+		t.Helper()
+		cmap, err := client.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), k8s.GetConfigmapName(name), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmap.Data
+	}
+
+	// 新的公共配置先发布到沙盒, 全量修改覆盖配置时仍沿用在线组的公共配置版本
+	if err := NewConfigMap(testNamespace, testService, model.CONFIG_BASE, `{"DB_HOST": "db-2"}`, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConfigMap(testNamespace, testService, model.PHASE_ONLINE, `{"DEBUG": "true"}`, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+	if data := configData(sandbox); data["DB_HOST"] != "db-2" {
+		t.Errorf("sandbox config: %v", data)
+	}
+	want := map[string]string{"DB_HOST": "db-1", "DEBUG": "true"}
+	if data := configData(online); !reflect.DeepEqual(data, want) {
+		t.Errorf("online config: %v want %v", data, want)
+	}
+	if data := configData(name); !reflect.DeepEqual(data, want) {
+		t.Errorf("cronjob config: %v want %v", data, want)
+	}
+
+	// 推进到全量后, 在线组改用最新的公共配置, 之后的覆盖配置修改不会回退
+	if err := ApplyConfigMap(testService, model.PHASE_ONLINE); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewConfigMap(testNamespace, testService, model.PHASE_ONLINE, `{"DEBUG": "false"}`, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"DB_HOST": "db-2", "DEBUG": "false"}
+	if data := configData(online); !reflect.DeepEqual(data, want) {
+		t.Errorf("online config after promote: %v want %v", data, want)
+	}
+	if data := configData(name); !reflect.DeepEqual(data, want) {
+		t.Errorf("cronjob config after promote: %v want %v", data, want)
+	}
+}
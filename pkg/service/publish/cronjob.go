@@ -11,6 +11,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"nautilus/pkg/config"
@@ -18,26 +19,101 @@ import (
 	"nautilus/pkg/util/k8s"
 )
 
-func NewCronjob(namespace, service, command, schedule string) (string, error) {
-	crontabID, err := model.CreateCrontab(namespace, service, command, schedule)
+// NewCronjob 创建定时任务, scheduling为空时调度到默认的定时节点池
+func NewCronjob(namespace, service, command, schedule string, scheduling *model.Scheduling) (string, error) {
+	if scheduling == nil {
+		scheduling = new(model.Scheduling)
+	}
+	spec, err := parseScheduling(scheduling, CronjobNodePool)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return "", err
+	}
+
+	// 定时任务与调度配置在同一事务内保存, 避免只写入其一
+	crontabID, err := model.CreateCrontab(namespace, service, command, schedule, scheduling)
 	if err != nil {
 		return "", fmt.Errorf(config.CRON_WRITE_DB_ERROR, err)
 	}
 
+	cronJob, err := renderCronjob(namespace, service, command, schedule, crontabID, spec)
+	if err != nil {
+		return "", err
+	}
+	name := cronJob.Name
+
+	// 定时任务与全量在线组共用配置, 沿用在线组的公共配置版本
+	_, baseVersion, err := onlineBaseVersion(service)
+	if err != nil {
+		return "", err
+	}
+	data, _, err := mergeConfig(service, baseVersion, model.PHASE_ONLINE)
+	if err != nil {
+		return "", err
+	}
+
+	resource, err := k8s.New(namespace)
+	if err != nil {
+		return "", err
+	}
+	configMap := renderConfigMap(namespace, name, data)
+	if err := resource.CreateOrUpdateConfigMap(namespace, configMap); err != nil {
+		return "", fmt.Errorf(config.CM_K8S_EXEC_FAILED, err)
+	}
+	log.Infof("deploy configmap: %s to k8s success", configMap.Name)
+
+	if err := resource.CreateOrUpdateCronJob(namespace, cronJob); err != nil {
+		return "", fmt.Errorf(config.CRON_K8S_EXEC_FAILED, err)
+	}
+	log.Infof("publish cronjob: %s to k8s success", name)
+	return name, nil
+}
+
+// syncCronjobConfig 全量在线组的配置变化后, 将服务各定时任务的configmap更新为相同的配置.
+// 定时任务每次运行创建新的pod, 不需要重启.
+func syncCronjobConfig(resource k8s.Resource, svc *model.Service, data map[string]string) error {
+	crontabs, err := model.FindCrontabs(svc.Namespace, svc.Name)
+	if err != nil {
+		return fmt.Errorf(config.CRON_QUERY_DB_ERROR, err)
+	}
+
+	for _, crontab := range crontabs {
+		name := k8s.GetCronjobName(svc.Name, crontab.ID)
+		if _, err := resource.GetCronJob(svc.Namespace, name); k8serrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf(config.CRON_PUBLISH_ERROR, err)
+		}
+
+		configMap := renderConfigMap(svc.Namespace, name, data)
+		if err := resource.CreateOrUpdateConfigMap(svc.Namespace, configMap); err != nil {
+			return fmt.Errorf(config.CM_K8S_EXEC_FAILED, err)
+		}
+		log.Infof("sync cronjob configmap: %s to k8s success", configMap.Name)
+	}
+	return nil
+}
+
+// renderCronjob 渲染定时任务, 代码使用服务最近一次上线成功的镜像(single构建方式为发布镜像)
+func renderCronjob(namespace, service, command, schedule string, crontabID int64, scheduling *schedulingSpec) (*batchv1.CronJob, error) {
 	svc, err := model.GetServiceInfo(service)
 	if err != nil {
-		return "", fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+		return nil, fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
 	}
 
 	pipeline, err := model.GetServiceLastSuccessPipeline(service)
 	if err != nil {
-		return "", fmt.Errorf(config.DB_PIPELINE_QUERY_FAILED, err)
+		return nil, fmt.Errorf(config.DB_PIPELINE_QUERY_FAILED, err)
 	}
 
 	var (
 		pid                  = pipeline.ID
 		name                 = k8s.GetCronjobName(service, crontabID)
-		configMapName        = k8s.GetConfigmapName(service)
+		configMapName        = k8s.GetConfigmapName(name)
+		secretName           = k8s.GetSecretName(service)
 		bootDeadline   int64 = 90
 		successHistory int32 = 0
 		failedHistory  int32 = 0
@@ -50,12 +126,21 @@ func NewCronjob(namespace, service, command, schedule string) (string, error) {
 		serviceImage         = svc.ImageAddr
 	)
 
-	initContainers, err := generateInitContainers(pid)
+	volumes, err := parseVolumes(svc.Volume)
 	if err != nil {
-		return "", fmt.Errorf(config.PUB_INIT_CONTINAER_ERROR, err)
+		return nil, err
+	}
+
+	initContainers, err := generateInitContainers(pid, volumes)
+	if err != nil {
+		return nil, fmt.Errorf(config.PUB_INIT_CONTINAER_ERROR, err)
 	}
 
 	cronJob := &batchv1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "CronJob",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
@@ -78,12 +163,11 @@ func NewCronjob(namespace, service, command, schedule string) (string, error) {
 						},
 						Spec: corev1.PodSpec{
 							RestartPolicy:                 corev1.RestartPolicyNever,
-							NodeSelector:                  generateNodeSelector("cronJob"),
 							SecurityContext:               generatePodSecurity(),
 							DNSPolicy:                     corev1.DNSClusterFirst,
 							DNSConfig:                     generatePodDNSConfig(),
 							ImagePullSecrets:              generateImagePullSecret(),
-							Volumes:                       generateVolumes(namespace, service, "cronjob", crontabID),
+							Volumes:                       generateVolumes(namespace, service, "cronjob", crontabID, volumes),
 							TerminationGracePeriodSeconds: &graceTime,
 							InitContainers:                initContainers,
 							Containers: []corev1.Container{
@@ -92,10 +176,10 @@ func NewCronjob(namespace, service, command, schedule string) (string, error) {
 									Image:           serviceImage,
 									ImagePullPolicy: corev1.PullIfNotPresent,
 									Env:             generateEnvs(namespace, service, phase),
-									EnvFrom:         generateEnvFroms(configMapName),
+									EnvFrom:         generateEnvFroms(configMapName, secretName),
 									SecurityContext: generateContainerSecurity(),
 									Resources:       generateResources("500m", "1000m", "512Mi", "4096Mi"),
-									VolumeMounts:    generateMainVolumeMounts(),
+									VolumeMounts:    generateMainVolumeMounts(volumes),
 									Args:            generateArgs(command),
 								},
 							},
@@ -105,16 +189,11 @@ func NewCronjob(namespace, service, command, schedule string) (string, error) {
 			},
 		},
 	}
-
-	resource, err := k8s.New(namespace)
-	if err != nil {
-		return "", err
-	}
-	if err := resource.CreateOrUpdateCronJob(namespace, cronJob); err != nil {
-		return "", fmt.Errorf(config.CRON_K8S_EXEC_FAILED, err)
+	scheduling.apply(&cronJob.Spec.JobTemplate.Spec.Template.Spec)
+	if err := applyReleaseImage(pipeline, svc, &cronJob.Spec.JobTemplate.Spec.Template.Spec); err != nil {
+		return nil, err
 	}
-	log.Infof("publish cronjob: %s to k8s success", name)
-	return name, nil
+	return cronJob, nil
 }
 
 func generateArgs(command string) []string {
@@ -123,6 +202,10 @@ func generateArgs(command string) []string {
 }
 
 func NewCronJobDelete(namespace, service string, jobID int64) error {
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
 	name := k8s.GetCronjobName(service, jobID)
 	log.Infof("delete cronjob name: %s", name)
 
@@ -136,5 +219,14 @@ func NewCronJobDelete(namespace, service string, jobID int64) error {
 		return err
 	}
 	log.Infof("delete cronjob: %s success", name)
+
+	configMapName := k8s.GetConfigmapName(name)
+	if err := resource.DeleteConfigMap(namespace, configMapName); err != nil && !k8serrors.IsNotFound(err) {
+		log.Errorf("delete configmap: %s failed: %s", configMapName, err)
+	}
+
+	if err := model.DeleteScheduling(service, jobID); err != nil {
+		log.Errorf("delete cronjob: %s scheduling failed: %s", name, err)
+	}
 	return nil
 }
@@ -0,0 +1,161 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestNewCronjob(t *testing.T) {
+	client, _ := setup(t, k8s.BLUE, k8s.GREEN)
+	createPipeline(t, model.PLSuccess)
+
+	name, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cronJob, err := client.BatchV1().CronJobs(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("cronjob: %s not created: %s", name, err)
+	}
+	if cronJob.Spec.Schedule != "*/10 * * * *" {
+		t.Errorf("cronjob schedule: %s", cronJob.Spec.Schedule)
+	}
+	if n := len(cronJob.Spec.JobTemplate.Spec.Template.Spec.InitContainers); n != 2 {
+		t.Errorf("cronjob init containers: %d want 2", n)
+	}
+	if pool := cronJob.Spec.JobTemplate.Spec.Template.Spec.NodeSelector[NodePoolLabel]; pool != CronjobNodePool {
+		t.Errorf("cronjob node pool: %s want %s", pool, CronjobNodePool)
+	}
+
+	if err := NewCronJobDelete(testNamespace, testService, parseJobID(t, name)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.BatchV1().CronJobs(testNamespace).Get(context.TODO(), name, metav1.GetOptions{}); err == nil {
+		t.Errorf("cronjob: %s not deleted", name)
+	}
+}
+
+func TestCronjobConfigSync(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	createGroups(t, client, svc, 3)
+	last := createPipeline(t, model.PLSuccess)
+
+	if err := NewConfigMap(testNamespace, testService, model.CONFIG_BASE, `{"LOG_LEVEL": "info"}`, "tester", false); err != nil {
+		t.Fatal(err)
+	}
+	// 全量在线组使用该公共配置版本
+	if err := model.UpdateConfigVersion(last.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	name, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cronjobConfig := func() map[string]string {
+		t.Helper()
+		cmap, err := client.CoreV1().ConfigMaps(testNamespace).Get(context.TODO(), k8s.GetConfigmapName(name), metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmap.Data
+	}
+
+	// 全量配置只记录不发布时, 定时任务的配置不变
+	if err := NewConfigMap(testNamespace, testService, model.PHASE_ONLINE, `{"LOG_LEVEL": "warn"}`, "tester", false); err != nil {
+		t.Fatal(err)
+	}
+	if data := cronjobConfig(); data["LOG_LEVEL"] != "info" {
+		t.Errorf("cronjob config before deploy: %v", data)
+	}
+
+	// 上线确认完成后, 定时任务使用新的全量在线组的配置
+	pipeline := createPipeline(t, model.PLProcess)
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	finishOnline(t, pipeline.ID)
+	if data := cronjobConfig(); data["LOG_LEVEL"] != "warn" {
+		t.Errorf("cronjob config after finish: %v", data)
+	}
+
+	// 全量配置立即发布时同时更新定时任务的配置
+	if err := NewConfigMap(testNamespace, testService, model.PHASE_ONLINE, `{"LOG_LEVEL": "debug"}`, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+	if data := cronjobConfig(); data["LOG_LEVEL"] != "debug" {
+		t.Errorf("cronjob config after restart: %v", data)
+	}
+
+	// 沙盒配置不影响定时任务
+	if err := NewConfigMap(testNamespace, testService, model.PHASE_SANDBOX, `{"LOG_LEVEL": "trace"}`, "tester", true); err != nil {
+		t.Fatal(err)
+	}
+	if data := cronjobConfig(); data["LOG_LEVEL"] != "debug" {
+		t.Errorf("cronjob config after sandbox restart: %v", data)
+	}
+}
+
+func TestNewCronjobSaveAtomic(t *testing.T) {
+	setup(t, k8s.BLUE, k8s.GREEN)
+	createPipeline(t, model.PLSuccess)
+
+	// 调度配置写入失败时, 定时任务也不落库
+	if _, err := model.MEngine.Exec("CREATE TRIGGER reject_scheduling BEFORE INSERT ON scheduling BEGIN SELECT RAISE(ABORT, 'rejected'); END"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if _, derr := model.MEngine.Exec("DROP TRIGGER reject_scheduling"); derr != nil {
+		t.Fatal(derr)
+	}
+	if err == nil {
+		t.Fatal("new cronjob: want error")
+	}
+
+	crontabs, err := model.FindCrontabs(testNamespace, testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crontabs) != 0 {
+		t.Errorf("crontabs: %+v want none", crontabs)
+	}
+
+	// 相同命令的定时任务各自创建, 不影响已有的任务及其调度配置
+	scheduling := &model.Scheduling{NodeSelector: `{"pool": "batch"}`}
+	first, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", scheduling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstID := parseJobID(t, first)
+	second, err := NewCronjob(testNamespace, testService, "python job.py", "*/5 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("cronjob: %s created twice", first)
+	}
+	crontab, err := model.GetCrontab(firstID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crontab.Schedule != "*/10 * * * *" {
+		t.Errorf("crontab schedule: %s", crontab.Schedule)
+	}
+	stored, err := model.GetScheduling(testService, crontab.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.NodeSelector != scheduling.NodeSelector {
+		t.Errorf("crontab scheduling: %+v", stored)
+	}
+}
@@ -46,36 +46,118 @@ func NewDeploy(pid int64, phase, username string) error {
 		return fmt.Errorf(config.PUB_DEPLOY_FINISHED)
 	}
 
+	if err := checkLock(pipeline.Service, pid, username); err != nil {
+		return err
+	}
+
 	svc, err := model.GetServiceInfo(pipeline.Service)
 	if err != nil {
 		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
 	}
 
+	if err := verifyImages(pipeline, svc); err != nil {
+		return err
+	}
+
+	configMap, configVersion, err := renderDeployConfigMap(pipeline, svc, phase)
+	if err != nil {
+		return err
+	}
+
+	dep, err := renderDeployment(pipeline, svc, phase, configMap)
+	if err != nil {
+		return err
+	}
+
 	var (
+		namespace      = dep.Namespace
+		deploymentName = dep.Name
+	)
+
+	resource, err := k8s.New(namespace)
+	if err != nil {
+		return err
+	}
+
+	// 配置随部署阶段发布, 每个deployment使用各自的configmap
+	if err := resource.CreateOrUpdateConfigMap(namespace, configMap); err != nil {
+		return fmt.Errorf(config.CM_K8S_EXEC_FAILED, err)
+	}
+	log.Infof("publish configmap: %s to k8s success", configMap.Name)
+
+	if pipeline.ConfigVersion == 0 && configVersion > 0 {
+		if err := model.UpdateConfigVersion(pid, configVersion); err != nil {
+			return fmt.Errorf(config.CM_UPDATE_DB_ERROR, err)
+		}
+	}
+
+	if err := releaseReplicas(resource, svc, phase, dep); err != nil {
+		return err
+	}
+
+	if err := resource.CreateOrUpdateDeployment(namespace, dep); err != nil {
+		return fmt.Errorf(config.PUB_K8S_DEPLOYMENT_EXEC_FAILED, err)
+	}
+	log.Infof("publish deployment: %s to k8s success", deploymentName)
+
+	if err := applyPDB(resource, svc, phase, svc.DeployGroup); err != nil {
+		return err
+	}
+
+	if err := model.CreatePhase(pid, model.KIND_DEPLOY, phase, model.PHProcess); err != nil {
+		return fmt.Errorf(config.PUB_RECORD_DEPLOYMENT_TO_DB_ERROR, err)
+	}
+	log.Infof("record deployment: %s to db success", deploymentName)
+	return nil
+}
+
+// renderDeployment 渲染上线单在指定阶段的deployment
+func renderDeployment(pipeline *model.Pipeline, svc *model.Service, phase string, configMap *corev1.ConfigMap) (*appsv1.Deployment, error) {
+	var (
+		pid            = pipeline.ID
 		serviceID      = svc.ID
 		serviceName    = svc.Name
 		namespace      = svc.Namespace
 		serviceImage   = svc.ImageAddr
 		deployGroup    = svc.DeployGroup
-		replicas       = int32(svc.Replicas)
 		graceTime      = int64(svc.ReserveTime)
 		deploymentName = k8s.GetDeploymentName(serviceName, serviceID, phase, deployGroup)
-		configMapName  = k8s.GetConfigmapName(serviceName)
+		configMapName  = configMap.Name
+		secretName     = k8s.GetSecretName(serviceName)
 		labels         = generateLabels(serviceName, phase, deploymentName)
 	)
 
-	if phase == model.PHASE_SANDBOX {
-		// 沙盒阶段默认返回1个副本
-		replicas = 1
+	replicas, err := phaseReplicas(svc, phase)
+	if err != nil {
+		return nil, err
 	}
 	log.Infof("publish get deployment name: %s group: %s replicas: %d", deploymentName, deployGroup, replicas)
 
-	initContainers, err := generateInitContainers(pid)
+	volumes, err := parseVolumes(svc.Volume)
+	if err != nil {
+		return nil, err
+	}
+
+	initContainers, err := generateInitContainers(pid, volumes)
+	if err != nil {
+		return nil, fmt.Errorf(config.PUB_INIT_CONTINAER_ERROR, err)
+	}
+
+	policy, err := getPolicy(serviceName)
 	if err != nil {
-		return fmt.Errorf(config.PUB_INIT_CONTINAER_ERROR, err)
+		return nil, err
+	}
+
+	scheduling, err := getScheduling(serviceName, 0, DefaultNodePool)
+	if err != nil {
+		return nil, err
 	}
 
 	dep := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentName,
 			Namespace: namespace,
@@ -102,15 +184,17 @@ func NewDeploy(pid int64, phase, username string) error {
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					Annotations: map[string]string{
+						ConfigChecksumKey: configChecksum(configMap.Data),
+					},
 				},
 				Spec: corev1.PodSpec{
-					Affinity:                      generateAffinity(deploymentName),
-					NodeSelector:                  generateNodeSelector("default"),
+					TopologySpreadConstraints:     generateTopologySpread(policy, deploymentName),
 					SecurityContext:               generatePodSecurity(),
 					DNSPolicy:                     corev1.DNSClusterFirst,
 					DNSConfig:                     generatePodDNSConfig(),
 					ImagePullSecrets:              generateImagePullSecret(),
-					Volumes:                       generateVolumes(namespace, serviceName, "business", pid),
+					Volumes:                       generateVolumes(namespace, serviceName, "business", pid, volumes),
 					TerminationGracePeriodSeconds: &graceTime,
 					InitContainers:                initContainers,
 					Containers: []corev1.Container{
@@ -119,10 +203,10 @@ func NewDeploy(pid int64, phase, username string) error {
 							Image:           serviceImage,
 							ImagePullPolicy: corev1.PullIfNotPresent,
 							Env:             generateEnvs(namespace, serviceName, phase),
-							EnvFrom:         generateEnvFroms(configMapName),
+							EnvFrom:         generateEnvFroms(configMapName, secretName),
 							SecurityContext: generateContainerSecurity(),
 							Resources:       generateResources(svc.QuotaCPU, svc.QuotaMaxCPU, svc.QuotaMem, svc.QuotaMaxMem),
-							VolumeMounts:    generateMainVolumeMounts(),
+							VolumeMounts:    generateMainVolumeMounts(volumes),
 							Lifecycle: &corev1.Lifecycle{
 								PreStop: &corev1.LifecycleHandler{
 									Exec: &corev1.ExecAction{
@@ -166,21 +250,11 @@ func NewDeploy(pid int64, phase, username string) error {
 			},
 		},
 	}
-
-	resource, err := k8s.New(namespace)
-	if err != nil {
-		return err
-	}
-	if err := resource.CreateOrUpdateDeployment(namespace, dep); err != nil {
-		return fmt.Errorf(config.PUB_K8S_DEPLOYMENT_EXEC_FAILED, err)
-	}
-	log.Infof("publish deployment: %s to k8s success", deploymentName)
-
-	if err := model.CreatePhase(pid, model.KIND_DEPLOY, phase, model.PHProcess); err != nil {
-		return fmt.Errorf(config.PUB_RECORD_DEPLOYMENT_TO_DB_ERROR, err)
+	scheduling.apply(&dep.Spec.Template.Spec)
+	if err := applyReleaseImage(pipeline, svc, &dep.Spec.Template.Spec); err != nil {
+		return nil, err
 	}
-	log.Infof("record deployment: %s to db success", deploymentName)
-	return nil
+	return dep, nil
 }
 
 func generateLabels(service, phase, deploymentName string) map[string]string {
@@ -191,37 +265,6 @@ func generateLabels(service, phase, deploymentName string) map[string]string {
 	}
 }
 
-// 同一deployment下的pod散列在不同node上
-func generateAffinity(deploymentName string) *corev1.Affinity {
-	return &corev1.Affinity{
-		PodAntiAffinity: &corev1.PodAntiAffinity{
-			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
-				{
-					Weight: 100,
-					PodAffinityTerm: corev1.PodAffinityTerm{
-						TopologyKey: "kubernetes.io/hostname",
-						LabelSelector: &metav1.LabelSelector{
-							MatchExpressions: []metav1.LabelSelectorRequirement{
-								{
-									Key:      "appid",
-									Operator: metav1.LabelSelectorOpIn,
-									Values:   []string{deploymentName},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-}
-
-func generateNodeSelector(zone string) map[string]string {
-	return map[string]string{
-		"aggregate": zone,
-	}
-}
-
 func generatePodSecurity() *corev1.PodSecurityContext {
 	return &corev1.PodSecurityContext{}
 }
@@ -240,37 +283,7 @@ func generateImagePullSecret() []corev1.LocalObjectReference {
 	}
 }
 
-func generateVolumes(namespace, service, category string, pid int64) []corev1.Volume {
-	// NOTE: 在宿主机上创建本地存储卷, 目前只支持hostPath-DirectoryOrCreate类型.
-	var (
-		pathType     = corev1.HostPathDirectoryOrCreate
-		codeHostPath = fmt.Sprintf("/home/code/%s/%s/%d", category, service, pid)
-		logHostPath  = fmt.Sprintf("/home/logs/%s/%s/%s", category, namespace, service)
-	)
-
-	return []corev1.Volume{
-		{
-			Name: CodeMountPoint,
-			VolumeSource: corev1.VolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Type: &pathType,
-					Path: codeHostPath,
-				},
-			},
-		},
-		{
-			Name: LogMountPoint,
-			VolumeSource: corev1.VolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Type: &pathType,
-					Path: logHostPath,
-				},
-			},
-		},
-	}
-}
-
-func generateInitContainers(pid int64) ([]corev1.Container, error) {
+func generateInitContainers(pid int64, volumes []VolumeSpec) ([]corev1.Container, error) {
 	var containers []corev1.Container
 
 	images, err := model.FindImages(pid)
@@ -287,12 +300,12 @@ func generateInitContainers(pid int64) ([]corev1.Container, error) {
 
 	for _, item := range images {
 		codeModule := strings.Replace(item.CodeModule, "_", "-", -1)
-		containers = append(containers, getInitContainer(codeModule, item.ImageURL, item.ImageTag))
+		containers = append(containers, getInitContainer(codeModule, item.ImageURL, item.ImageTag, volumes))
 	}
 	return containers, nil
 }
 
-func getInitContainer(module, imageURL, imageTag string) corev1.Container {
+func getInitContainer(module, imageURL, imageTag string, volumes []VolumeSpec) corev1.Container {
 	var (
 		lockFile = fmt.Sprintf("%s/%s_done", CodeMountPath, module)
 		cmd      = fmt.Sprintf("cp -rfp /code/* %[1]s; chown tong:tong %[1]s -R; touch %[2]s", CodeMountPath, lockFile)
@@ -313,20 +326,11 @@ func getInitContainer(module, imageURL, imageTag string) corev1.Container {
 				corev1.ResourceMemory: resource.MustParse("50Mi"),
 			},
 		},
-		VolumeMounts: generateInitVolumeMounts(),
+		VolumeMounts: generateInitVolumeMounts(volumes),
 		Command:      []string{"/bin/sh", "-c", safeCmd},
 	}
 }
 
-func generateInitVolumeMounts() []corev1.VolumeMount {
-	return []corev1.VolumeMount{
-		{
-			Name:      CodeMountPoint,
-			MountPath: CodeMountPath,
-		},
-	}
-}
-
 func generateEnvs(namespace, service, stage string) []corev1.EnvVar {
 	return []corev1.EnvVar{
 		{
@@ -360,7 +364,10 @@ func generateEnvs(namespace, service, stage string) []corev1.EnvVar {
 	}
 }
 
-func generateEnvFroms(configMapName string) []corev1.EnvFromSource {
+func generateEnvFroms(configMapName, secretName string) []corev1.EnvFromSource {
+	// 未配置secret的服务没有secret对象, 不能阻塞pod启动
+	optional := true
+
 	return []corev1.EnvFromSource{
 		{
 			ConfigMapRef: &corev1.ConfigMapEnvSource{
@@ -369,6 +376,14 @@ func generateEnvFroms(configMapName string) []corev1.EnvFromSource {
 				},
 			},
 		},
+		{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secretName,
+				},
+				Optional: &optional,
+			},
+		},
 	}
 }
 
@@ -406,15 +421,3 @@ func generateResources(minCPU, maxCPU, minMem, maxMem string) corev1.ResourceReq
 		},
 	}
 }
-
-func generateMainVolumeMounts() []corev1.VolumeMount {
-	var volumeMounts []corev1.VolumeMount
-
-	initMounts := generateInitVolumeMounts()
-	volumeMounts = append(volumeMounts, initMounts...)
-	volumeMounts = append(volumeMounts, corev1.VolumeMount{
-		Name:      LogMountPoint,
-		MountPath: LogMountPath,
-	})
-	return volumeMounts
-}
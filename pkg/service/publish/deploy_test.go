@@ -0,0 +1,191 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestNewDeploy(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_SANDBOX, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	sandbox := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_SANDBOX, k8s.BLUE)
+	if replicas := getReplicas(t, client, sandbox); replicas != 1 {
+		t.Errorf("sandbox replicas: %d want 1", replicas)
+	}
+
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *dep.Spec.Replicas != svc.Replicas {
+		t.Errorf("online replicas: %d want %d", *dep.Spec.Replicas, svc.Replicas)
+	}
+
+	spec := dep.Spec.Template.Spec
+	if len(spec.InitContainers) != 2 {
+		t.Errorf("init containers: %d want 2", len(spec.InitContainers))
+	}
+	if image := spec.Containers[0].Image; image != svc.ImageAddr {
+		t.Errorf("container image: %s want %s", image, svc.ImageAddr)
+	}
+	if pool := spec.NodeSelector[NodePoolLabel]; pool != DefaultNodePool {
+		t.Errorf("deployment node pool: %s want %s", pool, DefaultNodePool)
+	}
+
+	ph, err := model.GetPhaseInfo(pipeline.ID, model.KIND_DEPLOY, model.PHASE_ONLINE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ph.Status != model.PHProcess {
+		t.Errorf("online phase status: %d want %d", ph.Status, model.PHProcess)
+	}
+}
+
+func TestNewDeployFinishedPipeline(t *testing.T) {
+	setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLSuccess)
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err == nil {
+		t.Fatal("deploy finished pipeline should fail")
+	}
+}
+
+func TestNewDeployKeepsForeignFields(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟人工修改: 增加注解
+	name := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep.Annotations = map[string]string{"owner": "operator"}
+	if _, err := client.AppsV1().Deployments(testNamespace).Update(context.TODO(), dep, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	dep, err = client.AppsV1().Deployments(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dep.Annotations["owner"] != "operator" {
+		t.Errorf("annotation set by others was wiped: %v", dep.Annotations)
+	}
+
+	// 只通过apply提交, 不再整体覆盖对象
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok && patch.GetPatchType() != types.ApplyPatchType {
+			t.Errorf("unexpected patch type: %s", patch.GetPatchType())
+		}
+	}
+}
+
+func TestNewDeployApplyConflict(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	name := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	createDeployment(t, client, name, 3)
+
+	// 模拟apiserver: spec.replicas由其他管理者持有, 非force的apply返回冲突
+	applies := 0
+	client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType || patch.GetName() != name {
+			return false, nil, nil
+		}
+		applies++
+		causes := []metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Field:   ".spec.replicas",
+			Message: `conflict with "kubectl-scale"`,
+		}}
+		return true, nil, k8serrors.NewApplyConflict(causes, "Apply failed with 1 conflict")
+	})
+
+	err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester")
+	if err == nil {
+		t.Fatal("deploy with conflicting fields should fail")
+	}
+	if !strings.Contains(err.Error(), ".spec.replicas") {
+		t.Fatalf("conflict error should list fields: %s", err)
+	}
+	if applies != 1 {
+		t.Errorf("apply times: %d want 1, conflict should not be forced", applies)
+	}
+	if replicas := getReplicas(t, client, name); replicas != 3 {
+		t.Errorf("replicas: %d want 3", replicas)
+	}
+	if _, err := model.GetPhaseInfo(pipeline.ID, model.KIND_DEPLOY, model.PHASE_ONLINE); err == nil {
+		t.Error("phase should not be recorded when apply failed")
+	}
+}
+
+func TestNewDeployReplicasManagedByHPA(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	name := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	createDeployment(t, client, name, 5)
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.GetHPAName(testService, svc.ID, model.PHASE_ONLINE), Namespace: testNamespace},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: name},
+			MaxReplicas:    10,
+		},
+	}
+	if _, err := client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Create(context.TODO(), hpa, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if replicas := getReplicas(t, client, name); replicas != 5 {
+		t.Errorf("replicas: %d want 5, hpa managed replicas should be kept", replicas)
+	}
+
+	// nautilus的apply不再声明spec.replicas, 副本数由过渡管理者按当前值声明
+	for _, action := range client.Actions() {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType || patch.GetName() != name {
+			continue
+		}
+		if strings.Contains(string(patch.GetPatch()), `"template"`) && strings.Contains(string(patch.GetPatch()), `"replicas"`) {
+			t.Errorf("deployment apply should not contain replicas: %s", patch.GetPatch())
+		}
+	}
+}
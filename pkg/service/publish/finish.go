@@ -16,6 +16,15 @@ import (
 )
 
 func NewFinish(pid int64, serviceName string) error {
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
+	}
+
+	if err := checkLock(serviceName, pid, pipeline.Creator); err != nil {
+		return err
+	}
+
 	if err := model.CreatePhase(pid, model.KIND_DEPLOY, model.PHASE_FINISH, model.PHProcess); err != nil {
 		return fmt.Errorf(config.FSH_CREATE_FINISH_PHASE_ERROR, err)
 	}
@@ -32,13 +41,17 @@ func NewFinish(pid int64, serviceName string) error {
 		onlineGroup = service.OnlineGroup
 	)
 
-	// 另一组缩成0
 	resource, err := k8s.New(namespace)
 	if err != nil {
 		return err
 	}
 
 	for _, phase := range []string{model.PHASE_SANDBOX, model.PHASE_ONLINE} {
+		// HPA先绑定到新的在线组, 再将另一组缩成0, 避免与HPA争抢副本数
+		if err := bindHPA(resource, service, phase, service.DeployGroup); err != nil {
+			return err
+		}
+
 		// 第一次上线
 		if onlineGroup == "" {
 			continue
@@ -50,6 +63,19 @@ func NewFinish(pid int64, serviceName string) error {
 			return err
 		}
 		log.Infof("old deployment: %s replicas scale 0 success", oldDeployment)
+
+		if err := deletePDB(resource, service, phase, onlineGroup); err != nil {
+			return err
+		}
+	}
+
+	// 部署组成为全量在线组, 定时任务改用该组部署时的配置
+	data, _, err := mergeConfig(serviceName, pinnedVersion(pipeline), model.PHASE_ONLINE)
+	if err != nil {
+		return err
+	}
+	if err := syncCronjobConfig(resource, service, data); err != nil {
+		return err
 	}
 
 	if err := model.UpdatePhase(pid, model.KIND_DEPLOY, model.PHASE_FINISH, model.PHSuccess); err != nil {
@@ -66,5 +92,5 @@ func NewFinish(pid int64, serviceName string) error {
 		return fmt.Errorf(config.FSH_UPDATE_ONLINE_GROUP_ERROR, err)
 	}
 	log.Infof("set current online group: %s deploy group: %s success", newOnlineGroup, newDeployGroup)
-	return nil
+	return releaseLock(serviceName, pid, pipeline.Creator)
 }
@@ -0,0 +1,60 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"testing"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestNewFinish(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	for _, phase := range []string{model.PHASE_SANDBOX, model.PHASE_ONLINE} {
+		createDeployment(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.BLUE), 3)
+		createDeployment(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.GREEN), 3)
+	}
+
+	if err := NewFinish(pipeline.ID, testService); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, phase := range []string{model.PHASE_SANDBOX, model.PHASE_ONLINE} {
+		if replicas := getReplicas(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.BLUE)); replicas != 0 {
+			t.Errorf("old %s group replicas: %d want 0", phase, replicas)
+		}
+		if replicas := getReplicas(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.GREEN)); replicas != 3 {
+			t.Errorf("new %s group replicas: %d want 3", phase, replicas)
+		}
+	}
+
+	current, err := model.GetServiceInfo(testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.OnlineGroup != k8s.GREEN || current.DeployGroup != k8s.BLUE {
+		t.Errorf("online group: %s deploy group: %s", current.OnlineGroup, current.DeployGroup)
+	}
+
+	finished, err := model.GetPipeline(pipeline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished.Status != model.PLSuccess {
+		t.Errorf("pipeline status: %d want %d", finished.Status, model.PLSuccess)
+	}
+
+	owner, err := QueryLock(testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != nil {
+		t.Errorf("service lock not released: %+v", owner)
+	}
+}
@@ -9,15 +9,20 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
 	"nautilus/pkg/util/cm"
+	"nautilus/pkg/util/metrics"
 )
 
-func NewBuildImage(pid int64, service string) error {
+// NewBuildImage 为上线单的变更模块构建code层镜像, 未变更的模块沿用最近一次成功上线的镜像.
+// 各模块按build.concurrency并发构建, 单独记录状态及输出; retry为true时只重试未成功的模块.
+// 服务为single构建方式时, 模块镜像完成后再构建包含全部模块代码的发布镜像.
+func NewBuildImage(pid int64, service string, retry bool) error {
 	pipeline, err := model.GetPipeline(pid)
 	if err != nil {
 		return fmt.Errorf(config.IMG_QUERY_PIPELINE_ERROR, err)
@@ -34,39 +39,94 @@ func NewBuildImage(pid int64, service string) error {
 		return fmt.Errorf(config.IMG_BUILD_FINISHED)
 	}
 
+	if err := checkLock(service, pid, pipeline.Creator); err != nil {
+		return err
+	}
+	stop := keepLock(service, pid, pipeline.Creator)
+	defer stop()
+
 	if err := model.CreatePhase(pid, model.KIND_DEPLOY, model.PHASE_IMAGE, model.PHProcess); err != nil {
 		log.Errorf("create pipeline: %d image phase error: %s", pid, err)
 		return err
 	}
+	// 重新构建时阶段可能已失败
+	if err := model.UpdatePhase(pid, model.KIND_DEPLOY, model.PHASE_IMAGE, model.PHProcess); err != nil {
+		log.Errorf("update pipeline: %d image phase error: %s", pid, err)
+	}
 
 	updateList, err := model.FindUpdateInfo(pid)
 	if err != nil {
 		return fmt.Errorf(config.IMG_QUERY_UPDATE_ERROR, err)
 	}
 
+	images, err := model.FindImages(pid)
+	if err != nil {
+		return fmt.Errorf(config.IMG_QUERY_IS_BUILD_ERROR, err)
+	}
+	built := make(map[string]bool)
+	for _, image := range images {
+		built[image.CodeModule] = image.Status == model.PISuccess
+	}
+
 	_, curPath, _, _ := runtime.Caller(1)
 	var (
 		mainPath   = filepath.Dir(filepath.Dir(filepath.Dir(curPath)))
 		scriptPath = filepath.Join(mainPath, "script")
 		changes    []string
 		retains    []string
+		modules    []string
+		packages   = make(map[string]string)
 	)
 
-	ws := NewWebsocket()
-	ws.IsCmdCall = true
 	for _, item := range updateList {
 		module := item.CodeModule
+		changes = append(changes, module)
+		if retry && built[module] {
+			log.Infof("pipeline: %d module: %s image already success, skip", pid, module)
+			continue
+		}
+
 		if err := model.CreateOrUpdatePipelineImage(pid, service, module, "", ""); err != nil {
 			return err
 		}
+		if err := model.UpdateImageStatus(pid, module, model.PIWait, ""); err != nil {
+			return err
+		}
+		modules = append(modules, module)
+		packages[module] = item.CodePkg
+	}
+
+	failed := buildModules(modules, func(module string) error {
+		if err := model.UpdateImageStatus(pid, module, model.PIProcess, ""); err != nil {
+			log.Errorf("update pipeline: %d module: %s image status error: %s", pid, module, err)
+		}
 
 		output := ""
-		param := fmt.Sprintf("%s/makeimg -s %s -m %s -p %s -i %d", scriptPath, service, module, item.CodePkg, pid)
+		param := fmt.Sprintf("%s/makeimg -s %s -m %s -p %s -i %d -c %s", scriptPath, service, module, packages[module], pid, buildDir(service, pid, module))
 		log.Infof("makeimg command: %s", param)
-		if err := ws.Realtime(param, &output); err != nil {
-			return fmt.Errorf(config.IMG_BUILD_FAILED)
+
+		ws := NewWebsocket()
+		ws.IsCmdCall = true
+		start := time.Now()
+		err := ws.Realtime(param, &output)
+		metrics.BuildDuration.WithLabelValues(service, module, "image", metrics.Result(err)).Observe(metrics.Since(start))
+
+		status := model.PISuccess
+		if err != nil {
+			status = model.PIFailed
+			err = fmt.Errorf("%s: %s", config.IMG_BUILD_FAILED, err)
+			output += err.Error() + "\n"
 		}
-		changes = append(changes, item.CodeModule)
+		if err := model.UpdateImageStatus(pid, module, status, tailLog(output)); err != nil {
+			log.Errorf("update pipeline: %d module: %s image status error: %s", pid, module, err)
+		}
+		return err
+	})
+	if err := failedModules(config.IMG_MODULES_FAILED, failed); err != nil {
+		if err := model.UpdatePhase(pid, model.KIND_DEPLOY, model.PHASE_IMAGE, model.PHFailed); err != nil {
+			log.Errorf("update pipeline: %d image phase error: %s", pid, err)
+		}
+		return err
 	}
 
 	// 获取未变更的模块(服务所有模块-当前变更的模块)
@@ -96,9 +156,26 @@ func NewBuildImage(pid int64, service string) error {
 		if err := model.CreateOrUpdatePipelineImage(pid, service, codeModule, imageURL, imageTag); err != nil {
 			return err
 		}
+		if err := model.UpdateImageStatus(pid, codeModule, model.PISuccess, ""); err != nil {
+			return err
+		}
 		log.Infof("build image pipeline: %d record latest module: %s image: %s:%s success", pid, codeModule, imageURL, imageTag)
 	}
 
+	// single构建方式将全部模块的代码与服务基础镜像构建为发布镜像
+	svc, err := model.GetServiceInfo(service)
+	if err != nil {
+		return fmt.Errorf(config.IMG_QUERY_SERVICE_ERROR, err)
+	}
+	if isSingleImage(svc) {
+		if err := buildRelease(pid, svc, scriptPath); err != nil {
+			if err := model.UpdatePhase(pid, model.KIND_DEPLOY, model.PHASE_IMAGE, model.PHFailed); err != nil {
+				log.Errorf("update pipeline: %d image phase error: %s", pid, err)
+			}
+			return err
+		}
+	}
+
 	if err := model.UpdatePhase(pid, model.KIND_DEPLOY, model.PHASE_IMAGE, model.PHSuccess); err != nil {
 		log.Errorf("update pipeline: %d image phase error: %s", pid, err)
 	}
@@ -0,0 +1,55 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"strings"
+	"testing"
+
+	"nautilus/pkg/model"
+)
+
+func TestRetryImageSkipsSuccess(t *testing.T) {
+	setup(t, "", "")
+	pipeline := createPipeline(t, model.PLProcess)
+	for _, module := range []string{"ivr", "ivr_ui"} {
+		mustInsert(t, &model.PipelineUpdate{PipelineID: pipeline.ID, CodeModule: module, CodePkg: module + ".tar.gz", TagStatus: model.PISuccess})
+	}
+	if err := model.UpdateImageStatus(pipeline.ID, "ivr_ui", model.PIFailed, "exit 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 测试环境下没有makeimg, 重试的模块构建失败
+	err := NewBuildImage(pipeline.ID, testService, true)
+	if err == nil || !strings.Contains(err.Error(), "ivr_ui(") || strings.Contains(err.Error(), "ivr(") {
+		t.Fatalf("retry image error: %v", err)
+	}
+
+	images, err := model.FindImages(pipeline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range images {
+		switch image.CodeModule {
+		case "ivr":
+			if image.Status != model.PISuccess || image.ImageTag != "v-1" {
+				t.Errorf("succeeded module should be skipped: %+v", image)
+			}
+		case "ivr_ui":
+			if image.Status != model.PIFailed || image.BuildLog == "" || image.ImageTag != "" {
+				t.Errorf("failed module should be retried: %+v", image)
+			}
+		}
+	}
+
+	phases, err := model.FindPhases(pipeline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(phases) != 1 || phases[0].Status != model.PHFailed {
+		t.Errorf("image phase: %+v", phases)
+	}
+}
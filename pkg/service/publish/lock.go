@@ -0,0 +1,77 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/util/lock"
+)
+
+// 长时间操作(打tag、构建镜像)期间的续期间隔
+const lockRenewInterval = 5 * time.Minute
+
+// checkLock 发布操作前统一的服务锁检查.
+// 上线单相关操作占用(或续期)服务锁; 其他操作(pid为0)只检查服务没有被其他人占用.
+func checkLock(service string, pid int64, username string) error {
+	owner := lock.Owner{Pipeline: pid, User: username}
+	if pid == 0 {
+		current, err := lock.Default().Get(service)
+		if err != nil {
+			return fmt.Errorf(config.LOCK_QUERY_ERROR, err)
+		}
+		if current != nil && current.Key() != owner.Key() {
+			return &lock.LockedError{Service: service, Owner: *current}
+		}
+		return nil
+	}
+
+	if err := lock.Default().Acquire(service, owner); err != nil {
+		var locked *lock.LockedError
+		if errors.As(err, &locked) {
+			return err
+		}
+		return fmt.Errorf(config.DB_WRITE_LOCK_ERROR, pid, err)
+	}
+	return nil
+}
+
+// keepLock 长时间操作期间保持服务锁, 返回停止续期的函数
+func keepLock(service string, pid int64, username string) func() {
+	return lock.KeepAlive(service, lock.Owner{Pipeline: pid, User: username}, lockRenewInterval)
+}
+
+// releaseLock 上线单结束时释放服务锁
+func releaseLock(service string, pid int64, username string) error {
+	if err := lock.Default().Release(service, lock.Owner{Pipeline: pid, User: username}); err != nil {
+		return fmt.Errorf(config.DB_RELEASE_LOCK_ERROR, pid, err)
+	}
+	log.Infof("service: %s lock released by pipeline: %d", service, pid)
+	return nil
+}
+
+// QueryLock 查询服务锁的持有者, 未占用时返回nil
+func QueryLock(service string) (*lock.Owner, error) {
+	owner, err := lock.Default().Get(service)
+	if err != nil {
+		return nil, fmt.Errorf(config.LOCK_QUERY_ERROR, err)
+	}
+	return owner, nil
+}
+
+// ForceUnlock 强制解锁, 并记录操作人和原因
+func ForceUnlock(service, operator, reason string) (*lock.Owner, error) {
+	owner, err := lock.Default().ForceUnlock(service, operator, reason)
+	if err != nil {
+		return nil, fmt.Errorf(config.LOCK_FORCE_UNLOCK_FAIL, err)
+	}
+	return owner, nil
+}
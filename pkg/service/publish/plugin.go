@@ -0,0 +1,197 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/vcs"
+)
+
+const (
+	BuildFile             = ".nautilus.yaml"  // 代码仓库根目录下的构建文件, 可选
+	DefaultCodeImage      = "alpine:3.7"      // 代码层默认基础镜像, 只需提供sh、cp供init容器拷贝代码
+	DefaultBuildPlugin    = "default"         // 未知语言不编译, 直接打包整个模块
+	DefaultBuildWorkspace = "/tmp/code/build" // 未配置build.workspace时的构建脚本目录
+)
+
+// BuildConfig 模块的构建配置, 构建插件提供默认值, 仓库中的构建文件可逐项覆盖
+type BuildConfig struct {
+	Plugin    string   `yaml:"plugin" json:"plugin"`       // 构建插件, 为空时按模块语言选择
+	Image     string   `yaml:"image" json:"image"`         // 代码层基础镜像
+	Command   []string `yaml:"command" json:"command"`     // 编译命令, 在模块根目录依次执行
+	Output    string   `yaml:"output" json:"output"`       // 编译产物目录, 相对模块根目录
+	Artifacts []string `yaml:"artifacts" json:"artifacts"` // 打包的文件, 相对产物目录, 支持通配符; 为空时打包整个产物目录
+}
+
+// buildPlugins 构建插件, 按插件名注册; buildLanguages 模块语言到插件名的映射
+var (
+	buildPlugins   = make(map[string]BuildConfig)
+	buildLanguages = make(map[string]string)
+)
+
+// RegisterBuildPlugin 注册构建插件, languages为使用该插件的模块语言
+func RegisterBuildPlugin(plugin BuildConfig, languages ...string) {
+	buildPlugins[plugin.Plugin] = plugin
+	for _, language := range append(languages, plugin.Plugin) {
+		buildLanguages[language] = plugin.Plugin
+	}
+}
+
+func init() {
+	RegisterBuildPlugin(BuildConfig{Plugin: DefaultBuildPlugin, Output: "."})
+	RegisterBuildPlugin(BuildConfig{Plugin: "go", Command: []string{"make"}, Output: "."}, "golang")
+	RegisterBuildPlugin(BuildConfig{Plugin: "maven", Command: []string{"mvn -B -DskipTests package"}, Output: "target", Artifacts: []string{"*.jar"}}, "java")
+	RegisterBuildPlugin(BuildConfig{Plugin: "gradle", Command: []string{"gradle build -x test"}, Output: "build/libs", Artifacts: []string{"*.jar"}})
+	RegisterBuildPlugin(BuildConfig{Plugin: "python", Output: "."}, "py")
+	RegisterBuildPlugin(BuildConfig{Plugin: "conda", Command: []string{"conda env create -p ./env -f environment.yml"}, Output: "."})
+	RegisterBuildPlugin(BuildConfig{Plugin: "node", Command: []string{"npm ci", "npm run build"}, Output: "dist"}, "js", "nodejs", "javascript")
+}
+
+// 产物路径只允许普通字符及通配符, 生成脚本时不做转义
+var artifactPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-/*?\[\]]+$`)
+
+// resolveBuild 读取分支上的构建文件, 与模块语言对应的插件合并为最终的构建配置
+func resolveBuild(codeModule *model.CodeModule, branch string) (*BuildConfig, error) {
+	repo, err := vcs.New(codeModule.RepoName)
+	if err != nil {
+		return nil, fmt.Errorf(config.TAG_BUILD_FILE_ERROR, codeModule.Name, err)
+	}
+
+	content, err := repo.ReadFile(codeModule.RepoAddr, branch, BuildFile)
+	if errors.Is(err, vcs.ErrNotExist) {
+		content = nil
+	} else if err != nil {
+		return nil, fmt.Errorf(config.TAG_BUILD_FILE_ERROR, codeModule.Name, err)
+	}
+
+	build, err := parseBuildConfig(codeModule.Language, content)
+	if err != nil {
+		return nil, fmt.Errorf(config.TAG_BUILD_FILE_INVALID, codeModule.Name, err)
+	}
+	return build, nil
+}
+
+func parseBuildConfig(language string, content []byte) (*BuildConfig, error) {
+	file := new(BuildConfig)
+	if err := yaml.UnmarshalStrict(content, file); err != nil {
+		return nil, err
+	}
+
+	name := file.Plugin
+	if name == "" {
+		name = buildLanguages[strings.ToLower(language)]
+	}
+	if name == "" {
+		name = DefaultBuildPlugin
+	}
+	plugin, ok := buildPlugins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown plugin: %s", name)
+	}
+
+	build := plugin
+	build.Image = DefaultCodeImage
+	if file.Image != "" {
+		build.Image = file.Image
+	}
+	// 构建文件中command: []表示不编译
+	if file.Command != nil {
+		build.Command = file.Command
+	}
+	if file.Output != "" {
+		build.Output = file.Output
+	}
+	if file.Artifacts != nil {
+		build.Artifacts = file.Artifacts
+	}
+
+	if err := validateBuildConfig(&build); err != nil {
+		return nil, err
+	}
+	return &build, nil
+}
+
+func validateBuildConfig(build *BuildConfig) error {
+	if strings.ContainsAny(build.Image, " \t\n") {
+		return fmt.Errorf("invalid image: %s", build.Image)
+	}
+	for _, command := range build.Command {
+		if strings.TrimSpace(command) == "" || strings.Contains(command, "\n") {
+			return fmt.Errorf("command must be a single line: %q", command)
+		}
+	}
+	for _, item := range append([]string{build.Output}, build.Artifacts...) {
+		if !artifactPattern.MatchString(item) || path.IsAbs(item) || strings.HasPrefix(path.Clean(item), "..") {
+			return fmt.Errorf("invalid path: %s", item)
+		}
+	}
+	return nil
+}
+
+// buildDir 上线单中模块的构建脚本、Dockerfile目录, maketag、makeimg通过-c读取
+func buildDir(service string, pid int64, module string) string {
+	workspace := config.Config().Build.Workspace
+	if workspace == "" {
+		workspace = DefaultBuildWorkspace
+	}
+	return filepath.Join(workspace, service, strconv.FormatInt(pid, 10), module)
+}
+
+// writeBuildFiles 生成编译脚本build.sh及代码层Dockerfile
+func writeBuildFiles(dir, module string, build *BuildConfig) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf(config.TAG_BUILD_WRITE_ERROR, module, err)
+	}
+
+	files := map[string]string{
+		"build.sh":   renderBuildScript(module, build),
+		"Dockerfile": renderDockerfile(build),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			return fmt.Errorf(config.TAG_BUILD_WRITE_ERROR, module, err)
+		}
+	}
+	log.Infof("write module: %s build files to: %s with plugin: %s", module, dir, build.Plugin)
+	return nil
+}
+
+// renderBuildScript 参数: 模块源码目录 产物拷贝目录
+func renderBuildScript(module string, build *BuildConfig) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	fmt.Fprintf(&b, "# 模块: %s 构建插件: %s, 由nautilus生成\n", module, build.Plugin)
+	// 执行时输出每条命令
+	b.WriteString("set -ex\n\nsrc=$1\ndest=$2\n\ncd \"$src\"\n")
+	for _, command := range build.Command {
+		b.WriteString(command + "\n")
+	}
+
+	fmt.Fprintf(&b, "\ncd \"$src\"/%s\nmkdir -p \"$dest\"\n", build.Output)
+	if len(build.Artifacts) == 0 {
+		b.WriteString("cp -rp . \"$dest\"/\n")
+	} else {
+		fmt.Fprintf(&b, "cp -rp %s \"$dest\"/\n", strings.Join(build.Artifacts, " "))
+	}
+	return b.String()
+}
+
+func renderDockerfile(build *BuildConfig) string {
+	return fmt.Sprintf("FROM %s\n\nARG module\n\nADD ./${module} /code/${module}\n", build.Image)
+}
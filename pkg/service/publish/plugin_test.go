@@ -0,0 +1,57 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPlugin(t *testing.T) {
+	build, err := parseBuildConfig("java", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.Plugin != "maven" || build.Output != "target" || build.Image != DefaultCodeImage {
+		t.Errorf("java default build: %+v", build)
+	}
+
+	build, err = parseBuildConfig("unknown", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.Plugin != DefaultBuildPlugin || len(build.Command) != 0 {
+		t.Errorf("unknown language build: %+v", build)
+	}
+
+	file := []byte("plugin: gradle\nimage: registry.local/base/jre:8\nartifacts: [app.jar, conf]\n")
+	build, err = parseBuildConfig("java", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if build.Plugin != "gradle" || build.Output != "build/libs" || build.Image != "registry.local/base/jre:8" {
+		t.Errorf("build file override: %+v", build)
+	}
+
+	script := renderBuildScript("ivr", build)
+	if !strings.Contains(script, "gradle build -x test\n") || !strings.Contains(script, `cp -rp app.jar conf "$dest"/`) {
+		t.Errorf("build script: %s", script)
+	}
+	if dockerfile := renderDockerfile(build); !strings.HasPrefix(dockerfile, "FROM registry.local/base/jre:8\n") {
+		t.Errorf("dockerfile: %s", dockerfile)
+	}
+
+	for _, content := range []string{
+		"plugin: ant\n",
+		"output: ../etc\n",
+		"artifacts: ['app.jar; rm -rf /']\n",
+		"unknown: true\n",
+	} {
+		if _, err := parseBuildConfig("java", []byte(content)); err == nil {
+			t.Errorf("build file: %q should be rejected", content)
+		}
+	}
+}
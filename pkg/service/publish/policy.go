@@ -0,0 +1,209 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+const (
+	ZoneTopologyKey = "topology.kubernetes.io/zone" // 可用区打散
+	NodeTopologyKey = "kubernetes.io/hostname"      // 节点打散
+)
+
+// SetPolicy 保存服务的调度与中断策略. 打散策略在下次部署时生效, PDB立即作用于当前在线组.
+func SetPolicy(policy *model.ServicePolicy) error {
+	if err := validatePolicy(policy); err != nil {
+		return err
+	}
+
+	if err := checkLock(policy.Service, 0, ""); err != nil {
+		return err
+	}
+
+	svc, err := model.GetServiceInfo(policy.Service)
+	if err != nil {
+		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	if err := model.SavePolicy(policy); err != nil {
+		return fmt.Errorf(config.POL_SAVE_ERROR, err)
+	}
+	log.Infof("save service: %s policy success", svc.Name)
+
+	if svc.OnlineGroup == "" {
+		return nil
+	}
+
+	resource, err := k8s.New(svc.Namespace)
+	if err != nil {
+		return err
+	}
+	return applyPDB(resource, svc, model.PHASE_ONLINE, svc.OnlineGroup)
+}
+
+// QueryPolicy 查询服务的调度与中断策略, 未配置时返回默认策略
+func QueryPolicy(service string) (*model.ServicePolicy, error) {
+	return getPolicy(service)
+}
+
+func getPolicy(service string) (*model.ServicePolicy, error) {
+	policy, err := model.GetPolicy(service)
+	if errors.Is(err, model.NotFound) {
+		// 默认只按节点尽量打散, 与原pod反亲和一致
+		return &model.ServicePolicy{Service: service, NodeMaxSkew: 1}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf(config.POL_QUERY_ERROR, err)
+	}
+	return policy, nil
+}
+
+func validatePolicy(policy *model.ServicePolicy) error {
+	if policy.MinAvailable != "" && policy.MaxUnavailable != "" {
+		return fmt.Errorf(config.POL_PDB_CONFLICT)
+	}
+
+	for _, value := range []string{policy.MinAvailable, policy.MaxUnavailable} {
+		if value == "" {
+			continue
+		}
+		if _, err := parseIntOrPercent(value); err != nil {
+			return fmt.Errorf(config.POL_PDB_VALUE_INVALID, value)
+		}
+	}
+
+	if policy.ZoneMaxSkew < 0 || policy.NodeMaxSkew < 0 {
+		return fmt.Errorf(config.POL_SKEW_INVALID)
+	}
+	return nil
+}
+
+func parseIntOrPercent(value string) (intstr.IntOrString, error) {
+	number := strings.TrimSuffix(value, "%")
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return intstr.IntOrString{}, fmt.Errorf("invalid value: %s", value)
+	}
+	if number != value {
+		return intstr.FromString(value), nil
+	}
+	return intstr.FromInt(n), nil
+}
+
+// generateTopologySpread 按可用区、节点打散同一deployment下的pod
+func generateTopologySpread(policy *model.ServicePolicy, deploymentName string) []corev1.TopologySpreadConstraint {
+	var constraints []corev1.TopologySpreadConstraint
+
+	spread := func(key string, maxSkew int32, hard bool) corev1.TopologySpreadConstraint {
+		when := corev1.ScheduleAnyway
+		if hard {
+			when = corev1.DoNotSchedule
+		}
+		return corev1.TopologySpreadConstraint{
+			MaxSkew:           maxSkew,
+			TopologyKey:       key,
+			WhenUnsatisfiable: when,
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"appid": deploymentName,
+				},
+			},
+		}
+	}
+
+	if policy.ZoneMaxSkew > 0 {
+		constraints = append(constraints, spread(ZoneTopologyKey, policy.ZoneMaxSkew, policy.ZoneHard))
+	}
+	if policy.NodeMaxSkew > 0 {
+		constraints = append(constraints, spread(NodeTopologyKey, policy.NodeMaxSkew, policy.NodeHard))
+	}
+	return constraints
+}
+
+// applyPDB 为在线阶段指定组的deployment创建PDB, 名称与deployment一致; 未配置PDB时删除
+func applyPDB(resource k8s.Resource, svc *model.Service, phase, group string) error {
+	// 沙盒只有少量副本, PDB会阻塞节点驱逐
+	if phase != model.PHASE_ONLINE {
+		return nil
+	}
+
+	policy, err := getPolicy(svc.Name)
+	if err != nil {
+		return err
+	}
+
+	name := k8s.GetDeploymentName(svc.Name, svc.ID, phase, group)
+	if policy.MinAvailable == "" && policy.MaxUnavailable == "" {
+		return deletePDB(resource, svc, phase, group)
+	}
+
+	pdb := renderPDB(svc.Namespace, name, policy)
+	if err := resource.CreateOrUpdatePDB(svc.Namespace, pdb); err != nil {
+		return fmt.Errorf(config.POL_K8S_PDB_EXEC_FAIL, name, err)
+	}
+	log.Infof("apply pdb: %s success", name)
+	return nil
+}
+
+// deletePDB 删除指定组deployment的PDB, 与deployment缩成0同时进行
+func deletePDB(resource k8s.Resource, svc *model.Service, phase, group string) error {
+	if phase != model.PHASE_ONLINE {
+		return nil
+	}
+
+	name := k8s.GetDeploymentName(svc.Name, svc.ID, phase, group)
+	if err := resource.DeletePDB(svc.Namespace, name); err != nil {
+		return fmt.Errorf(config.POL_K8S_PDB_EXEC_FAIL, name, err)
+	}
+	log.Infof("delete pdb: %s success", name)
+	return nil
+}
+
+func renderPDB(namespace, deploymentName string, policy *model.ServicePolicy) *policyv1.PodDisruptionBudget {
+	pdb := &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "policy/v1",
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"appid": deploymentName,
+			},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"appid": deploymentName,
+				},
+			},
+		},
+	}
+
+	// 已校验过格式
+	if policy.MinAvailable != "" {
+		value, _ := parseIntOrPercent(policy.MinAvailable)
+		pdb.Spec.MinAvailable = &value
+	} else {
+		value, _ := parseIntOrPercent(policy.MaxUnavailable)
+		pdb.Spec.MaxUnavailable = &value
+	}
+	return pdb
+}
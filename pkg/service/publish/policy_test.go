@@ -0,0 +1,100 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestPolicyFollowsOnlineGroup(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	blue, green := createGroups(t, client, svc, 3)
+
+	policy := &model.ServicePolicy{
+		Service:      testService,
+		MinAvailable: "50%",
+		ZoneMaxSkew:  1,
+		ZoneHard:     true,
+		NodeMaxSkew:  2,
+	}
+	if err := SetPolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	pdbExists := func(name string) bool {
+		t.Helper()
+		pdb, err := client.PolicyV1().PodDisruptionBudgets(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return false
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if pdb.Spec.MinAvailable.String() != "50%" || pdb.Spec.Selector.MatchLabels["appid"] != name {
+			t.Fatalf("pdb: %s spec: %+v", name, pdb.Spec)
+		}
+		return true
+	}
+	if !pdbExists(blue) {
+		t.Fatalf("pdb: %s not created for online group", blue)
+	}
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if !pdbExists(green) {
+		t.Fatalf("pdb: %s not created with deployment", green)
+	}
+
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), green, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spread := dep.Spec.Template.Spec.TopologySpreadConstraints
+	if len(spread) != 2 || dep.Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("topology spread: %+v affinity: %+v", spread, dep.Spec.Template.Spec.Affinity)
+	}
+	if spread[0].TopologyKey != ZoneTopologyKey || spread[0].WhenUnsatisfiable != "DoNotSchedule" {
+		t.Errorf("zone spread: %+v", spread[0])
+	}
+	if spread[1].TopologyKey != NodeTopologyKey || spread[1].MaxSkew != 2 || spread[1].WhenUnsatisfiable != "ScheduleAnyway" {
+		t.Errorf("node spread: %+v", spread[1])
+	}
+
+	finishOnline(t, pipeline.ID)
+	if pdbExists(blue) {
+		t.Errorf("pdb: %s not deleted after finish", blue)
+	}
+
+	if err := NewRollback(pipeline.ID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if !pdbExists(blue) || pdbExists(green) {
+		t.Errorf("pdb not moved to rollback group")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	cases := []model.ServicePolicy{
+		{MinAvailable: "1", MaxUnavailable: "1"},
+		{MinAvailable: "abc"},
+		{MaxUnavailable: "-1"},
+		{NodeMaxSkew: -1},
+	}
+	for i := range cases {
+		if err := validatePolicy(&cases[i]); err == nil {
+			t.Errorf("case %d: %+v should be invalid", i, cases[i])
+		}
+	}
+}
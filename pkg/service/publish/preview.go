@@ -0,0 +1,295 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"errors"
+	"fmt"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/cm"
+	"nautilus/pkg/util/k8s"
+)
+
+// 对比结果
+const (
+	DiffCreate    = "create"    // 线上不存在, 将新建
+	DiffUpdate    = "update"    // 线上存在且有差异
+	DiffUnchanged = "unchanged" // 线上存在且无差异
+	DiffDelete    = "delete"    // 线上存在, 将删除
+)
+
+// Manifest 发布前预览的资源对象
+type Manifest struct {
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	Object    runtime.Object `json:"object"`           // 渲染后的完整对象
+	YAML      string         `json:"yaml"`             // 渲染后的yaml
+	Status    string         `json:"status,omitempty"` // diff模式下的对比结果
+	Diff      string         `json:"diff,omitempty"`   // diff模式下与线上对象的unified diff
+}
+
+// liveGetter 通过k8s.Resource获取线上对象
+type liveGetter func(resource k8s.Resource) (runtime.Object, error)
+
+// PreviewDeploy 预览上线单在指定阶段部署时提交的对象: configmap、deployment及全量阶段的PDB.
+// 与部署一致, HPA管理该deployment时不声明副本数. HPA在确认完成时绑定, secret在保存时发布, 部署不修改这两类对象.
+func PreviewDeploy(pid int64, phase string, diff bool) ([]*Manifest, error) {
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
+	}
+
+	svc, err := model.GetServiceInfo(pipeline.Service)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	configMap, _, err := renderDeployConfigMap(pipeline, svc, phase)
+	if err != nil {
+		return nil, err
+	}
+
+	dep, err := renderDeployment(pipeline, svc, phase, configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	cmManifest, err := preview(configMap, diff, func(resource k8s.Resource) (runtime.Object, error) {
+		return resource.GetConfigMap(configMap.Namespace, configMap.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resource, err := k8s.New(svc.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if managed, err := managedByHPA(resource, svc, phase, dep); err != nil {
+		return nil, err
+	} else if managed {
+		dep.Spec.Replicas = nil
+	}
+
+	depManifest, err := preview(dep, diff, func(resource k8s.Resource) (runtime.Object, error) {
+		return resource.GetDeployment(dep.Namespace, dep.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifests := []*Manifest{cmManifest, depManifest}
+
+	pdbManifest, err := previewPDB(resource, svc, phase, dep.Name, diff)
+	if err != nil {
+		return nil, err
+	}
+	if pdbManifest != nil {
+		manifests = append(manifests, pdbManifest)
+	}
+	return manifests, nil
+}
+
+// previewPDB 与applyPDB一致: 全量阶段配置了PDB时预览PDB, 未配置时线上已有的PDB将被删除
+func previewPDB(resource k8s.Resource, svc *model.Service, phase, name string, diff bool) (*Manifest, error) {
+	if phase != model.PHASE_ONLINE {
+		return nil, nil
+	}
+
+	policy, err := getPolicy(svc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if policy.MinAvailable != "" || policy.MaxUnavailable != "" {
+		pdb := renderPDB(svc.Namespace, name, policy)
+		return preview(pdb, diff, func(resource k8s.Resource) (runtime.Object, error) {
+			return resource.GetPDB(pdb.Namespace, pdb.Name)
+		})
+	}
+
+	if !diff {
+		return nil, nil
+	}
+	if _, err := resource.GetPDB(svc.Namespace, name); k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf(config.PRE_FETCH_LIVE_ERROR, name, err)
+	}
+	return &Manifest{Kind: "PodDisruptionBudget", Namespace: svc.Namespace, Name: name, Status: DiffDelete}, nil
+}
+
+// Preview 预览服务在各阶段、各部署组将要发布的service
+func (s *Service) Preview(serviceName string, diff bool) ([]*Manifest, error) {
+	svc, err := model.GetServiceInfo(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	var manifests []*Manifest
+	for _, phase := range []string{model.PHASE_SANDBOX, model.PHASE_ONLINE} {
+		for _, group := range []string{k8s.BLUE, k8s.GREEN} {
+			se := renderService(svc.Namespace, serviceName, svc.ID, phase, group, svc.Port, svc.ContainerPort)
+			m, err := preview(se, diff, func(resource k8s.Resource) (runtime.Object, error) {
+				return resource.GetService(se.Namespace, se.Name)
+			})
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, m)
+		}
+	}
+	return manifests, nil
+}
+
+// PreviewConfigMap 预览配置修改后各阶段合并的configmap, 与在线组(第一次上线前为部署组)当前的configmap对比.
+// phase为空表示修改公共配置, 预览全部阶段.
+func PreviewConfigMap(namespace, service, phase string, data map[string]string, diff bool) ([]*Manifest, error) {
+	if !cm.In(phase, []string{model.CONFIG_BASE, model.PHASE_SANDBOX, model.PHASE_ONLINE}) {
+		return nil, fmt.Errorf(config.CM_PHASE_INVALID, phase)
+	}
+
+	svc, err := model.GetServiceInfo(service)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+
+	group := svc.OnlineGroup
+	if group == "" {
+		group = svc.DeployGroup
+	}
+
+	phases := []string{phase}
+	if phase == model.CONFIG_BASE {
+		phases = []string{model.PHASE_SANDBOX, model.PHASE_ONLINE}
+	}
+
+	base := data
+	if phase != model.CONFIG_BASE {
+		if base, err = latestConfig(service, model.CONFIG_BASE); err != nil {
+			return nil, err
+		}
+	}
+
+	var manifests []*Manifest
+	for _, target := range phases {
+		override := data
+		if target != phase {
+			if override, err = latestConfig(service, target); err != nil {
+				return nil, err
+			}
+		}
+
+		name := k8s.GetDeploymentName(svc.Name, svc.ID, target, group)
+		configMap := renderConfigMap(namespace, name, mergeData(base, override))
+		m, err := preview(configMap, diff, func(resource k8s.Resource) (runtime.Object, error) {
+			return resource.GetConfigMap(configMap.Namespace, configMap.Name)
+		})
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// PreviewCronjob 预览将要发布的定时任务. 服务已有相同命令的定时任务时与其对比, 便于确认与已有任务的差异,
+// 否则任务ID以0占位. 只在预览时按命令查找, 创建定时任务总是新建.
+func PreviewCronjob(namespace, service, command, schedule string, scheduling *model.Scheduling, diff bool) ([]*Manifest, error) {
+	if scheduling == nil {
+		scheduling = new(model.Scheduling)
+	}
+	spec, err := parseScheduling(scheduling, CronjobNodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	var crontabID int64
+	if crontab, err := model.GetCrontabByCommand(namespace, service, command); err == nil {
+		crontabID = crontab.ID
+	} else if !errors.Is(err, model.NotFound) {
+		return nil, fmt.Errorf(config.CRON_QUERY_DB_ERROR, err)
+	}
+
+	cronJob, err := renderCronjob(namespace, service, command, schedule, crontabID, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := preview(cronJob, diff, func(resource k8s.Resource) (runtime.Object, error) {
+		return resource.GetCronJob(cronJob.Namespace, cronJob.Name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []*Manifest{m}, nil
+}
+
+// preview 渲染对象, diff模式下再与线上对象对比
+func preview(obj runtime.Object, diff bool, getter liveGetter) (*Manifest, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		kind      = obj.GetObjectKind().GroupVersionKind().Kind
+		namespace = accessor.GetNamespace()
+		name      = accessor.GetName()
+	)
+
+	content, err := k8s.ToYAML(obj)
+	if err != nil {
+		return nil, fmt.Errorf(config.PRE_RENDER_YAML_ERROR, name, err)
+	}
+
+	m := &Manifest{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Object:    obj,
+		YAML:      content,
+	}
+	if !diff {
+		return m, nil
+	}
+
+	resource, err := k8s.New(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var liveContent string
+	live, err := getter(resource)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			return nil, fmt.Errorf(config.PRE_FETCH_LIVE_ERROR, name, err)
+		}
+		m.Status = DiffCreate
+	} else {
+		// 线上对象不携带apiVersion、kind, 与渲染对象保持一致; 只对比渲染对象声明的字段
+		live.GetObjectKind().SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+		if liveContent, err = k8s.ToDeclaredYAML(live, obj); err != nil {
+			return nil, fmt.Errorf(config.PRE_RENDER_YAML_ERROR, name, err)
+		}
+	}
+
+	if m.Diff, err = k8s.Diff(liveContent, content); err != nil {
+		return nil, fmt.Errorf(config.PRE_DIFF_ERROR, name, err)
+	}
+	if m.Status == "" {
+		m.Status = DiffUpdate
+		if m.Diff == "" {
+			m.Status = DiffUnchanged
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,195 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestPreviewDeploy(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	manifests, err := PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[0]; m.Kind != "ConfigMap" || m.Status != DiffCreate {
+		t.Fatalf("preview kind: %s status: %s", m.Kind, m.Status)
+	}
+	if m := manifests[1]; m.Kind != "Deployment" || m.Status != DiffCreate {
+		t.Fatalf("preview kind: %s status: %s", m.Kind, m.Status)
+	}
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err = PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[1]; m.Status != DiffUnchanged {
+		t.Fatalf("preview status: %s diff: %s", m.Status, m.Diff)
+	}
+
+	// 模拟apiserver填充的默认值、managedFields及其他管理者的字段, 这些字段apply不会改变
+	name := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := int32(10)
+	dep.Spec.RevisionHistoryLimit = &history
+	dep.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+	dep.Spec.Template.Spec.DNSPolicy = corev1.DNSClusterFirst
+	dep.Annotations = map[string]string{"deployment.kubernetes.io/revision": "1"}
+	dep.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: k8s.FieldManager, Operation: metav1.ManagedFieldsOperationApply}}
+	if _, err := client.AppsV1().Deployments(testNamespace).Update(context.TODO(), dep, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err = PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[1]; m.Status != DiffUnchanged {
+		t.Fatalf("preview with server defaults status: %s diff: %s", m.Status, m.Diff)
+	}
+
+	svc.Replicas = 5
+	if _, err := model.MEngine.ID(svc.ID).Cols("replicas").Update(svc); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err = PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[1]; m.Status != DiffUpdate || !strings.Contains(m.Diff, "+  replicas: 5") {
+		t.Fatalf("preview status: %s diff: %s", m.Status, m.Diff)
+	}
+
+	// dry_run模式不记录阶段
+	if _, err := PreviewDeploy(pipeline.ID, model.PHASE_SANDBOX, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := model.GetPhaseInfo(pipeline.ID, model.KIND_DEPLOY, model.PHASE_SANDBOX); err == nil {
+		t.Fatal("dry run should not record phase")
+	}
+}
+
+func TestPreviewDeployPolicy(t *testing.T) {
+	client, svc := setup(t, k8s.BLUE, k8s.GREEN)
+	pipeline := createPipeline(t, model.PLProcess)
+	_, green := createGroups(t, client, svc, 3)
+
+	if err := SetPolicy(&model.ServicePolicy{Service: testService, MinAvailable: "50%"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 部署时同时提交部署组的PDB
+	manifests, err := PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 3 {
+		t.Fatalf("preview manifests: %d want 3", len(manifests))
+	}
+	if m := manifests[2]; m.Kind != "PodDisruptionBudget" || m.Name != green || m.Status != DiffCreate {
+		t.Fatalf("preview kind: %s name: %s status: %s", m.Kind, m.Name, m.Status)
+	}
+
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err = PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[2]; m.Status != DiffUnchanged {
+		t.Fatalf("preview pdb status: %s diff: %s", m.Status, m.Diff)
+	}
+
+	// 去掉PDB配置后, 部署会删除部署组的PDB
+	if err := releaseLock(testService, pipeline.ID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPolicy(&model.ServicePolicy{Service: testService}); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err = PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[len(manifests)-1]; m.Kind != "PodDisruptionBudget" || m.Status != DiffDelete {
+		t.Fatalf("preview kind: %s status: %s", m.Kind, m.Status)
+	}
+
+	// HPA管理部署组时, 与部署一样不声明副本数
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: k8s.GetHPAName(testService, svc.ID, model.PHASE_ONLINE), Namespace: testNamespace},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: green},
+			MaxReplicas:    6,
+		},
+	}
+	if _, err := client.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Create(context.TODO(), hpa, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	manifests, err = PreviewDeploy(pipeline.ID, model.PHASE_ONLINE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dep := manifests[1].Object.(*appsv1.Deployment); dep.Spec.Replicas != nil {
+		t.Errorf("preview replicas: %d want unset", *dep.Spec.Replicas)
+	}
+	if m := manifests[1]; m.Status != DiffUnchanged {
+		t.Errorf("preview status: %s diff: %s", m.Status, m.Diff)
+	}
+}
+
+func TestPreviewCronjob(t *testing.T) {
+	setup(t, k8s.BLUE, k8s.GREEN)
+	createPipeline(t, model.PLSuccess)
+
+	name, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 相同命令的定时任务与已有任务对比
+	manifests, err := PreviewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[0]; m.Name != name || m.Status != DiffUnchanged {
+		t.Fatalf("preview name: %s status: %s diff: %s", m.Name, m.Status, m.Diff)
+	}
+
+	manifests, err = PreviewCronjob(testNamespace, testService, "python job.py", "*/5 * * * *", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[0]; m.Name != name || m.Status != DiffUpdate || !strings.Contains(m.Diff, "+  schedule: '*/5 * * * *'") {
+		t.Fatalf("preview name: %s status: %s diff: %s", m.Name, m.Status, m.Diff)
+	}
+
+	manifests, err = PreviewCronjob(testNamespace, testService, "python other.py", "*/5 * * * *", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := manifests[0]; m.Status != DiffCreate {
+		t.Fatalf("preview status: %s", m.Status)
+	}
+}
@@ -0,0 +1,306 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+	"nautilus/pkg/util/registry"
+)
+
+const (
+	testNamespace = "default"
+	testService   = "ivr"
+)
+
+// 各功能的测试位于对应的_test.go, 这里是共用的fixture: 内存sqlite、fake clientset、fake镜像仓库及测试数据
+
+func TestMain(m *testing.M) {
+	cfg, err := os.CreateTemp("", "publish_test*.yaml")
+	if err != nil {
+		panic(err)
+	}
+	artifactRoot, err := os.MkdirTemp("", "publish_artifact")
+	if err != nil {
+		panic(err)
+	}
+	cfg.WriteString("k8s:\n  imageKey: registry-key\nsecret:\n  key: MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n")
+	cfg.WriteString("build:\n  artifact: " + artifactRoot + "\n")
+	cfg.WriteString("registry:\n  kind: registry\n  repository: registry.local/code\n")
+	cfg.Close()
+	config.ParseConfig(cfg.Name())
+
+	model.Connect("sqlite3", "file:publish_test?mode=memory&cache=shared")
+	if _, err := model.Migrate("up", 0); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.Remove(cfg.Name())
+	os.RemoveAll(artifactRoot)
+	os.Exit(code)
+}
+
+// setup 清空数据并写入测试服务, 返回注入到k8s层的fake clientset
+func setup(t *testing.T, onlineGroup, deployGroup string) (*fake.Clientset, *model.Service) {
+	t.Helper()
+
+	for _, bean := range model.Tables() {
+		if _, err := model.MEngine.Where("1 = 1").Delete(bean); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustInsert(t, &model.Cluster{Name: "hp", Creator: "tester"})
+	mustInsert(t, &model.Namespace{Name: testNamespace, Cluster: "hp", Creator: "tester"})
+
+	svc := &model.Service{
+		Name:          testService,
+		Namespace:     testNamespace,
+		ImageAddr:     "registry.local/service/ivr:1.0.0",
+		QuotaCPU:      "500m",
+		QuotaMaxCPU:   "1000m",
+		QuotaMem:      "512Mi",
+		QuotaMaxMem:   "1024Mi",
+		Replicas:      3,
+		ReserveTime:   60,
+		Port:          5000,
+		ContainerPort: 5000,
+		OnlineGroup:   onlineGroup,
+		DeployGroup:   deployGroup,
+		RD:            "tester",
+		OP:            "tester",
+	}
+	mustInsert(t, svc)
+
+	for _, name := range []string{"ivr", "ivr_ui"} {
+		module := &model.CodeModule{Name: name, Language: "python", RepoName: "GIT", RepoAddr: "http://git.local/" + name}
+		mustInsert(t, module)
+		mustInsert(t, &model.ModuleBinding{ServiceID: svc.ID, CodeModuleID: module.ID})
+	}
+
+	client := newFakeClientset()
+	k8s.SetClientsetProvider(func(cluster string) (kubernetes.Interface, error) {
+		return client, nil
+	})
+
+	// createPipeline记录的镜像
+	testRegistry = &fakeRegistry{tags: make(map[string]map[string]string)}
+	for _, module := range []string{"ivr", "ivr_ui"} {
+		testRegistry.push("code/"+module, "v-1", "sha256:"+module+"-1")
+	}
+	registry.SetProvider(func(host string) (registry.Registry, error) {
+		if host != "registry.local" {
+			return nil, fmt.Errorf("unknown registry: %s", host)
+		}
+		return testRegistry, nil
+	})
+	return client, svc
+}
+
+var testRegistry *fakeRegistry
+
+// fakeRegistry 内存中的镜像仓库, 镜像名 -> tag -> digest
+type fakeRegistry struct {
+	mu   sync.Mutex
+	tags map[string]map[string]string
+}
+
+func (f *fakeRegistry) push(repository, tag, digest string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tags[repository] == nil {
+		f.tags[repository] = make(map[string]string)
+	}
+	f.tags[repository][tag] = digest
+}
+
+func (f *fakeRegistry) Digest(repository, tag string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	digest, ok := f.tags[repository][tag]
+	if !ok {
+		return "", registry.ErrNotFound
+	}
+	return digest, nil
+}
+
+func (f *fakeRegistry) Tags(repository string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tags []string
+	for tag := range f.tags[repository] {
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Delete 与registry一致, 删除manifest时指向它的tag一并删除
+func (f *fakeRegistry) Delete(repository, tag string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	digest, ok := f.tags[repository][tag]
+	if !ok {
+		return nil
+	}
+	for name, value := range f.tags[repository] {
+		if value == digest {
+			delete(f.tags[repository], name)
+		}
+	}
+	return nil
+}
+
+// newFakeClientset fake clientset对apply patch按strategic merge处理, 但对象不存在时不会创建,
+// 这里补充apply创建对象的行为, 与apiserver保持一致
+func newFakeClientset() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	tracker := client.Tracker()
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		if _, err := tracker.Get(patch.GetResource(), patch.GetNamespace(), patch.GetName()); !errors.IsNotFound(err) {
+			return false, nil, nil
+		}
+
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(patch.GetPatch(), nil, nil)
+		if err != nil {
+			return true, nil, err
+		}
+		if err := tracker.Create(patch.GetResource(), obj, patch.GetNamespace()); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+	return client
+}
+
+// createPipeline 创建指定状态的上线单, 并记录全部模块的镜像
+func createPipeline(t *testing.T, status int) *model.Pipeline {
+	t.Helper()
+
+	pipeline := &model.Pipeline{
+		Service: testService,
+		Name:    "release",
+		Summary: "release summary",
+		Creator: "tester",
+		RD:      "tester",
+		PM:      "tester",
+		Status:  status,
+	}
+	mustInsert(t, pipeline)
+
+	for _, module := range []string{"ivr", "ivr_ui"} {
+		mustInsert(t, &model.PipelineImage{
+			PipelineID: pipeline.ID,
+			Service:    testService,
+			CodeModule: module,
+			ImageURL:   "registry.local/code/" + module,
+			ImageTag:   "v-1",
+			Status:     model.PISuccess,
+		})
+	}
+	return pipeline
+}
+
+func createDeployment(t *testing.T, client *fake.Clientset, name string, replicas int32) {
+	t.Helper()
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	if _, err := client.AppsV1().Deployments(testNamespace).Create(context.TODO(), dep, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createGroups 创建蓝组在线、绿组部署的online deployment及sandbox deployment, 返回在线组、部署组的deployment名
+func createGroups(t *testing.T, client *fake.Clientset, svc *model.Service, replicas int32) (string, string) {
+	t.Helper()
+
+	var (
+		blue  = k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+		green = k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.GREEN)
+	)
+	createDeployment(t, client, blue, replicas)
+	createDeployment(t, client, k8s.GetDeploymentName(testService, svc.ID, model.PHASE_SANDBOX, k8s.BLUE), 1)
+	return blue, green
+}
+
+// finishOnline 全量阶段部署成功后确认完成
+func finishOnline(t *testing.T, pid int64) {
+	t.Helper()
+
+	if err := model.UpdatePhase(pid, model.KIND_DEPLOY, model.PHASE_ONLINE, model.PHSuccess); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFinish(pid, testService); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getReplicas(t *testing.T, client *fake.Clientset, name string) int32 {
+	t.Helper()
+
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment: %s error: %s", name, err)
+	}
+	return *dep.Spec.Replicas
+}
+
+func mustInsert(t *testing.T, bean interface{}) {
+	t.Helper()
+	if _, err := model.MEngine.Insert(bean); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseJobID(t *testing.T, name string) int64 {
+	t.Helper()
+
+	crontab := new(model.Crontab)
+	if has, err := model.MEngine.Where("service=?", testService).Desc("id").Get(crontab); err != nil || !has {
+		t.Fatalf("crontab not recorded: %v", err)
+	}
+	if k8s.GetCronjobName(testService, crontab.ID) != name {
+		t.Fatalf("cronjob name: %s crontab id: %d", name, crontab.ID)
+	}
+	return crontab.ID
+}
+
+// scaleDeployment 模拟HPA修改deployment副本数
+func scaleDeployment(t *testing.T, client *fake.Clientset, name string, replicas int32) {
+	t.Helper()
+
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep.Spec.Replicas = &replicas
+	if _, err := client.AppsV1().Deployments(testNamespace).Update(context.TODO(), dep, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
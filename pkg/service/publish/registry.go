@@ -0,0 +1,348 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+	"nautilus/pkg/util/lock"
+	"nautilus/pkg/util/registry"
+)
+
+const (
+	ImageTagPrefix    = "v-"              // makeimg生成的tag前缀, 只清理这类tag
+	ImageTagLayout    = "20060102_150405" // makeimg生成tag的时间格式: v-$(date +%Y%m%d_%H%M%S)
+	DefaultImageKeep  = 10                // 保留每个服务最近10个成功上线单引用的镜像
+	DefaultImageGrace = 24 * time.Hour    // 不清理最近24小时内构建的镜像
+	imageCleanTimeout = 10 * time.Minute
+
+	// imageCleanLock 清理镜像占用的锁, 多副本部署时同一时间只有一个副本清理
+	imageCleanLock = "_image_cleaner"
+)
+
+// ImageTag 模块镜像的tag, referenced表示被上线单或在线资源引用
+type ImageTag struct {
+	Tag        string `json:"tag"`
+	Referenced bool   `json:"referenced"`
+}
+
+// verifyImages 部署前校验上线单各模块的镜像在仓库中存在, single构建方式只校验发布镜像. 未配置镜像仓库时跳过
+func verifyImages(pipeline *model.Pipeline, svc *model.Service) error {
+	if !registry.Enabled() {
+		return nil
+	}
+
+	pid := pipeline.ID
+	if isSingleImage(svc) {
+		return verifyReleaseImage(pipeline)
+	}
+
+	images, err := model.FindImages(pid)
+	if err != nil {
+		return fmt.Errorf(config.IMG_QUERY_IS_BUILD_ERROR, err)
+	}
+	for _, image := range images {
+		if image.ImageURL == "" || image.ImageTag == "" {
+			return fmt.Errorf(config.REG_IMAGE_EMPTY, image.CodeModule)
+		}
+
+		reg, repository, err := openRegistry(image.ImageURL)
+		if err != nil {
+			return err
+		}
+		if _, err := reg.Digest(repository, image.ImageTag); errors.Is(err, registry.ErrNotFound) {
+			return fmt.Errorf(config.REG_IMAGE_NOT_FOUND, image.ImageURL, image.ImageTag)
+		} else if err != nil {
+			return fmt.Errorf(config.REG_QUERY_ERROR, image.ImageURL, err)
+		}
+	}
+	log.Infof("verify pipeline: %d %d images in registry success", pid, len(images))
+	return nil
+}
+
+func verifyReleaseImage(pipeline *model.Pipeline) error {
+	i := strings.LastIndex(pipeline.ReleaseImage, ":")
+	if i <= strings.LastIndex(pipeline.ReleaseImage, "/") {
+		return fmt.Errorf(config.REL_IMAGE_EMPTY, pipeline.ID)
+	}
+	image, tag := pipeline.ReleaseImage[:i], pipeline.ReleaseImage[i+1:]
+
+	reg, repository, err := openRegistry(image)
+	if err != nil {
+		return err
+	}
+	if _, err := reg.Digest(repository, tag); errors.Is(err, registry.ErrNotFound) {
+		return fmt.Errorf(config.REG_IMAGE_NOT_FOUND, image, tag)
+	} else if err != nil {
+		return fmt.Errorf(config.REG_QUERY_ERROR, image, err)
+	}
+	log.Infof("verify pipeline: %d release image: %s in registry success", pipeline.ID, pipeline.ReleaseImage)
+	return nil
+}
+
+// QueryImageTags 查询模块在仓库中的镜像tag, 按时间倒序
+func QueryImageTags(module string) ([]ImageTag, error) {
+	if !registry.Enabled() {
+		return nil, fmt.Errorf(config.REG_NOT_CONFIGURED)
+	}
+
+	image := moduleImage(module)
+	reg, repository, err := openRegistry(image)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := reg.Tags(repository)
+	if err != nil {
+		return nil, fmt.Errorf(config.REG_QUERY_ERROR, image, err)
+	}
+
+	refs, err := referencedImages()
+	if err != nil {
+		return nil, err
+	}
+
+	// makeimg的tag为v-时间, 按字符串倒序即时间倒序
+	sort.Sort(sort.Reverse(sort.StringSlice(tags)))
+	result := make([]ImageTag, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, ImageTag{Tag: tag, Referenced: refs[image+":"+tag]})
+	}
+	return result, nil
+}
+
+// CleanImages 删除各模块未被最近N个成功上线单、未结束的上线单及k8s中任何deployment、cronjob引用的镜像.
+// makeimg推送镜像后才回调记录, 构建时间在宽限期内的镜像不清理.
+// dryRun为true时只返回待删除的镜像, 否则占用清理锁, 被其他副本占用时返回*lock.LockedError.
+func CleanImages(dryRun bool) ([]string, error) {
+	if !registry.Enabled() {
+		return nil, fmt.Errorf(config.REG_NOT_CONFIGURED)
+	}
+
+	if !dryRun {
+		owner := lock.Owner{User: cleanerName()}
+		if err := lock.Default().Acquire(imageCleanLock, owner); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := lock.Default().Release(imageCleanLock, owner); err != nil {
+				log.Errorf("release image cleaner lock for %s failed: %s", owner.Key(), err)
+			}
+		}()
+	}
+
+	grace := time.Duration(config.Config().Registry.Grace) * time.Second
+	if grace <= 0 {
+		grace = DefaultImageGrace
+	}
+
+	refs, err := referencedImages()
+	if err != nil {
+		return nil, err
+	}
+
+	modules, err := model.FindCodeModules()
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_QUERY_MODULE_BINDING_ERROR, err)
+	}
+
+	deleted := make([]string, 0)
+	for _, module := range modules {
+		image := moduleImage(module.Name)
+		reg, repository, err := openRegistry(image)
+		if err != nil {
+			return deleted, err
+		}
+		tags, err := reg.Tags(repository)
+		if err != nil {
+			return deleted, fmt.Errorf(config.REG_QUERY_ERROR, image, err)
+		}
+
+		// 删除按manifest进行, 与被引用的tag指向同一manifest的tag不能删除
+		var (
+			candidates []string
+			keeps      = make(map[string]bool)
+		)
+		for _, tag := range tags {
+			if !refs[image+":"+tag] {
+				if strings.HasPrefix(tag, ImageTagPrefix) && !recentTag(tag, grace) {
+					candidates = append(candidates, tag)
+				}
+				continue
+			}
+			digest, err := reg.Digest(repository, tag)
+			if err != nil {
+				return deleted, fmt.Errorf(config.REG_QUERY_ERROR, image+":"+tag, err)
+			}
+			keeps[digest] = true
+		}
+
+		for _, tag := range candidates {
+			digest, err := reg.Digest(repository, tag)
+			if errors.Is(err, registry.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return deleted, fmt.Errorf(config.REG_QUERY_ERROR, image+":"+tag, err)
+			}
+			if keeps[digest] {
+				continue
+			}
+
+			if !dryRun {
+				if err := reg.Delete(repository, tag); err != nil {
+					return deleted, fmt.Errorf(config.REG_DELETE_ERROR, image, tag, err)
+				}
+				log.Infof("delete unreferenced image: %s:%s success", image, tag)
+			}
+			deleted = append(deleted, image+":"+tag)
+		}
+	}
+	return deleted, nil
+}
+
+// RunImageCleaner 定期清理未被引用的镜像, ctx取消时退出
+func RunImageCleaner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var locked *lock.LockedError
+			if deleted, err := CleanImages(false); errors.As(err, &locked) {
+				log.Infof("skip cleaning registry images: %s", err)
+			} else if err != nil {
+				log.Errorf("clean registry images failed: %s", err)
+			} else if len(deleted) > 0 {
+				log.Infof("clean %d registry images success", len(deleted))
+			}
+		}
+	}
+}
+
+// recentTag makeimg生成的tag是否在宽限期内构建, 无法解析构建时间的tag视为已过宽限期
+func recentTag(tag string, grace time.Duration) bool {
+	built, err := time.ParseInLocation(ImageTagLayout, strings.TrimPrefix(tag, ImageTagPrefix), time.Local)
+	if err != nil {
+		return false
+	}
+	return time.Since(built) < grace
+}
+
+// cleanerName 清理锁的持有者, 以主机名区分副本
+func cleanerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return "image-cleaner@" + hostname
+}
+
+// moduleImage 模块的code层镜像, 与makeimg一致
+func moduleImage(module string) string {
+	return strings.TrimSuffix(config.Config().Registry.Repository, "/") + "/" + module
+}
+
+func openRegistry(image string) (registry.Registry, string, error) {
+	host, repository, err := registry.Split(image)
+	if err != nil {
+		return nil, "", fmt.Errorf(config.REG_QUERY_ERROR, image, err)
+	}
+	reg, err := registry.New(host)
+	if err != nil {
+		return nil, "", fmt.Errorf(config.REG_QUERY_ERROR, image, err)
+	}
+	return reg, repository, nil
+}
+
+// referencedImages 被引用的镜像(地址:tag): 每个服务最近N个成功上线单、未结束的上线单, 以及k8s中的deployment、cronjob
+func referencedImages() (map[string]bool, error) {
+	keep := config.Config().Registry.Keep
+	if keep <= 0 {
+		keep = DefaultImageKeep
+	}
+
+	var (
+		refs       = make(map[string]bool)
+		namespaces = make(map[string]bool)
+	)
+	addImages := func(images []model.PipelineImage) {
+		for _, image := range images {
+			if image.ImageURL != "" && image.ImageTag != "" {
+				refs[image.ImageURL+":"+image.ImageTag] = true
+			}
+		}
+	}
+
+	services, err := model.FindServices()
+	if err != nil {
+		return nil, fmt.Errorf(config.REG_REFERENCE_ERROR, err)
+	}
+	for _, svc := range services {
+		namespaces[svc.Namespace] = true
+
+		pipelines, err := model.FindPipelineInfo(svc.Name)
+		if err != nil {
+			return nil, fmt.Errorf(config.REG_REFERENCE_ERROR, err)
+		}
+		for i := 0; i < len(pipelines) && i < keep; i++ {
+			images, err := model.FindImages(pipelines[i].ID)
+			if err != nil {
+				return nil, fmt.Errorf(config.REG_REFERENCE_ERROR, err)
+			}
+			addImages(images)
+		}
+	}
+
+	active, err := model.FindActiveImages()
+	if err != nil {
+		return nil, fmt.Errorf(config.REG_REFERENCE_ERROR, err)
+	}
+	addImages(active)
+
+	// 查询不到k8s资源时不能确定镜像是否在使用, 整体失败
+	for namespace := range namespaces {
+		resource, err := k8s.New(namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		deployments, err := resource.ListDeployments(namespace)
+		if err != nil {
+			return nil, fmt.Errorf(config.REG_REFERENCE_ERROR, err)
+		}
+		for _, dep := range deployments.Items {
+			addPodImages(refs, &dep.Spec.Template.Spec)
+		}
+
+		cronJobs, err := resource.ListCronJobs(namespace)
+		if err != nil {
+			return nil, fmt.Errorf(config.REG_REFERENCE_ERROR, err)
+		}
+		for _, cronJob := range cronJobs.Items {
+			addPodImages(refs, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+		}
+	}
+	return refs, nil
+}
+
+func addPodImages(refs map[string]bool, spec *corev1.PodSpec) {
+	for _, container := range append(spec.InitContainers, spec.Containers...) {
+		refs[container.Image] = true
+	}
+}
@@ -0,0 +1,134 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+	"nautilus/pkg/util/lock"
+)
+
+func TestVerifyImages(t *testing.T) {
+	_, svc := setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLProcess)
+
+	if err := verifyImages(pipeline, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	// 镜像在仓库中被删除后不能部署
+	if err := testRegistry.Delete("code/ivr_ui", "v-1"); err != nil {
+		t.Fatal(err)
+	}
+	err := NewDeploy(pipeline.ID, model.PHASE_SANDBOX, "tester")
+	if err == nil || err.Error() != fmt.Sprintf(config.REG_IMAGE_NOT_FOUND, "registry.local/code/ivr_ui", "v-1") {
+		t.Fatalf("deploy with missing image error: %v", err)
+	}
+}
+
+func TestCleanImages(t *testing.T) {
+	client, _ := setup(t, "", "")
+
+	// 11个成功的上线单, 只有最近10个的镜像被保留
+	for i := 1; i <= DefaultImageKeep+1; i++ {
+		pipeline := &model.Pipeline{Service: testService, Name: "release", Summary: "release", Creator: "tester", RD: "tester", PM: "tester", Status: model.PLSuccess}
+		mustInsert(t, pipeline)
+		tag := fmt.Sprintf("v-%02d", i)
+		mustInsert(t, &model.PipelineImage{PipelineID: pipeline.ID, Service: testService, CodeModule: "ivr", ImageURL: "registry.local/code/ivr", ImageTag: tag, Status: model.PISuccess})
+		testRegistry.push("code/ivr", tag, "sha256:"+tag)
+	}
+	testRegistry.push("code/ivr", "v-dup", "sha256:v-11") // 与被引用的tag指向同一manifest
+	testRegistry.push("code/ivr", "v-deploy", "sha256:v-deploy")
+	testRegistry.push("code/ivr", "v-unused", "sha256:v-unused")
+	testRegistry.push("code/ivr", "latest", "sha256:latest") // 不是makeimg生成的tag
+
+	// 刚推送、尚未回调记录的镜像在宽限期内不清理, 超过宽限期的清理
+	fresh := ImageTagPrefix + time.Now().Format(ImageTagLayout)
+	stale := ImageTagPrefix + time.Now().Add(-DefaultImageGrace-time.Hour).Format(ImageTagLayout)
+	testRegistry.push("code/ivr", fresh, "sha256:fresh")
+	testRegistry.push("code/ivr", stale, "sha256:stale")
+
+	// 在线deployment引用的镜像
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "ivr-deploy", Namespace: testNamespace},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "ivr", Image: "registry.local/code/ivr:v-deploy"}},
+					Containers:     []corev1.Container{{Name: "main", Image: "registry.local/service/ivr:1.0.0"}},
+				},
+			},
+		},
+	}
+	if _, err := client.AppsV1().Deployments(testNamespace).Create(context.TODO(), dep, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"registry.local/code/ivr:v-01",
+		"registry.local/code/ivr:v-1",
+		"registry.local/code/ivr:" + stale,
+		"registry.local/code/ivr:v-unused",
+		"registry.local/code/ivr_ui:v-1",
+	}
+	sort.Strings(want)
+
+	// 清理锁被其他副本占用时不清理
+	other := lock.Owner{User: "image-cleaner@other"}
+	if err := lock.Default().Acquire(imageCleanLock, other); err != nil {
+		t.Fatal(err)
+	}
+	var locked *lock.LockedError
+	if _, err := CleanImages(false); !errors.As(err, &locked) {
+		t.Fatalf("clean images with lock held by other: %v, want locked error", err)
+	}
+	if err := lock.Default().Release(imageCleanLock, other); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		deleted, err := CleanImages(dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(deleted)
+		if !reflect.DeepEqual(deleted, want) {
+			t.Errorf("dry run: %v deleted: %v, want: %v", dryRun, deleted, want)
+		}
+	}
+
+	tags, err := QueryImageTags("ivr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 14 || tags[0].Tag != "v-dup" {
+		t.Errorf("remaining tags: %+v", tags)
+	}
+	for _, tag := range tags {
+		if tag.Tag == "v-01" || tag.Tag == "v-unused" {
+			t.Errorf("tag: %s should be deleted", tag.Tag)
+		}
+		if tag.Tag == stale {
+			t.Errorf("tag: %s should be deleted", tag.Tag)
+		}
+		if want := tag.Tag != "v-dup" && tag.Tag != "latest" && tag.Tag != fresh; tag.Referenced != want {
+			t.Errorf("tag: %s referenced: %v, want: %v", tag.Tag, tag.Referenced, want)
+		}
+	}
+}
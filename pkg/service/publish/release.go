@@ -0,0 +1,139 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/metrics"
+)
+
+// ReleaseBuildDir 发布镜像Dockerfile所在的构建目录名, 以_开头不会与模块名冲突
+const ReleaseBuildDir = "_release"
+
+// SetBuildMode 设置服务的构建方式, 下次构建镜像时生效
+func SetBuildMode(service, mode string) error {
+	if mode != "" && mode != model.BuildModeLayer && mode != model.BuildModeSingle {
+		return fmt.Errorf(config.REL_MODE_INVALID, mode)
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
+	if err := model.UpdateBuildMode(service, mode); err != nil {
+		return fmt.Errorf(config.REL_MODE_SAVE_ERROR, err)
+	}
+	log.Infof("save service: %s build mode: %q success", service, mode)
+	return nil
+}
+
+func isSingleImage(svc *model.Service) bool {
+	return svc.BuildMode == model.BuildModeSingle
+}
+
+// buildRelease 将服务基础镜像与上线单全部模块的代码构建为一个发布镜像, makerelease构建完成后回调记录发布镜像
+func buildRelease(pid int64, svc *model.Service, scriptPath string) error {
+	// 清除之前构建的发布镜像, 构建失败时不能部署旧的代码
+	if err := model.UpdateReleaseImage(pid, ""); err != nil {
+		return fmt.Errorf(config.REL_UPDATE_ERROR, err)
+	}
+
+	images, err := model.FindImages(pid)
+	if err != nil {
+		return fmt.Errorf(config.IMG_QUERY_IS_BUILD_ERROR, err)
+	}
+
+	dir := buildDir(svc.Name, pid, ReleaseBuildDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf(config.REL_WRITE_ERROR, err)
+	}
+	dockerfile := renderReleaseDockerfile(svc.ImageAddr, images)
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return fmt.Errorf(config.REL_WRITE_ERROR, err)
+	}
+
+	output := ""
+	param := fmt.Sprintf("%s/makerelease -s %s -i %d -c %s", scriptPath, svc.Name, pid, dir)
+	log.Infof("makerelease command: %s", param)
+
+	ws := NewWebsocket()
+	ws.IsCmdCall = true
+	start := time.Now()
+	err = ws.Realtime(param, &output)
+	metrics.BuildDuration.WithLabelValues(svc.Name, ReleaseBuildDir, "release", metrics.Result(err)).Observe(metrics.Since(start))
+	if err != nil {
+		log.Errorf("pipeline: %d build release image output: %s", pid, tailLog(output))
+		return fmt.Errorf(config.REL_BUILD_FAILED, err)
+	}
+
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return fmt.Errorf(config.IMG_QUERY_PIPELINE_ERROR, err)
+	}
+	if pipeline.ReleaseImage == "" {
+		return fmt.Errorf(config.REL_IMAGE_EMPTY, pid)
+	}
+	log.Infof("build pipeline: %d release image: %s success", pid, pipeline.ReleaseImage)
+	return nil
+}
+
+// renderReleaseDockerfile 在服务基础镜像上按模块依次拷贝code层镜像中的代码, 与init容器拷贝的结果一致
+func renderReleaseDockerfile(baseImage string, images []model.PipelineImage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "FROM %s\n\n", baseImage)
+	for _, image := range images {
+		fmt.Fprintf(&b, "COPY --from=%s:%s --chown=tong:tong /code/ %s/\n", image.ImageURL, image.ImageTag, CodeMountPath)
+	}
+	return b.String()
+}
+
+func UpdateReleaseImage(pid int64, image string) error {
+	return model.UpdateReleaseImage(pid, image)
+}
+
+// applyReleaseImage single构建方式下业务容器直接使用发布镜像, 代码已在镜像中, 去掉拷贝代码的init容器及代码卷
+func applyReleaseImage(pipeline *model.Pipeline, svc *model.Service, spec *corev1.PodSpec) error {
+	if !isSingleImage(svc) {
+		return nil
+	}
+	if pipeline.ReleaseImage == "" {
+		return fmt.Errorf(config.REL_IMAGE_EMPTY, pipeline.ID)
+	}
+
+	spec.InitContainers = nil
+
+	volumes := spec.Volumes[:0]
+	for _, volume := range spec.Volumes {
+		if volume.Name != CodeMountPoint {
+			volumes = append(volumes, volume)
+		}
+	}
+	spec.Volumes = volumes
+
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		container.Image = pipeline.ReleaseImage
+
+		mounts := container.VolumeMounts[:0]
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != CodeMountPoint {
+				mounts = append(mounts, mount)
+			}
+		}
+		container.VolumeMounts = mounts
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestSingleImageDeploy(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	if err := SetBuildMode(testService, "multi"); err == nil {
+		t.Fatal("invalid build mode should fail")
+	}
+	if err := SetBuildMode(testService, model.BuildModeSingle); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := model.FindImages(createPipeline(t, model.PLSuccess).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "FROM " + svc.ImageAddr + "\n\n" +
+		"COPY --from=registry.local/code/ivr:v-1 --chown=tong:tong /code/ /home/tong/www/\n" +
+		"COPY --from=registry.local/code/ivr_ui:v-1 --chown=tong:tong /code/ /home/tong/www/\n"
+	if dockerfile := renderReleaseDockerfile(svc.ImageAddr, images); dockerfile != want {
+		t.Errorf("release dockerfile:\n%s\nwant:\n%s", dockerfile, want)
+	}
+
+	// 没有发布镜像时不能部署
+	pipeline := createPipeline(t, model.PLProcess)
+	err = NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester")
+	if err == nil || err.Error() != fmt.Sprintf(config.REL_IMAGE_EMPTY, pipeline.ID) {
+		t.Fatalf("deploy without release image error: %v", err)
+	}
+
+	release := "registry.local/release/" + testService + ":v-2"
+	if err := UpdateReleaseImage(pipeline.ID, release); err != nil {
+		t.Fatal(err)
+	}
+	err = NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester")
+	if err == nil || err.Error() != fmt.Sprintf(config.REG_IMAGE_NOT_FOUND, "registry.local/release/"+testService, "v-2") {
+		t.Fatalf("deploy with missing release image error: %v", err)
+	}
+
+	testRegistry.push("release/"+testService, "v-2", "sha256:release-2")
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := dep.Spec.Template.Spec
+	if len(spec.InitContainers) != 0 {
+		t.Errorf("init containers: %+v want none", spec.InitContainers)
+	}
+	if image := spec.Containers[0].Image; image != release {
+		t.Errorf("container image: %s want %s", image, release)
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].Name != LogMountPoint {
+		t.Errorf("deployment volumes: %+v want log only", spec.Volumes)
+	}
+	if mounts := spec.Containers[0].VolumeMounts; len(mounts) != 1 || mounts[0].MountPath != LogMountPath {
+		t.Errorf("container volume mounts: %+v want log only", mounts)
+	}
+}
@@ -9,19 +9,25 @@ import (
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
 	"nautilus/pkg/util/cm"
 	"nautilus/pkg/util/k8s"
+	"nautilus/pkg/util/metrics"
 )
 
-func NewRollback(pid int64, username string) error {
+func NewRollback(pid int64, username string) (err error) {
 	pipeline, err := model.GetPipeline(pid)
 	if err != nil {
 		return fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
 	}
 
+	defer func() {
+		metrics.RollbackTotal.WithLabelValues(pipeline.Service, metrics.Result(err)).Inc()
+	}()
+
 	if cm.Ini(pipeline.Status, []int{model.PLRollbackSuccess, model.PLTerminate}) {
 		return fmt.Errorf(config.ROL_CANNOT_EXECUTE)
 	}
@@ -36,7 +42,6 @@ func NewRollback(pid int64, username string) error {
 		destroyGroup  string // 销毁组缩成0
 		namespace     = svc.Namespace
 		service       = svc.Name
-		replicas      = svc.Replicas
 		serviceID     = svc.ID
 	)
 
@@ -54,12 +59,12 @@ func NewRollback(pid int64, username string) error {
 	log.Infof("get rollback group(%s) destroy group(%s)", rollbackGroup, destroyGroup)
 
 	// (2) 占锁
-	if err := model.UpdateStatus(pid, model.PLRollbacking); err != nil {
-		return fmt.Errorf(config.DB_UPDATE_PIPELINE_ERROR, err)
+	if err := checkLock(service, pid, username); err != nil {
+		return err
 	}
 
-	if err := model.SetLock(serviceID, username); err != nil {
-		return fmt.Errorf(config.DB_WRITE_LOCK_ERROR, pid, err)
+	if err := model.UpdateStatus(pid, model.PLRollbacking); err != nil {
+		return fmt.Errorf(config.DB_UPDATE_PIPELINE_ERROR, err)
 	}
 
 	// (3) 获取已发布的阶段
@@ -92,44 +97,70 @@ func NewRollback(pid int64, username string) error {
 	}
 
 	for _, phase := range publishes {
-		if phase == model.PHASE_SANDBOX {
-			replicas = 1
+		var (
+			rollbackDepName = k8s.GetDeploymentName(service, serviceID, phase, rollbackGroup)
+			destroyDepName  = k8s.GetDeploymentName(service, serviceID, phase, destroyGroup)
+		)
+
+		replicas, err := restoreReplicas(resource, svc, phase, rollbackDepName, destroyDepName)
+		if err != nil {
+			return err
 		}
 
 		// 第一步: 回滚组恢复指定副本数
-		rollbackDepName := k8s.GetDeploymentName(service, serviceID, phase, rollbackGroup)
 		if err := resource.Scale(namespace, rollbackDepName, replicas); err != nil {
 			log.Errorf("rollback deployment: %s replicas: %d error: %+v", rollbackDepName, replicas, err)
 			return err
 		}
 		log.Infof("rollback deployment: %s replicas: %d success", rollbackDepName, replicas)
 
-		// 第二步: 销毁组缩成0
-		destroyDepName := k8s.GetDeploymentName(service, serviceID, phase, destroyGroup)
+		// 第二步: HPA、PDB绑定到回滚组
+		if err := bindHPA(resource, svc, phase, rollbackGroup); err != nil {
+			return err
+		}
+		if err := applyPDB(resource, svc, phase, rollbackGroup); err != nil {
+			return err
+		}
+
+		// 第三步: 销毁组缩成0
 		if err := resource.Scale(namespace, destroyDepName, 0); err != nil {
 			log.Errorf("destroy deployment: %s scale 0 error: %+v", destroyDepName, err)
 			return err
 		}
 		log.Infof("destroy deployment: %s scale 0 success", destroyDepName)
 
+		if err := deletePDB(resource, svc, phase, destroyGroup); err != nil {
+			return err
+		}
+
+		// 回滚组重新成为全量在线组, 定时任务恢复该组的配置
+		if phase == model.PHASE_ONLINE && pipeline.Status == model.PLSuccess {
+			configMap, err := resource.GetConfigMap(namespace, k8s.GetConfigmapName(rollbackDepName))
+			if err != nil && !k8serrors.IsNotFound(err) {
+				return fmt.Errorf(config.CM_K8S_EXEC_FAILED, err)
+			}
+			if err == nil {
+				if err := syncCronjobConfig(resource, svc, configMap.Data); err != nil {
+					return err
+				}
+			}
+		}
+
 		if err := model.CreatePhase(pid, model.KIND_ROLLBACK, phase, model.PHSuccess); err != nil {
 			return fmt.Errorf(config.ROL_RECORD_PHASE_ERROR, phase, err)
 		}
 	}
 
-	// (5) 释放锁
+	// (5) 完成
 	if err := model.UpdateStatus(pid, model.PLRollbackSuccess); err != nil {
 		return fmt.Errorf(config.DB_UPDATE_PIPELINE_ERROR, err)
 	}
-
-	if err := model.SetLock(serviceID, ""); err != nil {
-		return fmt.Errorf(config.DB_WRITE_LOCK_ERROR, pid, err)
-	}
 	log.Infof("rollback all phases: %+v success", publishes)
 
-	// (6) 完成
 	if err := model.UpdateGroup(pid, serviceID, rollbackGroup, destroyGroup, model.PLRollbackSuccess); err != nil {
 		return fmt.Errorf(config.FSH_UPDATE_ONLINE_GROUP_ERROR, err)
 	}
-	return nil
+
+	// (6) 释放锁
+	return releaseLock(service, pid, username)
 }
@@ -0,0 +1,62 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"testing"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestNewRollback(t *testing.T) {
+	// 发布完成后回滚: 当前在线组green销毁, 恢复blue组
+	client, svc := setup(t, k8s.GREEN, k8s.BLUE)
+	pipeline := createPipeline(t, model.PLSuccess)
+
+	for _, phase := range []string{model.PHASE_IMAGE, model.PHASE_SANDBOX, model.PHASE_ONLINE, model.PHASE_FINISH} {
+		if err := model.CreatePhase(pipeline.ID, model.KIND_DEPLOY, phase, model.PHSuccess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, phase := range []string{model.PHASE_SANDBOX, model.PHASE_ONLINE} {
+		createDeployment(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.BLUE), 0)
+		createDeployment(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.GREEN), 3)
+	}
+
+	if err := NewRollback(pipeline.ID, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int32{model.PHASE_SANDBOX: 1, model.PHASE_ONLINE: svc.Replicas}
+	for phase, replicas := range want {
+		if got := getReplicas(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.BLUE)); got != replicas {
+			t.Errorf("rollback %s group replicas: %d want %d", phase, got, replicas)
+		}
+		if got := getReplicas(t, client, k8s.GetDeploymentName(testService, svc.ID, phase, k8s.GREEN)); got != 0 {
+			t.Errorf("destroy %s group replicas: %d want 0", phase, got)
+		}
+		if _, err := model.GetPhaseInfo(pipeline.ID, model.KIND_ROLLBACK, phase); err != nil {
+			t.Errorf("rollback phase: %s not recorded: %s", phase, err)
+		}
+	}
+
+	current, err := model.GetServiceInfo(testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.OnlineGroup != k8s.BLUE || current.DeployGroup != k8s.GREEN {
+		t.Errorf("online group: %s deploy group: %s", current.OnlineGroup, current.DeployGroup)
+	}
+
+	rollbacked, err := model.GetPipeline(pipeline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollbacked.Status != model.PLRollbackSuccess {
+		t.Errorf("pipeline status: %d want %d", rollbacked.Status, model.PLRollbackSuccess)
+	}
+}
@@ -0,0 +1,210 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+// 节点池标签, 与README中的节点标签保持一致
+const (
+	NodePoolLabel   = "aggregate"
+	DefaultNodePool = "default" // 业务node
+	CronjobNodePool = "cronjob" // 定时node
+)
+
+// schedulingSpec 解析后的调度配置
+type schedulingSpec struct {
+	nodeSelector  map[string]string
+	tolerations   []corev1.Toleration
+	nodeAffinity  *corev1.NodeAffinity
+	priorityClass string
+	runtimeClass  string
+}
+
+// SetScheduling 保存服务或定时任务的调度配置. 服务配置在下次部署时生效, 定时任务配置立即重新发布.
+func SetScheduling(scheduling *model.Scheduling) error {
+	pool := DefaultNodePool
+	if scheduling.CrontabID > 0 {
+		pool = CronjobNodePool
+	}
+	spec, err := parseScheduling(scheduling, pool)
+	if err != nil {
+		return err
+	}
+
+	if err := checkLock(scheduling.Service, 0, ""); err != nil {
+		return err
+	}
+
+	var crontab *model.Crontab
+	if scheduling.CrontabID > 0 {
+		c, err := model.GetCrontab(scheduling.CrontabID)
+		if err != nil {
+			return fmt.Errorf(config.SCH_QUERY_CRONTAB_ERROR, scheduling.CrontabID, err)
+		}
+		if c.Service != scheduling.Service {
+			return fmt.Errorf(config.SCH_QUERY_CRONTAB_ERROR, scheduling.CrontabID, model.NotFound)
+		}
+		crontab = c
+	}
+
+	if err := model.SaveScheduling(scheduling); err != nil {
+		return fmt.Errorf(config.SCH_SAVE_ERROR, err)
+	}
+	log.Infof("save service: %s crontab: %d scheduling success", scheduling.Service, scheduling.CrontabID)
+
+	if crontab == nil {
+		return nil
+	}
+
+	cronJob, err := renderCronjob(crontab.Namespace, crontab.Service, crontab.Command, crontab.Schedule, crontab.ID, spec)
+	if err != nil {
+		return err
+	}
+
+	resource, err := k8s.New(crontab.Namespace)
+	if err != nil {
+		return err
+	}
+	if err := resource.CreateOrUpdateCronJob(crontab.Namespace, cronJob); err != nil {
+		return fmt.Errorf(config.CRON_K8S_EXEC_FAILED, err)
+	}
+	log.Infof("republish cronjob: %s with new scheduling success", cronJob.Name)
+	return nil
+}
+
+// QueryScheduling 查询服务或定时任务的调度配置, 未配置时返回默认节点池
+func QueryScheduling(service string, crontabID int64) (*model.Scheduling, error) {
+	scheduling, err := model.GetScheduling(service, crontabID)
+	if errors.Is(err, model.NotFound) {
+		pool := DefaultNodePool
+		if crontabID > 0 {
+			pool = CronjobNodePool
+		}
+		selector, _ := json.Marshal(map[string]string{NodePoolLabel: pool})
+		return &model.Scheduling{Service: service, CrontabID: crontabID, NodeSelector: string(selector)}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf(config.SCH_QUERY_ERROR, err)
+	}
+	return scheduling, nil
+}
+
+// getScheduling 获取服务(crontabID为0)或定时任务的调度配置, 未配置节点标签时使用默认节点池
+func getScheduling(service string, crontabID int64, pool string) (*schedulingSpec, error) {
+	scheduling, err := model.GetScheduling(service, crontabID)
+	if errors.Is(err, model.NotFound) {
+		scheduling = &model.Scheduling{Service: service, CrontabID: crontabID}
+	} else if err != nil {
+		return nil, fmt.Errorf(config.SCH_QUERY_ERROR, err)
+	}
+	return parseScheduling(scheduling, pool)
+}
+
+func parseScheduling(scheduling *model.Scheduling, pool string) (*schedulingSpec, error) {
+	spec := &schedulingSpec{
+		priorityClass: scheduling.PriorityClass,
+		runtimeClass:  scheduling.RuntimeClass,
+	}
+
+	if scheduling.NodeSelector != "" {
+		if err := json.Unmarshal([]byte(scheduling.NodeSelector), &spec.nodeSelector); err != nil {
+			return nil, fmt.Errorf(config.SCH_NODE_SELECTOR_ERROR, err)
+		}
+		for key, value := range spec.nodeSelector {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return nil, fmt.Errorf(config.SCH_NODE_SELECTOR_ERROR, strings.Join(errs, "; "))
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return nil, fmt.Errorf(config.SCH_NODE_SELECTOR_ERROR, strings.Join(errs, "; "))
+			}
+		}
+	}
+	if len(spec.nodeSelector) == 0 && pool != "" {
+		spec.nodeSelector = map[string]string{NodePoolLabel: pool}
+	}
+
+	if scheduling.Tolerations != "" {
+		if err := json.Unmarshal([]byte(scheduling.Tolerations), &spec.tolerations); err != nil {
+			return nil, fmt.Errorf(config.SCH_TOLERATION_ERROR, err)
+		}
+		for _, item := range spec.tolerations {
+			if err := validateToleration(item); err != nil {
+				return nil, fmt.Errorf(config.SCH_TOLERATION_ERROR, err)
+			}
+		}
+	}
+
+	if scheduling.NodeAffinity != "" {
+		spec.nodeAffinity = new(corev1.NodeAffinity)
+		if err := json.Unmarshal([]byte(scheduling.NodeAffinity), spec.nodeAffinity); err != nil {
+			return nil, fmt.Errorf(config.SCH_NODE_AFFINITY_ERROR, err)
+		}
+	}
+
+	classes := map[string]string{
+		"PriorityClass": scheduling.PriorityClass,
+		"RuntimeClass":  scheduling.RuntimeClass,
+	}
+	for kind, name := range classes {
+		if name == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf(config.SCH_CLASS_NAME_ERROR, kind, name)
+		}
+	}
+	return spec, nil
+}
+
+func validateToleration(toleration corev1.Toleration) error {
+	switch toleration.Operator {
+	case "", corev1.TolerationOpEqual:
+	case corev1.TolerationOpExists:
+		if toleration.Value != "" {
+			return fmt.Errorf("value must be empty when operator is Exists")
+		}
+	default:
+		return fmt.Errorf("unsupported operator: %s", toleration.Operator)
+	}
+
+	switch toleration.Effect {
+	case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+	default:
+		return fmt.Errorf("unsupported effect: %s", toleration.Effect)
+	}
+	return nil
+}
+
+// apply 将调度配置写入pod spec
+func (s *schedulingSpec) apply(spec *corev1.PodSpec) {
+	spec.NodeSelector = s.nodeSelector
+	spec.Tolerations = s.tolerations
+	spec.PriorityClassName = s.priorityClass
+
+	if s.nodeAffinity != nil {
+		if spec.Affinity == nil {
+			spec.Affinity = new(corev1.Affinity)
+		}
+		spec.Affinity.NodeAffinity = s.nodeAffinity
+	}
+
+	if s.runtimeClass != "" {
+		runtimeClass := s.runtimeClass
+		spec.RuntimeClassName = &runtimeClass
+	}
+}
@@ -0,0 +1,91 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestSchedulingApplied(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	createPipeline(t, model.PLSuccess)
+
+	// 服务配置不影响定时任务, 定时任务单独配置后立即重新发布
+	name, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobID := parseJobID(t, name)
+	if err := SetScheduling(&model.Scheduling{Service: testService, CrontabID: jobID, PriorityClass: "low"}); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduling := &model.Scheduling{
+		Service:       testService,
+		NodeSelector:  `{"aggregate": "gpu"}`,
+		Tolerations:   `[{"key": "gpu", "operator": "Exists", "effect": "NoSchedule"}]`,
+		PriorityClass: "high",
+		RuntimeClass:  "gvisor",
+	}
+	if err := SetScheduling(scheduling); err != nil {
+		t.Fatal(err)
+	}
+
+	cronJob, err := client.BatchV1().CronJobs(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := cronJob.Spec.JobTemplate.Spec.Template.Spec
+	if pool := spec.NodeSelector[NodePoolLabel]; pool != CronjobNodePool {
+		t.Errorf("cronjob node pool: %s want %s", pool, CronjobNodePool)
+	}
+	if spec.PriorityClassName != "low" {
+		t.Errorf("cronjob priority class: %s want low", spec.PriorityClassName)
+	}
+
+	pipeline := createPipeline(t, model.PLProcess)
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec = dep.Spec.Template.Spec
+	if pool := spec.NodeSelector[NodePoolLabel]; pool != "gpu" {
+		t.Errorf("deployment node pool: %s want gpu", pool)
+	}
+	if len(spec.Tolerations) != 1 || spec.Tolerations[0].Key != "gpu" {
+		t.Errorf("deployment tolerations: %+v", spec.Tolerations)
+	}
+	if spec.PriorityClassName != "high" || spec.RuntimeClassName == nil || *spec.RuntimeClassName != "gvisor" {
+		t.Errorf("deployment priority class: %s runtime class: %v", spec.PriorityClassName, spec.RuntimeClassName)
+	}
+}
+
+func TestSchedulingValidate(t *testing.T) {
+	cases := []model.Scheduling{
+		{NodeSelector: `{"aggregate": "bad value"}`},
+		{NodeSelector: `["aggregate"]`},
+		{Tolerations: `[{"key": "gpu", "operator": "Exists", "value": "1"}]`},
+		{Tolerations: `[{"key": "gpu", "effect": "Evict"}]`},
+		{NodeAffinity: `{`},
+		{PriorityClass: "High_Priority"},
+	}
+	for i := range cases {
+		if _, err := parseScheduling(&cases[i], DefaultNodePool); err == nil {
+			t.Errorf("case %d: %+v should be invalid", i, cases[i])
+		}
+	}
+}
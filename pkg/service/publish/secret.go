@@ -0,0 +1,152 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/crypto"
+	"nautilus/pkg/util/k8s"
+)
+
+// SecretKey secret的key信息, 不包含value
+type SecretKey struct {
+	Name     string    `json:"name"`
+	UpdateAt time.Time `json:"update_at"`
+}
+
+// SetSecret 加密保存服务的secret并发布到k8s, 未传入的key保持不变.
+// NOTE: value只以密文落库, 日志及返回值中只出现key.
+func SetSecret(namespace, service string, data map[string]string) error {
+	key, err := secretKey()
+	if err != nil {
+		return err
+	}
+
+	secrets := make([]model.ServiceSecret, 0, len(data))
+	for name, value := range data {
+		if errs := validation.IsConfigMapKey(name); len(errs) > 0 {
+			return fmt.Errorf(config.SEC_NAME_INVALID, name)
+		}
+		encrypted, err := crypto.Encrypt(key, value)
+		if err != nil {
+			return fmt.Errorf(config.SEC_ENCRYPT_ERROR, name, err)
+		}
+		secrets = append(secrets, model.ServiceSecret{Name: name, Value: encrypted})
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
+	if err := model.SaveSecrets(service, secrets); err != nil {
+		return fmt.Errorf(config.SEC_SAVE_ERROR, err)
+	}
+	log.Infof("save service: %s secret keys: %v success", service, secretNames(secrets))
+
+	return publishSecret(namespace, service, key)
+}
+
+// DeleteSecret 删除服务指定的secret并重新发布到k8s
+func DeleteSecret(namespace, service string, names []string) error {
+	key, err := secretKey()
+	if err != nil {
+		return err
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
+	if err := model.DeleteSecrets(service, names); err != nil {
+		return fmt.Errorf(config.SEC_DELETE_ERROR, err)
+	}
+	log.Infof("delete service: %s secret keys: %v success", service, names)
+
+	return publishSecret(namespace, service, key)
+}
+
+// QuerySecret 查询服务的secret key, 不返回value
+func QuerySecret(service string) ([]SecretKey, error) {
+	secrets, err := model.FindSecrets(service)
+	if err != nil {
+		return nil, fmt.Errorf(config.SEC_QUERY_ERROR, err)
+	}
+
+	keys := make([]SecretKey, 0, len(secrets))
+	for _, secret := range secrets {
+		keys = append(keys, SecretKey{Name: secret.Name, UpdateAt: secret.UpdateAt})
+	}
+	return keys, nil
+}
+
+func secretKey() ([]byte, error) {
+	key, err := crypto.ParseKey(config.Config().Secret.Key)
+	if err != nil {
+		return nil, fmt.Errorf(config.SEC_KEY_INVALID, err)
+	}
+	return key, nil
+}
+
+func secretNames(secrets []model.ServiceSecret) []string {
+	names := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		names = append(names, secret.Name)
+	}
+	return names
+}
+
+// publishSecret 解密服务的全部secret, 渲染为一个k8s secret发布
+func publishSecret(namespace, service string, key []byte) error {
+	secrets, err := model.FindSecrets(service)
+	if err != nil {
+		return fmt.Errorf(config.SEC_QUERY_ERROR, err)
+	}
+
+	data := make(map[string][]byte, len(secrets))
+	for _, secret := range secrets {
+		value, err := crypto.Decrypt(key, secret.Value)
+		if err != nil {
+			return fmt.Errorf(config.SEC_DECRYPT_ERROR, secret.Name, err)
+		}
+		data[secret.Name] = []byte(value)
+	}
+
+	secret := renderSecret(namespace, service, data)
+	resource, err := k8s.New(namespace)
+	if err != nil {
+		return err
+	}
+	if err := resource.CreateOrUpdateSecret(namespace, secret); err != nil {
+		return fmt.Errorf(config.SEC_K8S_EXEC_FAILED, secret.Name, err)
+	}
+	log.Infof("deploy secret: %s to k8s success", secret.Name)
+	return nil
+}
+
+// renderSecret 渲染服务的secret
+func renderSecret(namespace, service string, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8s.GetSecretName(service),
+			Namespace: namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+}
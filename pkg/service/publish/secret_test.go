@@ -0,0 +1,73 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestSecret(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+
+	data := map[string]string{"DB_PASSWORD": "p@ssw0rd", "API_TOKEN": "token"}
+	if err := SetSecret(testNamespace, testService, data); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := model.FindSecrets(testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range stored {
+		if secret.Value == data[secret.Name] {
+			t.Errorf("secret: %s stored in plaintext", secret.Name)
+		}
+	}
+
+	name := k8s.GetSecretName(testService)
+	secret, err := client.CoreV1().Secrets(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["DB_PASSWORD"]) != "p@ssw0rd" || string(secret.Data["API_TOKEN"]) != "token" {
+		t.Errorf("secret data: %v", secret.Data)
+	}
+
+	if err := DeleteSecret(testNamespace, testService, []string{"API_TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := QuerySecret(testService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Name != "DB_PASSWORD" {
+		t.Errorf("secret keys: %+v", keys)
+	}
+
+	if err := SetSecret(testNamespace, testService, map[string]string{"bad key": "value"}); err == nil {
+		t.Errorf("invalid secret key should be rejected")
+	}
+
+	pipeline := createPipeline(t, model.PLProcess)
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envFrom := dep.Spec.Template.Spec.Containers[0].EnvFrom
+	if len(envFrom) != 2 || envFrom[1].SecretRef == nil || envFrom[1].SecretRef.Name != name {
+		t.Errorf("container envFrom: %+v", envFrom)
+	}
+}
@@ -26,6 +26,10 @@ func NewService() *Service {
 }
 
 func (s *Service) Handle(serviceName string) error {
+	if err := checkLock(serviceName, 0, ""); err != nil {
+		return err
+	}
+
 	svc, err := model.GetServiceInfo(serviceName)
 	if err != nil {
 		return fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
@@ -56,6 +60,22 @@ func (s *Service) Handle(serviceName string) error {
 }
 
 func (s *Service) worker(namespace, serviceName string, serviceID int64, phase, group string, port, containerPort int) error {
+	se := renderService(namespace, serviceName, serviceID, phase, group, port, containerPort)
+	name := se.Name
+
+	resource, err := k8s.New(namespace)
+	if err != nil {
+		return err
+	}
+	if err := resource.CreateOrUpdateService(namespace, se); err != nil {
+		return fmt.Errorf(config.SVC_K8S_SERVICE_EXEC_FAILED, err)
+	}
+	log.Infof("publish service resource: %s to k8s success", name)
+	return nil
+}
+
+// renderService 渲染指定阶段、部署组的service
+func renderService(namespace, serviceName string, serviceID int64, phase, group string, port, containerPort int) *corev1.Service {
 	// service名称与deployment名称保持一致
 	name := k8s.GetDeploymentName(serviceName, serviceID, phase, group)
 	labels := map[string]string{
@@ -63,6 +83,10 @@ func (s *Service) worker(namespace, serviceName string, serviceID int64, phase,
 	}
 
 	se := &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
 			Namespace: namespace,
@@ -81,14 +105,5 @@ func (s *Service) worker(namespace, serviceName string, serviceID int64, phase,
 			},
 		},
 	}
-
-	resource, err := k8s.New(namespace)
-	if err != nil {
-		return err
-	}
-	if err := resource.CreateOrUpdateService(namespace, se); err != nil {
-		return fmt.Errorf(config.SVC_K8S_SERVICE_EXEC_FAILED, err)
-	}
-	log.Infof("publish service resource: %s to k8s success", name)
-	return nil
+	return se
 }
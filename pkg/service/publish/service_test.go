@@ -0,0 +1,40 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestServiceHandle(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+
+	if err := NewService().Handle(testService); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, phase := range []string{model.PHASE_SANDBOX, model.PHASE_ONLINE} {
+		for _, group := range []string{k8s.BLUE, k8s.GREEN} {
+			name := k8s.GetDeploymentName(testService, svc.ID, phase, group)
+			se, err := client.CoreV1().Services(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("service: %s not created: %s", name, err)
+			}
+			if se.Spec.Selector["appid"] != name {
+				t.Errorf("service: %s selector: %v", name, se.Spec.Selector)
+			}
+			if port := se.Spec.Ports[0]; port.Port != 5000 || port.TargetPort.IntValue() != 5000 {
+				t.Errorf("service: %s port: %+v", name, port)
+			}
+		}
+	}
+}
@@ -9,28 +9,35 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
-	"strconv"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
+	"nautilus/pkg/util/cm"
+	"nautilus/pkg/util/metrics"
+	"nautilus/pkg/util/vcs"
 )
 
-func NewBuildTag(pid int64, serviceName string) error {
-	pidStr := strconv.FormatInt(pid, 10)
-	serviceObj, err := model.GetServiceInfo(serviceName)
-	if err != nil {
+// NewBuildTag 为上线单的变更模块打tag. 分支发布会丢失主干提交时阻止打tag, force为true时强制发布并记录为override.
+// 同一模块、提交、构建配置的编译包会被缓存复用, 重试时沿用已打的tag.
+// 各模块按build.concurrency并发执行, 单独记录状态及输出; retry为true时只重试未成功的模块.
+func NewBuildTag(pid int64, serviceName string, force, retry bool) error {
+	if _, err := model.GetServiceInfo(serviceName); err != nil {
 		return fmt.Errorf(config.DB_QUERY_SERVICE_ERROR, serviceName, err)
 	}
 
-	if serviceObj.Lock != "" && serviceObj.Lock != pidStr {
-		return fmt.Errorf(config.TAG_OPERATE_FORBIDDEN, pidStr)
+	pipeline, err := model.GetPipeline(pid)
+	if err != nil {
+		return fmt.Errorf(config.DB_PIPELINE_QUERY_ERROR, pid, err)
 	}
 
-	if err := model.SetLock(serviceObj.ID, pidStr); err != nil {
-		return fmt.Errorf(config.DB_WRITE_LOCK_ERROR, pidStr, err)
+	if err := checkLock(serviceName, pid, pipeline.Creator); err != nil {
+		return err
 	}
+	stop := keepLock(serviceName, pid, pipeline.Creator)
+	defer stop()
 
 	updateList, err := model.FindUpdateInfo(pid)
 	if err != nil {
@@ -41,26 +48,112 @@ func NewBuildTag(pid int64, serviceName string) error {
 	var (
 		mainPath   = filepath.Dir(filepath.Dir(filepath.Dir(curPath)))
 		scriptPath = filepath.Join(mainPath, "script")
+		modules    []string
+		updates    = make(map[string]model.PipelineUpdate)
 	)
 
-	ws := NewWebsocket()
-	ws.IsCmdCall = true
 	for _, item := range updateList {
-		branch := item.DeployBranch
-		codeModule, err := model.GetCodeModuleInfo(item.CodeModule)
-		if err != nil {
-			return fmt.Errorf(config.TAG_QUERY_UPDATE_ERROR, err)
+		if retry && item.TagStatus == model.PISuccess {
+			log.Infof("pipeline: %d module: %s tag already success, skip", pid, item.CodeModule)
+			continue
+		}
+		modules = append(modules, item.CodeModule)
+		updates[item.CodeModule] = item
+	}
+
+	failed := buildModules(modules, func(module string) error {
+		item := updates[module]
+		if err := model.UpdateTagStatus(pid, module, model.PIProcess, ""); err != nil {
+			log.Errorf("update pipeline: %d module: %s tag status error: %s", pid, module, err)
 		}
-		lang := codeModule.Language
-		addr := codeModule.RepoAddr
-		module := codeModule.Name
 
 		output := ""
-		param := fmt.Sprintf("%s/maketag -s %s -m %s -l %s -a %s -b %s -i %d", scriptPath, serviceName, module, lang, addr, branch, pid)
-		log.Infof("maketag command: %s", param)
-		if err := ws.Realtime(param, &output); err != nil {
-			return fmt.Errorf(config.TAG_BUILD_FAILED, err)
+		err := buildTag(scriptPath, serviceName, pid, &item, force, &output)
+		status := model.PISuccess
+		if err != nil {
+			status = model.PIFailed
+			output += err.Error() + "\n"
 		}
+		if err := model.UpdateTagStatus(pid, module, status, tailLog(output)); err != nil {
+			log.Errorf("update pipeline: %d module: %s tag status error: %s", pid, module, err)
+		}
+		return err
+	})
+	return failedModules(config.TAG_MODULES_FAILED, failed)
+}
+
+// buildTag 为单个模块生成构建脚本并执行maketag, 输出写入output
+func buildTag(scriptPath, serviceName string, pid int64, item *model.PipelineUpdate, force bool, output *string) error {
+	branch := item.DeployBranch
+	codeModule, err := model.GetCodeModuleInfo(item.CodeModule)
+	if err != nil {
+		return fmt.Errorf(config.TAG_QUERY_UPDATE_ERROR, err)
+	}
+	lang := codeModule.Language
+	addr := codeModule.RepoAddr
+	module := codeModule.Name
+	repo := codeModule.RepoName
+
+	build, err := resolveBuild(codeModule, branch)
+	if err != nil {
+		return err
+	}
+	dir := buildDir(serviceName, pid, module)
+	if err := writeBuildFiles(dir, module, build); err != nil {
+		return err
+	}
+
+	source, err := vcs.New(repo)
+	if err != nil {
+		return fmt.Errorf(config.TAG_RESOLVE_ERROR, module, branch, err)
+	}
+	// 重试时沿用已打的tag及其提交, 只重新生成编译包
+	commit, tag := item.CodeCommit, item.CodeTag
+	if commit == "" || tag == "" {
+		if commit, err = source.Resolve(addr, branch); err != nil {
+			return fmt.Errorf(config.TAG_RESOLVE_ERROR, module, branch, err)
+		}
+		if err := model.UpdateCommit(pid, module, commit); err != nil {
+			return fmt.Errorf(config.TAG_UPDATE_COMMIT_FAIL, module, err)
+		}
+		tag = ""
+	}
+	mirror, err := source.Mirror(addr)
+	if err != nil {
+		// 镜像只用于加速下载
+		log.Warnf("update module: %s mirror failed: %s", module, err)
+		mirror = ""
+	}
+
+	hash := buildHash(build)
+	artifact := artifactDir(module, commit, hash)
+	if hasArtifact(artifact) {
+		log.Infof("module: %s commit: %s reuse artifact: %s", module, commit, artifact)
+	}
+
+	param := fmt.Sprintf("%s/maketag -s %s -m %s -l %s -r %s -a %s -b %s -i %d -c %s -x %s -k %s", scriptPath, serviceName, module, lang, repo, addr, branch, pid, dir, commit, artifact)
+	if mirror != "" {
+		param += " -g " + mirror
+	}
+	if tag != "" {
+		param += " -t " + tag
+	}
+	if force {
+		param += " -f"
+	}
+	log.Infof("maketag command: %s", param)
+
+	ws := NewWebsocket()
+	ws.IsCmdCall = true
+	start := time.Now()
+	err = ws.Realtime(param, output)
+	metrics.BuildDuration.WithLabelValues(serviceName, module, "tag", metrics.Result(err)).Observe(metrics.Since(start))
+	if err != nil {
+		return fmt.Errorf(config.TAG_BUILD_FAILED, err)
+	}
+
+	if err := saveArtifact(module, commit, hash); err != nil {
+		log.Errorf("pipeline: %d %s", pid, err)
 	}
 	return nil
 }
@@ -74,6 +167,20 @@ func NewReceiveTag(pid int64, module, tag string) error {
 	return nil
 }
 
+// NewReceiveMerge 记录maketag上报的分支合并检查结果
+func NewReceiveMerge(pid int64, module string, check *model.PipelineUpdate) error {
+	if !cm.In(check.MergeStatus, []string{model.MergeSkip, model.MergePass, model.MergeBlocked, model.MergeOverride}) {
+		return fmt.Errorf(config.TAG_MERGE_INVALID, check.MergeStatus)
+	}
+
+	log.Infof("receive module: %s merge check: %s base: %s ahead: %d behind: %d",
+		module, check.MergeStatus, check.MergeBase, check.MergeAhead, check.MergeBehind)
+	if err := model.UpdateMergeCheck(pid, module, check); err != nil {
+		return fmt.Errorf(config.TAG_MERGE_UPDATE_ERROR, err)
+	}
+	return nil
+}
+
 func NewReceivePkg(pid int64, module, pkg string) error {
 	log.Infof("receive module: %s compile package: %s", module, pkg)
 	if err := model.UpdatePkg(pid, module, pkg); err != nil {
@@ -0,0 +1,45 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"testing"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestReceiveMerge(t *testing.T) {
+	setup(t, "", k8s.BLUE)
+	pipeline := createPipeline(t, model.PLWait)
+	mustInsert(t, &model.PipelineUpdate{PipelineID: pipeline.ID, CodeModule: "ivr", DeployBranch: "feature"})
+
+	check := &model.PipelineUpdate{
+		MergeStatus:  model.MergeBlocked,
+		MergeBase:    "master",
+		MergeAhead:   2,
+		MergeBehind:  1,
+		MergeCommits: "1a2b3c4 fix: lost on master",
+	}
+	if err := NewReceiveMerge(pipeline.ID, "ivr", check); err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := model.FindUpdateInfo(pipeline.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := updates[0]; u.MergeStatus != model.MergeBlocked || u.MergeBehind != 1 || u.MergeCommits != check.MergeCommits {
+		t.Errorf("merge check: %+v", u)
+	}
+
+	if err := NewReceiveMerge(pipeline.ID, "ivr", &model.PipelineUpdate{MergeStatus: "unknown"}); err == nil {
+		t.Error("invalid merge status should be rejected")
+	}
+	if err := NewReceiveMerge(pipeline.ID, "ivr_ui", check); err == nil {
+		t.Error("module not in pipeline should be rejected")
+	}
+}
@@ -0,0 +1,306 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/cm"
+)
+
+// 存储卷类型
+const (
+	VolumeHostPath  = "host_path"
+	VolumeEmptyDir  = "empty_dir"
+	VolumePVC       = "pvc"
+	VolumeConfigMap = "configmap"
+	VolumeSecret    = "secret"
+	VolumeProjected = "projected"
+)
+
+// VolumeSpec 服务的存储卷配置.
+// 名称为www、log时替换内置的代码、日志卷(挂载路径固定), 其他名称作为额外的卷挂载到业务容器.
+type VolumeSpec struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`                // 为空时按host_path处理
+	MountPath string `json:"mount_path"`          // 挂载路径
+	SubPath   string `json:"sub_path,omitempty"`  // 挂载卷内的子路径
+	ReadOnly  bool   `json:"read_only,omitempty"` // 只读挂载
+
+	HostPath  string                    `json:"host_path,omitempty"`  // host_path: 宿主机路径, 内置卷为空时使用约定目录
+	Medium    string                    `json:"medium,omitempty"`     // empty_dir: Memory表示使用tmpfs
+	SizeLimit string                    `json:"size_limit,omitempty"` // empty_dir: 容量上限, 例如: 1Gi
+	ClaimName string                    `json:"claim_name,omitempty"` // pvc: PVC名称
+	Source    string                    `json:"source,omitempty"`     // configmap、secret: 对象名称
+	Items     []corev1.KeyToPath        `json:"items,omitempty"`      // configmap、secret: 只挂载指定的key
+	Sources   []corev1.VolumeProjection `json:"sources,omitempty"`    // projected: 投射的数据源
+}
+
+// SetVolume 保存服务的存储卷配置, 在下次部署、创建定时任务时生效
+func SetVolume(service, content string) error {
+	if _, err := parseVolumes(content); err != nil {
+		return err
+	}
+
+	if err := checkLock(service, 0, ""); err != nil {
+		return err
+	}
+
+	if err := model.UpdateVolume(service, content); err != nil {
+		return fmt.Errorf(config.VOL_SAVE_ERROR, err)
+	}
+	log.Infof("save service: %s volume success", service)
+	return nil
+}
+
+// QueryVolume 查询服务的存储卷配置
+func QueryVolume(service string) ([]VolumeSpec, error) {
+	svc, err := model.GetServiceInfo(service)
+	if err != nil {
+		return nil, fmt.Errorf(config.DB_SERVICE_QUERY_ERROR, err)
+	}
+	return parseVolumes(svc.Volume)
+}
+
+func parseVolumes(content string) ([]VolumeSpec, error) {
+	if content == "" {
+		return nil, nil
+	}
+
+	var specs []VolumeSpec
+	if err := json.Unmarshal([]byte(content), &specs); err != nil {
+		return nil, fmt.Errorf(config.VOL_DECODE_ERROR, err)
+	}
+
+	names := make(map[string]bool)
+	mountPaths := map[string]bool{CodeMountPath: true, LogMountPath: true}
+	for i := range specs {
+		spec := &specs[i]
+		if spec.Type == "" {
+			spec.Type = VolumeHostPath
+		}
+		if err := validateVolume(spec); err != nil {
+			return nil, fmt.Errorf(config.VOL_SPEC_INVALID, spec.Name, err)
+		}
+
+		if names[spec.Name] {
+			return nil, fmt.Errorf(config.VOL_SPEC_INVALID, spec.Name, "duplicate name")
+		}
+		names[spec.Name] = true
+
+		if isBuiltinVolume(spec.Name) {
+			continue
+		}
+		if mountPaths[spec.MountPath] {
+			return nil, fmt.Errorf(config.VOL_SPEC_INVALID, spec.Name, "duplicate mount path: "+spec.MountPath)
+		}
+		mountPaths[spec.MountPath] = true
+	}
+	return specs, nil
+}
+
+func validateVolume(spec *VolumeSpec) error {
+	if errs := validation.IsDNS1123Label(spec.Name); len(errs) > 0 {
+		return fmt.Errorf(strings.Join(errs, "; "))
+	}
+
+	if isBuiltinVolume(spec.Name) {
+		// 内置卷挂载路径固定, 且只能使用可写的卷类型
+		if spec.MountPath != "" && spec.MountPath != builtinMountPath(spec.Name) {
+			return fmt.Errorf("mount path of builtin volume can not be changed")
+		}
+		if spec.ReadOnly || !cm.In(spec.Type, []string{VolumeHostPath, VolumeEmptyDir, VolumePVC}) {
+			return fmt.Errorf("builtin volume must be writable host_path, empty_dir or pvc")
+		}
+	} else {
+		if !path.IsAbs(spec.MountPath) {
+			return fmt.Errorf("mount path must be absolute: %s", spec.MountPath)
+		}
+		if spec.MountPath == CodeMountPath || spec.MountPath == LogMountPath {
+			return fmt.Errorf("mount path conflicts with builtin volume: %s", spec.MountPath)
+		}
+	}
+
+	switch spec.Type {
+	case VolumeHostPath:
+		if spec.HostPath == "" && !isBuiltinVolume(spec.Name) {
+			return fmt.Errorf("host_path is empty")
+		}
+		if spec.HostPath != "" && !path.IsAbs(spec.HostPath) {
+			return fmt.Errorf("host_path must be absolute: %s", spec.HostPath)
+		}
+	case VolumeEmptyDir:
+		if !cm.In(spec.Medium, []string{"", string(corev1.StorageMediumMemory)}) {
+			return fmt.Errorf("unsupported medium: %s", spec.Medium)
+		}
+		if spec.SizeLimit != "" {
+			if _, err := resource.ParseQuantity(spec.SizeLimit); err != nil {
+				return fmt.Errorf("size_limit: %s", err)
+			}
+		}
+	case VolumePVC:
+		if spec.ClaimName == "" {
+			return fmt.Errorf("claim_name is empty")
+		}
+	case VolumeConfigMap, VolumeSecret:
+		if spec.Source == "" {
+			return fmt.Errorf("source is empty")
+		}
+	case VolumeProjected:
+		if len(spec.Sources) == 0 {
+			return fmt.Errorf("sources is empty")
+		}
+	default:
+		return fmt.Errorf("unsupported type: %s", spec.Type)
+	}
+	return nil
+}
+
+func isBuiltinVolume(name string) bool {
+	return name == CodeMountPoint || name == LogMountPoint
+}
+
+func builtinMountPath(name string) string {
+	if name == CodeMountPoint {
+		return CodeMountPath
+	}
+	return LogMountPath
+}
+
+// generateVolumes 生成pod的存储卷. 内置的代码、日志卷未配置时使用hostPath约定目录:
+// 代码: /home/code/{category}/{service}/{id}, 日志: /home/logs/{category}/{namespace}/{service}
+func generateVolumes(namespace, service, category string, id int64, specs []VolumeSpec) []corev1.Volume {
+	builtin := map[string]VolumeSpec{
+		CodeMountPoint: {
+			Name:     CodeMountPoint,
+			Type:     VolumeHostPath,
+			HostPath: fmt.Sprintf("/home/code/%s/%s/%d", category, service, id),
+		},
+		LogMountPoint: {
+			Name:     LogMountPoint,
+			Type:     VolumeHostPath,
+			HostPath: fmt.Sprintf("/home/logs/%s/%s/%s", category, namespace, service),
+		},
+	}
+
+	var extra []VolumeSpec
+	for _, spec := range specs {
+		if !isBuiltinVolume(spec.Name) {
+			extra = append(extra, spec)
+			continue
+		}
+		if spec.Type == VolumeHostPath && spec.HostPath == "" {
+			spec.HostPath = builtin[spec.Name].HostPath
+		}
+		builtin[spec.Name] = spec
+	}
+
+	volumes := []corev1.Volume{
+		generateVolume(builtin[CodeMountPoint]),
+		generateVolume(builtin[LogMountPoint]),
+	}
+	for _, spec := range extra {
+		volumes = append(volumes, generateVolume(spec))
+	}
+	return volumes
+}
+
+func generateVolume(spec VolumeSpec) corev1.Volume {
+	volume := corev1.Volume{Name: spec.Name}
+
+	// 已校验过格式
+	switch spec.Type {
+	case VolumeHostPath:
+		pathType := corev1.HostPathDirectoryOrCreate
+		volume.HostPath = &corev1.HostPathVolumeSource{
+			Type: &pathType,
+			Path: spec.HostPath,
+		}
+	case VolumeEmptyDir:
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{
+			Medium: corev1.StorageMedium(spec.Medium),
+		}
+		if spec.SizeLimit != "" {
+			sizeLimit := resource.MustParse(spec.SizeLimit)
+			volume.EmptyDir.SizeLimit = &sizeLimit
+		}
+	case VolumePVC:
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: spec.ClaimName,
+			ReadOnly:  spec.ReadOnly,
+		}
+	case VolumeConfigMap:
+		volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: spec.Source},
+			Items:                spec.Items,
+		}
+	case VolumeSecret:
+		volume.Secret = &corev1.SecretVolumeSource{
+			SecretName: spec.Source,
+			Items:      spec.Items,
+		}
+	case VolumeProjected:
+		volume.Projected = &corev1.ProjectedVolumeSource{
+			Sources: spec.Sources,
+		}
+	}
+	return volume
+}
+
+func generateInitVolumeMounts(specs []VolumeSpec) []corev1.VolumeMount {
+	mount := corev1.VolumeMount{
+		Name:      CodeMountPoint,
+		MountPath: CodeMountPath,
+	}
+	for _, spec := range specs {
+		if spec.Name == CodeMountPoint {
+			mount.SubPath = spec.SubPath
+		}
+	}
+	return []corev1.VolumeMount{mount}
+}
+
+func generateMainVolumeMounts(specs []VolumeSpec) []corev1.VolumeMount {
+	var volumeMounts []corev1.VolumeMount
+
+	// 日志目录位于代码目录之下, 需在代码卷之后挂载
+	initMounts := generateInitVolumeMounts(specs)
+	volumeMounts = append(volumeMounts, initMounts...)
+
+	logMount := corev1.VolumeMount{
+		Name:      LogMountPoint,
+		MountPath: LogMountPath,
+	}
+	for _, spec := range specs {
+		if spec.Name == LogMountPoint {
+			logMount.SubPath = spec.SubPath
+		}
+	}
+	volumeMounts = append(volumeMounts, logMount)
+
+	for _, spec := range specs {
+		if isBuiltinVolume(spec.Name) {
+			continue
+		}
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      spec.Name,
+			MountPath: spec.MountPath,
+			SubPath:   spec.SubPath,
+			ReadOnly:  spec.ReadOnly,
+		})
+	}
+	return volumeMounts
+}
@@ -0,0 +1,110 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package publish
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/k8s"
+)
+
+func TestVolumeApplied(t *testing.T) {
+	client, svc := setup(t, "", k8s.BLUE)
+	createPipeline(t, model.PLSuccess)
+
+	// 未配置时代码、日志使用hostPath约定目录
+	name, err := NewCronjob(testNamespace, testService, "python job.py", "*/10 * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cronJob, err := client.BatchV1().CronJobs(testNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := cronJob.Spec.JobTemplate.Spec.Template.Spec.Volumes
+	if len(volumes) != 2 || volumes[0].HostPath == nil || volumes[1].HostPath == nil {
+		t.Fatalf("cronjob volumes: %+v", volumes)
+	}
+	want := fmt.Sprintf("/home/code/cronjob/%s/%d", testService, parseJobID(t, name))
+	if volumes[0].HostPath.Path != want {
+		t.Errorf("cronjob code host path: %s want %s", volumes[0].HostPath.Path, want)
+	}
+
+	content := `[
+		{"name": "www", "type": "empty_dir"},
+		{"name": "log", "type": "pvc", "claim_name": "logs", "sub_path": "ivr"},
+		{"name": "cert", "type": "secret", "source": "ivr-cert", "mount_path": "/etc/cert", "read_only": true}
+	]`
+	if err := SetVolume(testService, content); err != nil {
+		t.Fatal(err)
+	}
+
+	pipeline := createPipeline(t, model.PLProcess)
+	if err := NewDeploy(pipeline.ID, model.PHASE_ONLINE, "tester"); err != nil {
+		t.Fatal(err)
+	}
+
+	online := k8s.GetDeploymentName(testService, svc.ID, model.PHASE_ONLINE, k8s.BLUE)
+	dep, err := client.AppsV1().Deployments(testNamespace).Get(context.TODO(), online, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := dep.Spec.Template.Spec
+	if len(spec.Volumes) != 3 {
+		t.Fatalf("deployment volumes: %+v", spec.Volumes)
+	}
+	if spec.Volumes[0].EmptyDir == nil {
+		t.Errorf("code volume: %+v want emptyDir", spec.Volumes[0])
+	}
+	if pvc := spec.Volumes[1].PersistentVolumeClaim; pvc == nil || pvc.ClaimName != "logs" {
+		t.Errorf("log volume: %+v want pvc logs", spec.Volumes[1])
+	}
+	if secret := spec.Volumes[2].Secret; secret == nil || secret.SecretName != "ivr-cert" {
+		t.Errorf("extra volume: %+v want secret ivr-cert", spec.Volumes[2])
+	}
+
+	mounts := spec.Containers[0].VolumeMounts
+	if len(mounts) != 3 || mounts[1].SubPath != "ivr" || mounts[2].MountPath != "/etc/cert" || !mounts[2].ReadOnly {
+		t.Errorf("container volume mounts: %+v", mounts)
+	}
+	if mounts := spec.InitContainers[0].VolumeMounts; len(mounts) != 1 || mounts[0].Name != CodeMountPoint {
+		t.Errorf("init container volume mounts: %+v", mounts)
+	}
+}
+
+func TestVolumeValidate(t *testing.T) {
+	cases := []string{
+		`{"name": "www"}`,
+		`[{"name": "www", "type": "secret", "source": "code"}]`,
+		`[{"name": "log", "type": "empty_dir", "mount_path": "/var/log"}]`,
+		`[{"name": "www", "type": "pvc", "claim_name": "code", "read_only": true}]`,
+		`[{"name": "data", "type": "host_path", "mount_path": "/data"}]`,
+		`[{"name": "data", "type": "pvc", "claim_name": "data", "mount_path": "data"}]`,
+		`[{"name": "data", "type": "nfs", "mount_path": "/data"}]`,
+		`[{"name": "tmp", "type": "empty_dir", "medium": "Disk", "mount_path": "/tmp"}]`,
+		`[{"name": "a", "type": "empty_dir", "mount_path": "/data"}, {"name": "b", "type": "empty_dir", "mount_path": "/data"}]`,
+		`[{"name": "Data", "type": "empty_dir", "mount_path": "/data"}]`,
+	}
+	for i, content := range cases {
+		if _, err := parseVolumes(content); err == nil {
+			t.Errorf("case %d: %s should be invalid", i, content)
+		}
+	}
+
+	// 兼容只配置host_path的格式
+	specs, err := parseVolumes(`[{"name": "logs", "host_path": "/home/logs/default/ivr", "mount_path": "/home/tong/logs"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if specs[0].Type != VolumeHostPath {
+		t.Errorf("volume type: %s want %s", specs[0].Type, VolumeHostPath)
+	}
+}
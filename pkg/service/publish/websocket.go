@@ -30,6 +30,7 @@ var (
 type WebSocket struct {
 	conn      *websocket.Conn
 	IsCmdCall bool
+	mu        sync.Mutex // stdout、stderr同时写入output
 }
 
 func NewWebsocket() *WebSocket {
@@ -160,6 +161,8 @@ func (w *WebSocket) Realtime(param string, output *string) error {
 		return err
 	}
 
+	// 读完全部输出后再Wait, Wait会关闭管道
+	wg.Wait()
 	if err := cmd.Wait(); err != nil {
 		return err
 	}
@@ -184,6 +187,8 @@ func (w *WebSocket) read(wg *sync.WaitGroup, std io.ReadCloser, output *string)
 		} else {
 			fmt.Println(buf)
 		}
+		w.mu.Lock()
 		*output += strings.Replace(buf, "\u0000", "", -1)
+		w.mu.Unlock()
 	}
 }
@@ -8,6 +8,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Nil key不存在时返回的错误
+var Nil = redis.Nil
+
 type Redis interface {
 	Connect(addr, password string, db, pool int)
 	Ping() error
@@ -17,6 +20,8 @@ type Redis interface {
 	TTL(key string) (int64, error)
 	Exists(key string) (int64, error)
 	Del(key string) error
+	Expire(key string, expiration int) (bool, error)
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
 	AcquireLock(key, val string, expiration int) bool
 	ReleaseLock(key string) bool
 }
@@ -86,6 +91,14 @@ func (r *RedisService) Del(key string) error {
 	return r.client.Del(context.Background(), key).Err()
 }
 
+func (r *RedisService) Expire(key string, expiration int) (bool, error) {
+	return r.client.Expire(context.Background(), key, time.Duration(expiration)*time.Second).Result()
+}
+
+func (r *RedisService) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return r.client.Eval(context.Background(), script, keys, args...).Result()
+}
+
 func (r *RedisService) AcquireLock(key, val string, expiration int) bool {
 	result, err := r.SetNX(key, val, expiration)
 	if err != nil {
@@ -0,0 +1,65 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package health
+
+import (
+	"time"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/model"
+	"nautilus/pkg/util/cache"
+	"nautilus/pkg/util/rmq"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// Liveness 存活检查: 只检查数据库
+func Liveness() *Health {
+	h := New(defaultTimeout)
+	h.Register("postgres_master", model.PingMaster)
+	h.Register("postgres_slave", model.PingSlave)
+	return h
+}
+
+// Readiness 就绪检查: 数据库、k8s集群以及已配置的redis、rabbitmq
+func Readiness() *Health {
+	h := Liveness()
+	for _, item := range config.Clusters() {
+		cluster := item
+		h.Register("cluster_"+cluster, func() error {
+			return checkCluster(cluster)
+		})
+	}
+
+	if cfg := config.Config().Redis; cfg.Addr != "" {
+		h.Register("redis", func() error {
+			return checkRedis(cfg)
+		})
+	}
+
+	if cfg := config.Config().RabbitMQ; cfg.Addr != "" {
+		h.Register("rabbitmq", func() error {
+			return rmq.Ping(cfg.Addr)
+		})
+	}
+	return h
+}
+
+func checkCluster(cluster string) error {
+	clientset, err := config.GetClientset(cluster)
+	if err != nil {
+		return err
+	}
+	_, err = clientset.Discovery().ServerVersion()
+	return err
+}
+
+func checkRedis(cfg config.RedisInfo) error {
+	r := cache.NewRedisService()
+	r.Connect(cfg.Addr, cfg.Password, cfg.DB, 1)
+	defer r.Close()
+	return r.Ping()
+}
@@ -0,0 +1,117 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"nautilus/pkg/version"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Checker 单项检查, 返回nil表示检查通过
+type Checker func() error
+
+type check struct {
+	name string
+	fn   Checker
+}
+
+// Health 一组依赖检查
+type Health struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// Result 检查结果
+type Result struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func New(timeout time.Duration) *Health {
+	return &Health{
+		timeout: timeout,
+	}
+}
+
+// Register 注册检查项
+func (h *Health) Register(name string, fn Checker) {
+	h.checks = append(h.checks, check{name: name, fn: fn})
+}
+
+// Check 并发执行所有检查项, 单项超时视为失败
+func (h *Health) Check() Result {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = Result{Status: StatusOK, Checks: make(map[string]string)}
+	)
+
+	for _, item := range h.checks {
+		wg.Add(1)
+		go func(c check) {
+			defer wg.Done()
+
+			status := StatusOK
+			if err := h.run(c.fn); err != nil {
+				status = fmt.Sprintf("%s: %s", StatusFail, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checks[c.name] = status
+			if status != StatusOK {
+				result.Status = StatusFail
+			}
+		}(item)
+	}
+	wg.Wait()
+	return result
+}
+
+func (h *Health) run(fn Checker) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(h.timeout):
+		return fmt.Errorf("timeout after %s", h.timeout)
+	}
+}
+
+// ServeHTTP 检查全部通过返回200, 否则返回503
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	result := h.Check()
+	code := http.StatusOK
+	if result.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, result)
+}
+
+// VersionHandler 返回构建信息
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
+}
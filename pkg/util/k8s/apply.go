@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/util/metrics"
+)
+
+// FieldManager server-side apply时的字段管理者, 只覆盖由nautilus提交的字段
+const FieldManager = "nautilus"
+
+// ConflictError apply的字段被其他管理者(HPA、其他控制器、人工修改)持有, Fields为冲突的字段路径
+type ConflictError struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Fields    []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf(config.K8S_APPLY_CONFLICT, e.Kind, e.Namespace, e.Name, strings.Join(e.Fields, ", "))
+}
+
+// patcher 以apply patch提交对象
+type patcher func(data []byte, opts metav1.PatchOptions) error
+
+// ownManagers nautilus在apply之外修改字段时使用的管理者: 扩缩容、配置变化重启.
+// 这些字段本就由nautilus设置, 发布时可以强制取回.
+var ownManagers = []string{ReplicasManager, RestartManager}
+
+// apply 以server-side apply方式创建或更新对象.
+//
+// 不以force方式提交. resourceVersion等乐观锁冲突(不带字段管理者冲突原因)有限次重试;
+// 冲突字段都由ownManagers持有时以force方式重新提交, 只取回这些字段;
+// 字段被其他管理者(HPA、其他控制器、人工修改)持有时返回*ConflictError列出冲突字段,
+// 由调用方去掉该字段或人工处理后重试. 未声明的字段仍归原管理者所有, 不会被覆盖.
+func apply(kind, namespace, name string, obj interface{}, patch patcher) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	opts := metav1.PatchOptions{FieldManager: FieldManager}
+	err = retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.IsConflict(err) && len(managerConflicts(err)) == 0
+	}, func() error {
+		return patch(data, opts)
+	})
+	if !errors.IsConflict(err) {
+		return err
+	}
+
+	causes := managerConflicts(err)
+	if ownConflicts(causes) {
+		log.Infof("apply %s: %s/%s take back fields from nautilus managers: %s", kind, namespace, name, err)
+		force := true
+		opts.Force = &force
+		if err = patch(data, opts); !errors.IsConflict(err) {
+			return err
+		}
+		causes = managerConflicts(err)
+	}
+
+	metrics.ApplyConflicts.WithLabelValues(kind).Inc()
+	conflict := &ConflictError{Kind: kind, Namespace: namespace, Name: name}
+	for _, cause := range causes {
+		conflict.Fields = append(conflict.Fields, fmt.Sprintf("%s(%s)", cause.Field, cause.Message))
+	}
+	if len(conflict.Fields) == 0 {
+		conflict.Fields = append(conflict.Fields, err.Error())
+	}
+	log.Warnf("apply %s: %s/%s conflict: %s", kind, namespace, name, err)
+	return conflict
+}
+
+// managerConflicts 冲突中字段被其他管理者持有的原因, 乐观锁冲突没有
+func managerConflicts(err error) []metav1.StatusCause {
+	causes := make([]metav1.StatusCause, 0)
+	status, ok := err.(errors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return causes
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			causes = append(causes, cause)
+		}
+	}
+	return causes
+}
+
+// ownConflicts 冲突原因都指向ownManagers, 原因形如: conflict with "nautilus-replicas" using apps/v1
+func ownConflicts(causes []metav1.StatusCause) bool {
+	if len(causes) == 0 {
+		return false
+	}
+	for _, cause := range causes {
+		own := false
+		for _, manager := range ownManagers {
+			if strings.Contains(cause.Message, `"`+manager+`"`) {
+				own = true
+			}
+		}
+		if !own {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func managerConflict(manager string) error {
+	causes := []metav1.StatusCause{{
+		Type:    metav1.CauseTypeFieldManagerConflict,
+		Field:   ".spec.replicas",
+		Message: `conflict with "` + manager + `" using apps/v1`,
+	}}
+	return k8serrors.NewApplyConflict(causes, "Apply failed with 1 conflict")
+}
+
+func TestApply(t *testing.T) {
+	optimistic := k8serrors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "ivr", errors.New("the object has been modified"))
+
+	cases := []struct {
+		name     string
+		errs     []error
+		patches  int
+		force    bool
+		conflict bool
+	}{
+		{name: "applied", errs: []error{nil}, patches: 1},
+		{name: "optimistic conflict retried", errs: []error{optimistic, optimistic, nil}, patches: 3},
+		{name: "replicas held by scale", errs: []error{managerConflict(ReplicasManager), nil}, patches: 2, force: true},
+		{name: "annotation held by restart", errs: []error{managerConflict(RestartManager), nil}, patches: 2, force: true},
+		{name: "field held by other manager", errs: []error{managerConflict("kubectl-scale")}, patches: 1, conflict: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := make([]metav1.PatchOptions, 0)
+			err := apply("Deployment", "default", "ivr", map[string]string{}, func(data []byte, opt metav1.PatchOptions) error {
+				opts = append(opts, opt)
+				return c.errs[len(opts)-1]
+			})
+
+			var conflict *ConflictError
+			if errors.As(err, &conflict) != c.conflict {
+				t.Fatalf("apply error: %v want conflict: %v", err, c.conflict)
+			}
+			if !c.conflict && err != nil {
+				t.Fatal(err)
+			}
+			if len(opts) != c.patches {
+				t.Fatalf("patches: %d want %d", len(opts), c.patches)
+			}
+			for i, opt := range opts {
+				if opt.FieldManager != FieldManager {
+					t.Errorf("patch %d field manager: %s", i, opt.FieldManager)
+				}
+				force := opt.Force != nil && *opt.Force
+				if want := c.force && i == len(opts)-1; force != want {
+					t.Errorf("patch %d force: %v want %v", i, force, want)
+				}
+			}
+		})
+	}
+}
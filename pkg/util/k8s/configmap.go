@@ -4,8 +4,8 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -19,10 +19,10 @@ type ConfigMap interface {
 }
 
 type ConfigMapResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewConfigMapResource(clientset *kubernetes.Clientset) *ConfigMapResource {
+func NewConfigMapResource(clientset kubernetes.Interface) *ConfigMapResource {
 	return &ConfigMapResource{
 		clientset: clientset,
 	}
@@ -42,17 +42,14 @@ func (c *ConfigMapResource) UpdateConfigMap(namespace string, configMap *corev1.
 	return err
 }
 
+// CreateOrUpdateConfigMap 以server-side apply方式创建或更新, 保留其他管理者持有的字段
 func (c *ConfigMapResource) CreateOrUpdateConfigMap(namespace string, configMap *corev1.ConfigMap) error {
-	storedConfigMap, err := c.GetConfigMap(namespace, configMap.Name)
-	if err != nil {
-		// If no resource we need to create.
-		if errors.IsNotFound(err) {
-			return c.CreateConfigMap(namespace, configMap)
-		}
-	}
-
-	configMap.ResourceVersion = storedConfigMap.ResourceVersion
-	return c.UpdateConfigMap(namespace, configMap)
+	configMap.APIVersion = "v1"
+	configMap.Kind = "ConfigMap"
+	return apply(configMap.Kind, namespace, configMap.Name, configMap, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := c.clientset.CoreV1().ConfigMaps(namespace).Patch(context.TODO(), configMap.Name, types.ApplyPatchType, data, opts)
+		return err
+	})
 }
 
 func (c *ConfigMapResource) DeleteConfigMap(namespace, name string) error {
@@ -4,8 +4,8 @@ import (
 	"context"
 
 	batchv1 "k8s.io/api/batch/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -19,10 +19,10 @@ type CronJob interface {
 }
 
 type CronJobResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewCronJobResource(clientset *kubernetes.Clientset) *CronJobResource {
+func NewCronJobResource(clientset kubernetes.Interface) *CronJobResource {
 	return &CronJobResource{
 		clientset: clientset,
 	}
@@ -42,16 +42,14 @@ func (c *CronJobResource) UpdateCronJob(namespace string, cronJob *batchv1.CronJ
 	return err
 }
 
+// CreateOrUpdateCronJob 以server-side apply方式创建或更新, 保留其他管理者持有的字段
 func (c *CronJobResource) CreateOrUpdateCronJob(namespace string, cronJob *batchv1.CronJob) error {
-	storedCronJob, err := c.GetCronJob(namespace, cronJob.Name)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return c.CreateCronJob(namespace, cronJob)
-		}
-	}
-
-	cronJob.ResourceVersion = storedCronJob.ResourceVersion
-	return c.UpdateCronJob(namespace, cronJob)
+	cronJob.APIVersion = "batch/v1"
+	cronJob.Kind = "CronJob"
+	return apply(cronJob.Kind, namespace, cronJob.Name, cronJob, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := c.clientset.BatchV1().CronJobs(namespace).Patch(context.TODO(), cronJob.Name, types.ApplyPatchType, data, opts)
+		return err
+	})
 }
 
 func (c *CronJobResource) DeleteCronJob(namespace, name string) error {
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -10,6 +11,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -22,13 +24,22 @@ type Deployment interface {
 	DeleteDeployment(namespace, name string) error
 	ListDeployments(namespace string) (*appsv1.DeploymentList, error)
 	Scale(namespace, name string, replicas int32) error
+	Restart(namespace, name string, annotations map[string]string) error
+	HandoverReplicas(namespace, name string) error
 }
 
+const (
+	// ReplicasManager 扩缩容及副本数交给HPA前的过渡管理者
+	ReplicasManager = "nautilus-replicas"
+	// RestartManager 配置变化重启时更新pod模板注解的管理者
+	RestartManager = "nautilus-restart"
+)
+
 type DeploymentResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewDeploymentResource(clientset *kubernetes.Clientset) *DeploymentResource {
+func NewDeploymentResource(clientset kubernetes.Interface) *DeploymentResource {
 	return &DeploymentResource{
 		clientset: clientset,
 	}
@@ -67,20 +78,15 @@ func (r *DeploymentResource) UpdateDeployment(namespace string, deployment *apps
 	log.Debugf("namespace: %s deployment: %s updated", namespace, deployment.ObjectMeta.Name)
 	return nil
 }
+
+// CreateOrUpdateDeployment 以server-side apply方式创建或更新, 保留其他管理者持有的字段
 func (r *DeploymentResource) CreateOrUpdateDeployment(namespace string, deployment *appsv1.Deployment) error {
-	storedDeployment, err := r.GetDeployment(namespace, deployment.Name)
-	if err != nil {
-		// If no resource we need to create.
-		if errors.IsNotFound(err) {
-			return r.CreateDeployment(namespace, deployment)
-		}
+	deployment.APIVersion = "apps/v1"
+	deployment.Kind = "Deployment"
+	return apply(deployment.Kind, namespace, deployment.Name, deployment, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := r.clientset.AppsV1().Deployments(namespace).Patch(context.TODO(), deployment.Name, types.ApplyPatchType, data, opts)
 		return err
-	}
-
-	// Already exists, need to Update.
-	// Set the correct resource version to ensure we are on the latest version.
-	deployment.ResourceVersion = storedDeployment.ResourceVersion
-	return r.UpdateDeployment(namespace, deployment)
+	})
 }
 
 func (r *DeploymentResource) DeleteDeployment(namespace, name string) error {
@@ -92,11 +98,78 @@ func (r *DeploymentResource) ListDeployments(namespace string) (*appsv1.Deployme
 	return r.clientset.AppsV1().Deployments(namespace).List(context.TODO(), metav1.ListOptions{})
 }
 
+// Scale 以ReplicasManager只提交spec.replicas, 强制取得副本数的所有权.
+// 以Update修改时apiserver记录一个持有spec.replicas的Update管理者, 下次发布apply副本数会冲突;
+// ReplicasManager持有的字段由apply强制取回.
 func (r *DeploymentResource) Scale(namespace, name string, replicas int32) error {
+	if _, err := r.GetDeployment(namespace, name); err != nil {
+		return err
+	}
+	return r.applyReplicas(namespace, name, replicas, true)
+}
+
+// Restart 更新pod模板的注解触发滚动重启, 与kubectl rollout restart相同.
+// 以RestartManager提交apply patch, 发布时apply强制取回注解, 不会与Update管理者冲突.
+func (r *DeploymentResource) Restart(namespace, name string, annotations map[string]string) error {
+	patch := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": annotations,
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	force := true
+	opts := metav1.PatchOptions{FieldManager: RestartManager, Force: &force}
+	_, err = r.clientset.AppsV1().Deployments(namespace).Patch(context.TODO(), name, types.ApplyPatchType, data, opts)
+	return err
+}
+
+// HandoverReplicas 副本数交给HPA管理前调用. apply中直接去掉nautilus持有的spec.replicas会将副本数重置为默认值,
+// 这里先以过渡管理者按当前值声明副本数, HPA修改副本数时所有权随之转移.
+func (r *DeploymentResource) HandoverReplicas(namespace, name string) error {
 	deployment, err := r.GetDeployment(namespace, name)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if deployment.Spec.Replicas == nil {
+		return nil
+	}
+	return r.applyReplicas(namespace, name, *deployment.Spec.Replicas, false)
+}
+
+func (r *DeploymentResource) applyReplicas(namespace, name string, replicas int32, force bool) error {
+	patch := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	}
+	data, err := json.Marshal(patch)
 	if err != nil {
 		return err
 	}
-	deployment.Spec.Replicas = &replicas
-	return r.UpdateDeployment(namespace, deployment)
+
+	opts := metav1.PatchOptions{FieldManager: ReplicasManager, Force: &force}
+	_, err = r.clientset.AppsV1().Deployments(namespace).Patch(context.TODO(), name, types.ApplyPatchType, data, opts)
+	return err
 }
@@ -0,0 +1,115 @@
+package k8s
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// request apiserver收到的patch请求
+type request struct {
+	contentType  string
+	fieldManager string
+	force        string
+	body         map[string]interface{}
+}
+
+// newTestDeployment 以httptest模拟apiserver, 记录patch请求的类型和参数, fake clientset不记录PatchOptions
+func newTestDeployment(t *testing.T) (*DeploymentResource, *[]request) {
+	t.Helper()
+
+	replicas := int32(3)
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "ivr", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+
+	requests := make([]request, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch {
+			data, _ := io.ReadAll(r.Body)
+			body := make(map[string]interface{})
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Errorf("patch body: %s", err)
+			}
+			requests = append(requests, request{
+				contentType:  r.Header.Get("Content-Type"),
+				fieldManager: r.URL.Query().Get("fieldManager"),
+				force:        r.URL.Query().Get("force"),
+				body:         body,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deployment)
+	}))
+	t.Cleanup(server.Close)
+
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDeploymentResource(clientset), &requests
+}
+
+func TestScale(t *testing.T) {
+	resource, requests := newTestDeployment(t)
+
+	if err := resource.Scale("default", "ivr", 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("patches: %d want 1", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.contentType != string(types.ApplyPatchType) || req.fieldManager != ReplicasManager || req.force != "true" {
+		t.Errorf("scale patch: %s manager: %s force: %s", req.contentType, req.fieldManager, req.force)
+	}
+	// 只提交副本数
+	spec, _ := req.body["spec"].(map[string]interface{})
+	if len(spec) != 1 || spec["replicas"] != float64(0) {
+		t.Errorf("scale patch spec: %v", spec)
+	}
+}
+
+func TestHandoverReplicas(t *testing.T) {
+	resource, requests := newTestDeployment(t)
+
+	if err := resource.HandoverReplicas("default", "ivr"); err != nil {
+		t.Fatal(err)
+	}
+	req := (*requests)[0]
+	if req.contentType != string(types.ApplyPatchType) || req.fieldManager != ReplicasManager || req.force == "true" {
+		t.Errorf("handover patch: %s manager: %s force: %s", req.contentType, req.fieldManager, req.force)
+	}
+	if spec, _ := req.body["spec"].(map[string]interface{}); spec["replicas"] != float64(3) {
+		t.Errorf("handover patch spec: %v", spec)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	resource, requests := newTestDeployment(t)
+
+	if err := resource.Restart("default", "ivr", map[string]string{"nautilus/configmap-checksum": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("patches: %d want 1", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.contentType != string(types.ApplyPatchType) || req.fieldManager != RestartManager || req.force != "true" {
+		t.Errorf("restart patch: %s manager: %s force: %s", req.contentType, req.fieldManager, req.force)
+	}
+	spec, _ := req.body["spec"].(map[string]interface{})
+	if len(spec) != 1 || spec["template"] == nil {
+		t.Errorf("restart patch spec: %v", spec)
+	}
+}
@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"context"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+type HPA interface {
+	GetHPA(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error)
+	CreateOrUpdateHPA(namespace string, hpa *autoscalingv2.HorizontalPodAutoscaler) error
+	DeleteHPA(namespace, name string) error
+}
+
+type HPAResource struct {
+	clientset kubernetes.Interface
+}
+
+func NewHPAResource(clientset kubernetes.Interface) *HPAResource {
+	return &HPAResource{
+		clientset: clientset,
+	}
+}
+
+func (h *HPAResource) GetHPA(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	return h.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// CreateOrUpdateHPA 以server-side apply方式创建或更新, 保留其他管理者持有的字段
+func (h *HPAResource) CreateOrUpdateHPA(namespace string, hpa *autoscalingv2.HorizontalPodAutoscaler) error {
+	hpa.APIVersion = "autoscaling/v2"
+	hpa.Kind = "HorizontalPodAutoscaler"
+	return apply(hpa.Kind, namespace, hpa.Name, hpa, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := h.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Patch(context.TODO(), hpa.Name, types.ApplyPatchType, data, opts)
+		return err
+	})
+}
+
+// DeleteHPA 删除HPA, 不存在时忽略
+func (h *HPAResource) DeleteHPA(namespace, name string) error {
+	err := h.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
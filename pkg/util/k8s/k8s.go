@@ -2,6 +2,9 @@ package k8s
 
 import (
 	"fmt"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
 
 	"nautilus/pkg/config"
 	"nautilus/pkg/model"
@@ -14,6 +17,8 @@ type Resource interface {
 	Pod
 	CronJob
 	Secret
+	HPA
+	PDB
 }
 
 type resource struct {
@@ -23,19 +28,47 @@ type resource struct {
 	Pod
 	CronJob
 	Secret
+	HPA
+	PDB
+}
+
+// ClientsetProvider 根据集群名返回对应的clientset
+type ClientsetProvider func(cluster string) (kubernetes.Interface, error)
+
+var (
+	providerLock sync.RWMutex
+	provider     ClientsetProvider = config.GetClientset
+)
+
+// SetClientsetProvider 替换clientset的获取方式, 例如测试时注入fake clientset
+func SetClientsetProvider(p ClientsetProvider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	provider = p
+}
+
+func getClientset(cluster string) (kubernetes.Interface, error) {
+	providerLock.RLock()
+	defer providerLock.RUnlock()
+	return provider(cluster)
 }
 
+// New 根据命名空间所在集群创建资源操作对象
 func New(namespace string) (Resource, error) {
 	cluster, err := model.GetClusterByNamespace(namespace)
 	if err != nil {
 		return nil, fmt.Errorf(config.DB_QUERY_CLUSTER_ERROR, err)
 	}
 
-	clientset, err := config.GetClientset(cluster)
+	clientset, err := getClientset(cluster)
 	if err != nil {
 		return nil, fmt.Errorf(config.PUB_GET_CLIENTSET_ERROR, err)
 	}
+	return NewResource(clientset), nil
+}
 
+// NewResource 基于指定clientset创建资源操作对象
+func NewResource(clientset kubernetes.Interface) Resource {
 	return &resource{
 		Deployment: NewDeploymentResource(clientset),
 		Service:    NewServiceResource(clientset),
@@ -43,5 +76,7 @@ func New(namespace string) (Resource, error) {
 		Pod:        NewPodResouce(clientset),
 		CronJob:    NewCronJobResource(clientset),
 		Secret:     NewSecretResource(clientset),
-	}, nil
+		HPA:        NewHPAResource(clientset),
+		PDB:        NewPDBResource(clientset),
+	}
 }
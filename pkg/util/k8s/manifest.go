@@ -0,0 +1,120 @@
+package k8s
+
+import (
+	"encoding/json"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+// 由集群写入的元数据字段, 渲染及对比时忽略
+var serverMetadata = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"managedFields",
+	"selfLink",
+}
+
+// ToYAML 将资源对象渲染为yaml, 去掉status及集群写入的元数据
+func ToYAML(obj interface{}) (string, error) {
+	content, err := toContent(obj)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := yaml.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// ToDeclaredYAML 将线上对象渲染为yaml, 只保留渲染对象声明的字段.
+// apply只覆盖声明的字段, apiserver填充的默认值及其他管理者的字段不会改变, 对比时一并去掉.
+func ToDeclaredYAML(live, rendered interface{}) (string, error) {
+	liveContent, err := toContent(live)
+	if err != nil {
+		return "", err
+	}
+	renderedContent, err := toContent(rendered)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := yaml.Marshal(declared(liveContent, renderedContent))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func toContent(obj interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var content map[string]interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range serverMetadata {
+			delete(metadata, field)
+		}
+	}
+	return content, nil
+}
+
+// declared 只保留live中rendered声明的字段. 列表按下标对比, live多出的元素原样保留, 对比时显示为删除
+func declared(live, rendered interface{}) interface{} {
+	switch r := rendered.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		result := make(map[string]interface{}, len(r))
+		for key, value := range r {
+			if lv, ok := l[key]; ok {
+				result[key] = declared(lv, value)
+			}
+		}
+		return result
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		result := make([]interface{}, len(l))
+		for i := range l {
+			if i < len(r) {
+				result[i] = declared(l[i], r[i])
+			} else {
+				result[i] = l[i]
+			}
+		}
+		return result
+	default:
+		return live
+	}
+}
+
+// Diff 生成线上对象(live)与渲染对象(rendered)的unified diff, 无差异返回空串
+func Diff(live, rendered string) (string, error) {
+	return DiffNamed("live", live, "rendered", rendered)
+}
+
+// DiffNamed 生成两段文本的unified diff, 使用指定的文件名标识两侧, 无差异返回空串
+func DiffNamed(fromFile, from, toFile, to string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+}
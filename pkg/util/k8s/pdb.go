@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"context"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+type PDB interface {
+	GetPDB(namespace, name string) (*policyv1.PodDisruptionBudget, error)
+	CreateOrUpdatePDB(namespace string, pdb *policyv1.PodDisruptionBudget) error
+	DeletePDB(namespace, name string) error
+}
+
+type PDBResource struct {
+	clientset kubernetes.Interface
+}
+
+func NewPDBResource(clientset kubernetes.Interface) *PDBResource {
+	return &PDBResource{
+		clientset: clientset,
+	}
+}
+
+func (p *PDBResource) GetPDB(namespace, name string) (*policyv1.PodDisruptionBudget, error) {
+	return p.clientset.PolicyV1().PodDisruptionBudgets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// CreateOrUpdatePDB 以server-side apply方式创建或更新, 保留其他管理者持有的字段
+func (p *PDBResource) CreateOrUpdatePDB(namespace string, pdb *policyv1.PodDisruptionBudget) error {
+	pdb.APIVersion = "policy/v1"
+	pdb.Kind = "PodDisruptionBudget"
+	return apply(pdb.Kind, namespace, pdb.Name, pdb, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := p.clientset.PolicyV1().PodDisruptionBudgets(namespace).Patch(context.TODO(), pdb.Name, types.ApplyPatchType, data, opts)
+		return err
+	})
+}
+
+// DeletePDB 删除PDB, 不存在时忽略
+func (p *PDBResource) DeletePDB(namespace, name string) error {
+	err := p.clientset.PolicyV1().PodDisruptionBudgets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -17,10 +17,10 @@ type Pod interface {
 }
 
 type PodResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewPodResouce(clientset *kubernetes.Clientset) *PodResource {
+func NewPodResouce(clientset kubernetes.Interface) *PodResource {
 	return &PodResource{
 		clientset: clientset,
 	}
@@ -4,8 +4,8 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -17,10 +17,10 @@ type Secret interface {
 }
 
 type SecretResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewSecretResource(clientset *kubernetes.Clientset) *SecretResource {
+func NewSecretResource(clientset kubernetes.Interface) *SecretResource {
 	return &SecretResource{
 		clientset: clientset,
 	}
@@ -40,14 +40,12 @@ func (s *SecretResource) UpdateSecret(namespace string, secret *corev1.Secret) e
 	return err
 }
 
+// CreateOrUpdateSecret 以server-side apply方式创建或更新, 保留其他管理者持有的字段
 func (s *SecretResource) CreateOrUpdateSecret(namespace string, secret *corev1.Secret) error {
-	storedSecret, err := s.GetSecret(namespace, secret.Name)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return s.CreateSecret(namespace, secret)
-		}
-	}
-
-	secret.ResourceVersion = storedSecret.ResourceVersion
-	return s.UpdateSecret(namespace, secret)
+	secret.APIVersion = "v1"
+	secret.Kind = "Secret"
+	return apply(secret.Kind, namespace, secret.Name, secret, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := s.clientset.CoreV1().Secrets(namespace).Patch(context.TODO(), secret.Name, types.ApplyPatchType, data, opts)
+		return err
+	})
 }
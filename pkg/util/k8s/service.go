@@ -6,6 +6,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -20,10 +21,10 @@ type Service interface {
 }
 
 type ServiceResource struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 }
 
-func NewServiceResource(clientset *kubernetes.Clientset) *ServiceResource {
+func NewServiceResource(clientset kubernetes.Interface) *ServiceResource {
 	return &ServiceResource{
 		clientset: clientset,
 	}
@@ -53,17 +54,14 @@ func (s *ServiceResource) UpdateService(namespace string, service *corev1.Servic
 	return err
 }
 
+// CreateOrUpdateService 以server-side apply方式创建或更新, 保留其他管理者持有的字段
 func (s *ServiceResource) CreateOrUpdateService(namespace string, service *corev1.Service) error {
-	storedService, err := s.GetService(namespace, service.Name)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			return s.CreateService(namespace, service)
-		}
+	service.APIVersion = "v1"
+	service.Kind = "Service"
+	return apply(service.Kind, namespace, service.Name, service, func(data []byte, opts metav1.PatchOptions) error {
+		_, err := s.clientset.CoreV1().Services(namespace).Patch(context.TODO(), service.Name, types.ApplyPatchType, data, opts)
 		return err
-	}
-
-	service.ResourceVersion = storedService.ResourceVersion
-	return s.UpdateService(namespace, service)
+	})
 }
 
 func (s *ServiceResource) DeleteService(namespace, name string) error {
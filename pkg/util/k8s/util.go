@@ -27,9 +27,19 @@ func GetAnotherGroup(group string) string {
 	return GetDeployGroup(group)
 }
 
-// GetConfigmapName 生成configmap名字 规则: 服务名-config
-func GetConfigmapName(serviceName string) string {
-	return fmt.Sprintf("%s-config", serviceName)
+// GetHPAName 生成HPA名字, 不区分部署组, 蓝绿切换时改变绑定的deployment. 规则: 服务名-服务ID-部署阶段
+func GetHPAName(serviceName string, serviceID int64, phase string) string {
+	return fmt.Sprintf("%s-%d-%s", serviceName, serviceID, phase)
+}
+
+// GetConfigmapName 生成deployment、cronjob各自使用的configmap名字, 配置随部署组回滚. 规则: 资源名-config
+func GetConfigmapName(resourceName string) string {
+	return fmt.Sprintf("%s-config", resourceName)
+}
+
+// GetSecretName 生成secret名字 规则: 服务名-secret
+func GetSecretName(serviceName string) string {
+	return fmt.Sprintf("%s-secret", serviceName)
 }
 
 // GetCronjobName 生成cronjob名字 规则: 服务名-cronjob-任务ID
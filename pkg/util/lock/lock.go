@@ -0,0 +1,123 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package lock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/config"
+	"nautilus/pkg/util/cache"
+)
+
+const (
+	DriverRedis    = "redis"
+	DriverPostgres = "postgres"
+
+	defaultTTL = 4 * time.Hour
+)
+
+var ErrNotHeld = fmt.Errorf("service lock not held")
+
+// Owner 锁持有者信息
+type Owner struct {
+	Pipeline int64     `json:"pipeline"`
+	User     string    `json:"user"`
+	Since    time.Time `json:"since"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// Key 持有者标识: 上线单占锁时以上线单为准, 否则以用户为准
+func (o Owner) Key() string {
+	if o.Pipeline > 0 {
+		return fmt.Sprintf("pipeline:%d", o.Pipeline)
+	}
+	return fmt.Sprintf("user:%s", o.User)
+}
+
+// LockedError 服务被其他持有者占用
+type LockedError struct {
+	Service string
+	Owner   Owner
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf(config.LOCK_HELD_BY_OTHER, e.Service, e.Owner.Pipeline, e.Owner.User,
+		e.Owner.Since.Format("2006-01-02 15:04:05"))
+}
+
+// Locker 服务锁
+type Locker interface {
+	// Acquire 占锁, 同一持有者重复占锁视为续期; 被占用时返回*LockedError
+	Acquire(service string, owner Owner) error
+	// Renew 续期, 锁不属于owner时返回ErrNotHeld
+	Renew(service string, owner Owner) error
+	// Release 释放owner持有的锁
+	Release(service string, owner Owner) error
+	// Get 返回当前持有者, 未占用时返回nil
+	Get(service string) (*Owner, error)
+	// ForceUnlock 强制解锁并记录审计信息, 返回被释放的持有者
+	ForceUnlock(service, operator, reason string) (*Owner, error)
+}
+
+var (
+	locker Locker
+	once   sync.Once
+)
+
+// Init 根据配置初始化服务锁, 只在启动时生效一次
+func Init(cfg config.LockInfo) {
+	once.Do(func() {
+		ttl := time.Duration(cfg.TTL) * time.Second
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+
+		switch cfg.Driver {
+		case DriverRedis:
+			r := cache.NewRedisService()
+			rc := config.Config().Redis
+			r.Connect(rc.Addr, rc.Password, rc.DB, rc.Pool)
+			locker = NewRedisLocker(r, ttl)
+		default:
+			locker = NewPostgresLocker(ttl)
+		}
+		log.Infof("init service lock driver: %s ttl: %s", cfg.Driver, ttl)
+	})
+}
+
+// Default 返回全局服务锁, 未调用Init时(如测试)使用默认ttl的postgres锁
+func Default() Locker {
+	once.Do(func() {
+		locker = NewPostgresLocker(defaultTTL)
+	})
+	return locker
+}
+
+// KeepAlive 在长时间操作期间定期续期, 返回停止续期的函数
+func KeepAlive(service string, owner Owner, interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := Default().Renew(service, owner); err != nil {
+					log.Errorf("renew service: %s lock for %s failed: %s", service, owner.Key(), err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
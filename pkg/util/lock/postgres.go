@@ -0,0 +1,90 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package lock
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/model"
+)
+
+// PostgresLocker 基于service_lock表的服务锁, postgres存储下占锁时使用advisory锁保证互斥
+type PostgresLocker struct {
+	ttl time.Duration
+}
+
+func NewPostgresLocker(ttl time.Duration) *PostgresLocker {
+	return &PostgresLocker{
+		ttl: ttl,
+	}
+}
+
+func (l *PostgresLocker) Acquire(service string, owner Owner) error {
+	sl, ok, err := model.TryServiceLock(service, owner.Key(), owner.Pipeline, owner.User, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &LockedError{Service: service, Owner: toOwner(sl)}
+	}
+	log.Infof("service: %s locked by %s until %s", service, owner.Key(), sl.ExpireAt.Format(time.RFC3339))
+	return nil
+}
+
+func (l *PostgresLocker) Renew(service string, owner Owner) error {
+	err := model.RenewServiceLock(service, owner.Key(), l.ttl)
+	if errors.Is(err, model.NotFound) {
+		return ErrNotHeld
+	}
+	return err
+}
+
+func (l *PostgresLocker) Release(service string, owner Owner) error {
+	return model.ReleaseServiceLock(service, owner.Key())
+}
+
+func (l *PostgresLocker) Get(service string) (*Owner, error) {
+	sl, err := model.GetServiceLock(service)
+	if errors.Is(err, model.NotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	owner := toOwner(sl)
+	return &owner, nil
+}
+
+func (l *PostgresLocker) ForceUnlock(service, operator, reason string) (*Owner, error) {
+	sl, err := model.ForceReleaseServiceLock(service)
+	if errors.Is(err, model.NotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	owner := toOwner(sl)
+	if err := audit(service, owner, operator, reason); err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+func toOwner(sl *model.ServiceLock) Owner {
+	return Owner{
+		Pipeline: sl.PipelineID,
+		User:     sl.Username,
+		Since:    sl.Since,
+		ExpireAt: sl.ExpireAt,
+	}
+}
+
+func audit(service string, owner Owner, operator, reason string) error {
+	log.Warnf("service: %s lock held by %s force unlocked by: %s reason: %s", service, owner.Key(), operator, reason)
+	return model.CreateLockAudit(service, owner.Pipeline, owner.User, owner.Since, operator, reason)
+}
@@ -0,0 +1,135 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"nautilus/pkg/util/cache"
+)
+
+// 持有者一致时才续期/删除
+const (
+	renewScript = `
+local val = redis.call("GET", KEYS[1])
+if not val then return 0 end
+local owner = cjson.decode(val)
+if owner["key"] ~= ARGV[1] then return 0 end
+owner["expire_at"] = ARGV[3]
+redis.call("SET", KEYS[1], cjson.encode(owner), "EX", ARGV[2])
+return 1`
+
+	releaseScript = `
+local val = redis.call("GET", KEYS[1])
+if not val then return 0 end
+local owner = cjson.decode(val)
+if owner["key"] ~= ARGV[1] then return 0 end
+return redis.call("DEL", KEYS[1])`
+)
+
+// RedisLocker 基于redis key过期的服务锁
+type RedisLocker struct {
+	redis cache.Redis
+	ttl   time.Duration
+}
+
+type redisOwner struct {
+	Owner
+	Key string `json:"key"`
+}
+
+func NewRedisLocker(redis cache.Redis, ttl time.Duration) *RedisLocker {
+	return &RedisLocker{
+		redis: redis,
+		ttl:   ttl,
+	}
+}
+
+func (l *RedisLocker) key(service string) string {
+	return "nautilus:lock:service:" + service
+}
+
+func (l *RedisLocker) Acquire(service string, owner Owner) error {
+	now := time.Now()
+	owner.Since = now
+	owner.ExpireAt = now.Add(l.ttl)
+	val, err := json.Marshal(redisOwner{Owner: owner, Key: owner.Key()})
+	if err != nil {
+		return err
+	}
+
+	ok, err := l.redis.SetNX(l.key(service), string(val), int(l.ttl.Seconds()))
+	if err != nil {
+		return err
+	}
+	if ok {
+		log.Infof("service: %s locked by %s until %s", service, owner.Key(), owner.ExpireAt.Format(time.RFC3339))
+		return nil
+	}
+
+	// 已被占用: 同一持有者续期, 否则返回持有者信息
+	current, err := l.Get(service)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return l.Acquire(service, owner)
+	}
+	if current.Key() == owner.Key() {
+		return l.Renew(service, owner)
+	}
+	return &LockedError{Service: service, Owner: *current}
+}
+
+func (l *RedisLocker) Renew(service string, owner Owner) error {
+	expireAt := time.Now().Add(l.ttl).Format(time.RFC3339Nano)
+	result, err := l.redis.Eval(renewScript, []string{l.key(service)}, owner.Key(), int(l.ttl.Seconds()), expireAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.(int64); n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+func (l *RedisLocker) Release(service string, owner Owner) error {
+	_, err := l.redis.Eval(releaseScript, []string{l.key(service)}, owner.Key())
+	return err
+}
+
+func (l *RedisLocker) Get(service string) (*Owner, error) {
+	val, err := l.redis.Get(l.key(service))
+	if errors.Is(err, cache.Nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ro redisOwner
+	if err := json.Unmarshal([]byte(val), &ro); err != nil {
+		return nil, err
+	}
+	return &ro.Owner, nil
+}
+
+func (l *RedisLocker) ForceUnlock(service, operator, reason string) (*Owner, error) {
+	owner, err := l.Get(service)
+	if err != nil || owner == nil {
+		return nil, err
+	}
+	if err := l.redis.Del(l.key(service)); err != nil {
+		return nil, err
+	}
+	if err := audit(service, *owner, operator, reason); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
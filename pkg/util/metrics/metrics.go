@@ -0,0 +1,120 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "nautilus"
+
+var (
+	// HTTPRequestDuration 接口请求耗时
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// PhaseDuration 发布阶段耗时(从阶段创建到阶段结束)
+	PhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of pipeline phases from creation to completion.",
+		Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"kind", "phase", "status"})
+
+	// BuildDuration 模块构建耗时(打tag编译、构建镜像)
+	BuildDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "build_duration_seconds",
+		Help:      "Duration of code module builds.",
+		Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"service", "module", "step", "result"})
+
+	// RollbackTotal 回滚次数
+	RollbackTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rollback_total",
+		Help:      "Number of rollbacks by service and result.",
+	}, []string{"service", "result"})
+
+	// EventDuration informer事件处理耗时
+	EventDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "informer_event_duration_seconds",
+		Help:      "Informer event handling latency by resource type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"resource", "mode"})
+
+	// EventErrors informer事件处理失败次数
+	EventErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "informer_event_errors_total",
+		Help:      "Informer event handling errors by resource type.",
+	}, []string{"resource", "mode"})
+
+	// CronjobRuns 定时任务运行结果
+	CronjobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cronjob_runs_total",
+		Help:      "Cronjob run results by service.",
+	}, []string{"service", "result"})
+
+	// ApplyConflicts server-side apply字段冲突次数
+	ApplyConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "apply_conflicts_total",
+		Help:      "Server-side apply field ownership conflicts by resource kind.",
+	}, []string{"kind"})
+)
+
+// 结果标签
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequestDuration,
+		PhaseDuration,
+		BuildDuration,
+		RollbackTotal,
+		EventDuration,
+		EventErrors,
+		CronjobRuns,
+		ApplyConflicts,
+	)
+}
+
+// Handler 返回/metrics对应的http handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// MustRegister 注册自定义collector
+func MustRegister(cs ...prometheus.Collector) {
+	prometheus.MustRegister(cs...)
+}
+
+// Result 根据错误返回结果标签
+func Result(err error) string {
+	if err != nil {
+		return ResultFailed
+	}
+	return ResultSuccess
+}
+
+// Since 返回从start开始经过的秒数
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,50 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// PipelineCount 服务在某个状态下的pipeline数量
+type PipelineCount struct {
+	Service string
+	Status  string
+	Total   int64
+}
+
+// PipelineCollector 在每次采集时按服务、状态统计pipeline数量
+type PipelineCollector struct {
+	desc  *prometheus.Desc
+	fetch func() ([]PipelineCount, error)
+}
+
+func NewPipelineCollector(fetch func() ([]PipelineCount, error)) *PipelineCollector {
+	return &PipelineCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "pipelines"),
+			"Number of pipelines by service and status.",
+			[]string{"service", "status"}, nil,
+		),
+		fetch: fetch,
+	}
+}
+
+func (c *PipelineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *PipelineCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.fetch()
+	if err != nil {
+		log.Errorf("collect pipeline metrics failed: %s", err)
+		return
+	}
+	for _, item := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(item.Total), item.Service, item.Status)
+	}
+}
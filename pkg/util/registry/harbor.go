@@ -0,0 +1,51 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Harbor 查询沿用Registry V2接口, 删除使用Harbor API, 不需要仓库开启删除, 空间由Harbor的垃圾回收任务释放
+type Harbor struct {
+	*V2
+}
+
+// Delete 删除tag对应的artifact. repository的第一段为项目, 其余为仓库名
+func (h *Harbor) Delete(repository, tag string) error {
+	i := strings.Index(repository, "/")
+	if i <= 0 {
+		return fmt.Errorf("invalid harbor repository: %s", repository)
+	}
+	project, name := repository[:i], repository[i+1:]
+
+	// 仓库名中的/需要两次转义
+	path := fmt.Sprintf("/api/v2.0/projects/%s/repositories/%s/artifacts/%s",
+		url.PathEscape(project), url.PathEscape(url.PathEscape(name)), url.PathEscape(tag))
+	req, err := http.NewRequest(http.MethodDelete, h.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("delete harbor artifact: %s:%s status code: %d", repository, tag, resp.StatusCode)
+	}
+}
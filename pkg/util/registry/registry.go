@@ -0,0 +1,83 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"nautilus/pkg/config"
+)
+
+// 镜像仓库类型, 与配置registry.kind一致
+const (
+	KindRegistry = "registry"
+	KindHarbor   = "harbor"
+)
+
+// Registry 镜像仓库操作, repository不包含仓库地址, 例如: code/ivr
+type Registry interface {
+	// Digest 镜像tag对应manifest的digest, 不存在时返回ErrNotFound
+	Digest(repository, tag string) (string, error)
+	// Tags 镜像的全部tag, 镜像不存在时为空
+	Tags(repository string) ([]string, error)
+	// Delete 删除镜像tag, 不存在时忽略. NOTE: 指向同一manifest的其他tag会一并删除
+	Delete(repository, tag string) error
+}
+
+// ErrNotFound 镜像tag不存在
+var ErrNotFound = errors.New("manifest unknown")
+
+// Provider 根据仓库地址返回对应的镜像仓库操作
+type Provider func(host string) (Registry, error)
+
+var (
+	providerLock sync.RWMutex
+	provider     Provider = newRegistry
+)
+
+// SetProvider 替换镜像仓库的创建方式, 例如测试时注入fake仓库
+func SetProvider(p Provider) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	provider = p
+}
+
+// New 按配置的仓库类型创建仓库地址对应的镜像仓库操作
+func New(host string) (Registry, error) {
+	providerLock.RLock()
+	defer providerLock.RUnlock()
+	return provider(host)
+}
+
+// Enabled 是否配置了镜像仓库
+func Enabled() bool {
+	return config.Config().Registry.Kind != ""
+}
+
+// Split 将镜像地址拆分为仓库地址和镜像名, 例如: 10.12.28.4:80/code/ivr -> 10.12.28.4:80, code/ivr
+func Split(image string) (string, string, error) {
+	i := strings.Index(image, "/")
+	if i <= 0 || i == len(image)-1 {
+		return "", "", fmt.Errorf("invalid image: %s", image)
+	}
+	return image[:i], image[i+1:], nil
+}
+
+func newRegistry(host string) (Registry, error) {
+	cfg := config.Config().Registry
+	v2 := NewV2(host, cfg.Username, cfg.Password, cfg.Insecure)
+	switch cfg.Kind {
+	case KindRegistry:
+		return v2, nil
+	case KindHarbor:
+		return &Harbor{V2: v2}, nil
+	default:
+		return nil, fmt.Errorf("unsupported registry kind: %q", cfg.Kind)
+	}
+}
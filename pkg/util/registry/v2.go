@@ -0,0 +1,238 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package registry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifest类型, 查询digest时需声明, 否则仓库返回转换后的v1 manifest
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// WWW-Authenticate中的参数, 例如: Bearer realm="https://auth/token",service="registry",scope="repository:code/ivr:pull"
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Link中的下一页, 例如: </v2/code/ivr/tags/list?last=v-1&n=1000>; rel="next"
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// V2 Docker Registry HTTP API V2, 支持basic及token认证
+type V2 struct {
+	base     string
+	username string
+	password string
+	client   *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // 按scope缓存token
+}
+
+func NewV2(host, username, password string, insecure bool) *V2 {
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return &V2{
+		base:     scheme + "://" + host,
+		username: username,
+		password: password,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true, // 忽略证书校验
+				},
+			},
+		},
+		tokens: make(map[string]string),
+	}
+}
+
+func (r *V2) Digest(repository, tag string) (string, error) {
+	header := map[string]string{"Accept": strings.Join(manifestTypes, ", ")}
+	resp, err := r.do(http.MethodHead, "/v2/"+repository+"/manifests/"+tag, "repository:"+repository+":pull", header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		digest := resp.Header.Get("Docker-Content-Digest")
+		if digest == "" {
+			return "", fmt.Errorf("manifest: %s:%s without digest", repository, tag)
+		}
+		return digest, nil
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	default:
+		return "", fmt.Errorf("head manifest: %s:%s status code: %d", repository, tag, resp.StatusCode)
+	}
+}
+
+func (r *V2) Tags(repository string) ([]string, error) {
+	var (
+		tags []string
+		path = "/v2/" + repository + "/tags/list?n=1000"
+	)
+	for path != "" {
+		resp, err := r.do(http.MethodGet, path, "repository:"+repository+":pull", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return tags, nil
+		} else if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("list tags: %s status code: %d", repository, resp.StatusCode)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("decode tags: %s error: %s", repository, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		path = ""
+		if match := nextLink.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			path = strings.TrimPrefix(match[1], r.base)
+		}
+	}
+	return tags, nil
+}
+
+// Delete 按digest删除manifest, 仓库需开启storage.delete.enabled
+func (r *V2) Delete(repository, tag string) error {
+	digest, err := r.Digest(repository, tag)
+	if err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	resp, err := r.do(http.MethodDelete, "/v2/"+repository+"/manifests/"+digest, "repository:"+repository+":delete", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("delete manifest: %s@%s status code: %d", repository, digest, resp.StatusCode)
+	}
+}
+
+// do 发送请求, 返回401时按WWW-Authenticate获取token后重试一次
+func (r *V2) do(method, path, scope string, header map[string]string) (*http.Response, error) {
+	r.mu.Lock()
+	token := r.tokens[scope]
+	r.mu.Unlock()
+
+	resp, err := r.send(method, path, token, header)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("%s %s unauthorized", method, path)
+	}
+	if token, err = r.token(challenge); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.tokens[scope] = token
+	r.mu.Unlock()
+	return r.send(method, path, token, header)
+}
+
+func (r *V2) send(method, path, token string, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, r.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	return r.client.Do(req)
+}
+
+// token 向认证服务获取token
+func (r *V2) token(challenge string) (string, error) {
+	params := make(map[string]string)
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("invalid auth challenge: %s", challenge)
+	}
+
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", fmt.Errorf("get registry token status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("decode registry token error: %s", err)
+	}
+	if result.Token != "" {
+		return result.Token, nil
+	}
+	return result.AccessToken, nil
+}
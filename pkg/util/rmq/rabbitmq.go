@@ -48,6 +48,15 @@ func NewRabbitMQ(addr, exchange, queue, routingKey string) (*RabbitMQ, error) {
 	return rmq, nil
 }
 
+// Ping 检查mq是否可以连接
+func Ping(addr string) error {
+	conn, err := amqp.Dial(addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 func (r *RabbitMQ) Connect() error {
 	var err error
 	if r.conn, err = amqp.Dial(r.addr); err != nil {
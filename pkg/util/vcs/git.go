@@ -0,0 +1,172 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package vcs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nautilus/pkg/config"
+)
+
+// DefaultMirrorPath 未配置build.mirror时的本地镜像目录
+const DefaultMirrorPath = "/tmp/code/mirror"
+
+// 同一仓库的镜像同时只允许一个git进程更新
+var mirrorLocks sync.Map
+
+// Git 分支、tag均为仓库内的引用
+type Git struct{}
+
+func (g *Git) Kind() string {
+	return GIT
+}
+
+func (g *Git) HasBranch(addr, branch string) (bool, error) {
+	output, err := run("git", "ls-remote", "--heads", addr, branch)
+	if err != nil {
+		return false, err
+	}
+	// ls-remote按后缀匹配, release也会列出feature/release, 需要完整比较引用名
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == "refs/heads/"+branch {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *Git) Changelog(addr, from, to string) (*Changelog, error) {
+	dir, err := g.Mirror(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-C", dir, "log", "--date=iso-strict", "--format=%H%x1f%an%x1f%ad%x1f%s"}
+	if from == "" {
+		args = append(args, "-n", strconv.Itoa(firstReleaseCommits), to)
+	} else {
+		args = append(args, from+".."+to)
+	}
+	output, err := run("git", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	changelog := &Changelog{Commits: parseGitLog(output), Files: []FileStat{}}
+	if from == "" {
+		return changelog, nil
+	}
+
+	output, err = run("git", "-C", dir, "diff", "--numstat", from, to)
+	if err != nil {
+		return nil, err
+	}
+	parseNumstat(changelog, output)
+	return changelog, nil
+}
+
+// parseGitLog 每行一个提交, 字段以\x1f分隔: sha、作者、时间、标题
+func parseGitLog(output string) []Commit {
+	commits := []Commit{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		commits = append(commits, Commit{ID: fields[0], Author: fields[1], Date: fields[2], Message: fields[3]})
+	}
+	return commits
+}
+
+// parseNumstat 每行一个文件: 增加行数、删除行数、路径
+func parseNumstat(changelog *Changelog, output string) {
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		changelog.addFile(FileStat{Path: fields[2], Added: numstat(fields[0]), Deleted: numstat(fields[1])})
+	}
+}
+
+func (g *Git) ReadFile(addr, branch, file string) ([]byte, error) {
+	dir, err := g.Mirror(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	object := branch + ":" + file
+	if _, err := run("git", "-C", dir, "cat-file", "-e", object); err != nil {
+		return nil, ErrNotExist
+	}
+	output, err := run("git", "-C", dir, "show", object)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+func (g *Git) Resolve(addr, branch string) (string, error) {
+	dir, err := g.Mirror(addr)
+	if err != nil {
+		return "", err
+	}
+	output, err := run("git", "-C", dir, "rev-parse", "--verify", "refs/heads/"+branch+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Mirror 维护仓库的本地镜像, 已存在时增量获取
+func (g *Git) Mirror(addr string) (string, error) {
+	dir := mirrorPath(addr)
+	root := filepath.Dir(dir)
+
+	value, _ := mirrorLocks.LoadOrStore(dir, new(sync.Mutex))
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := os.Stat(dir); err == nil {
+		_, err := run("git", "-C", dir, "remote", "update", "--prune")
+		return dir, err
+	}
+
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return "", err
+	}
+	if _, err := run("git", "clone", "--mirror", "-q", addr, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// mirrorPath 镜像目录: 仓库名加地址摘要, 同名的不同仓库互不影响
+func mirrorPath(addr string) string {
+	root := config.Config().Build.Mirror
+	if root == "" {
+		root = DefaultMirrorPath
+	}
+	sum := sha1.Sum([]byte(addr))
+	return filepath.Join(root, strings.TrimSuffix(filepath.Base(addr), ".git")+"-"+hex.EncodeToString(sum[:])[:12])
+}
+
+// numstat 二进制文件的行数为-
+func numstat(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,231 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package vcs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"nautilus/pkg/config"
+)
+
+// 本地git仓库, 分支: master、release、feature/release、release-1.
+// tag v1到v2之间有两次提交, 修改了main.py并增加了二进制文件logo.png
+var testRepo string
+
+func TestMain(m *testing.M) {
+	root, err := os.MkdirTemp("", "vcs_repo")
+	if err != nil {
+		panic(err)
+	}
+	testRepo = filepath.Join(root, "ivr.git")
+	commit := []string{"-C", testRepo, "-c", "user.name=tester", "-c", "user.email=tester@local", "commit", "-q"}
+
+	steps := []func() error{
+		gitStep("init", "-q", "-b", "master", testRepo),
+		writeStep("main.py", "print('v1')\n"),
+		gitStep("-C", testRepo, "add", "-A"),
+		gitStep(append(commit, "-m", "init")...),
+		gitStep("-C", testRepo, "tag", "v1"),
+		writeStep("main.py", "print('v2')\nprint('done')\n"),
+		gitStep(append(commit, "-a", "-m", "update main")...),
+		writeStep("logo.png", "\x89PNG\x00\x01\x02"),
+		gitStep("-C", testRepo, "add", "-A"),
+		gitStep(append(commit, "-m", "add logo")...),
+		gitStep("-C", testRepo, "tag", "v2"),
+		gitStep("-C", testRepo, "branch", "release"),
+		gitStep("-C", testRepo, "branch", "feature/release"),
+		gitStep("-C", testRepo, "branch", "release-1"),
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			panic(err)
+		}
+	}
+
+	// 镜像写到临时目录
+	cfg := filepath.Join(root, "config.yaml")
+	if err := os.WriteFile(cfg, []byte("build:\n  mirror: "+filepath.Join(root, "mirror")+"\n"), 0644); err != nil {
+		panic(err)
+	}
+	config.ParseConfig(cfg)
+
+	code := m.Run()
+	os.RemoveAll(root)
+	os.Exit(code)
+}
+
+func gitStep(args ...string) func() error {
+	return func() error {
+		_, err := run("git", args...)
+		return err
+	}
+}
+
+func writeStep(name, content string) func() error {
+	return func() error {
+		return os.WriteFile(filepath.Join(testRepo, name), []byte(content), 0644)
+	}
+}
+
+func TestGitHasBranch(t *testing.T) {
+	cases := []struct {
+		branch string
+		want   bool
+	}{
+		{branch: "master", want: true},
+		{branch: "release", want: true},
+		{branch: "feature/release", want: true},
+		{branch: "feature", want: false},
+		{branch: "rel", want: false},
+		{branch: "release-2", want: false},
+	}
+
+	g := &Git{}
+	for _, c := range cases {
+		t.Run(c.branch, func(t *testing.T) {
+			has, err := g.HasBranch(testRepo, c.branch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if has != c.want {
+				t.Errorf("has branch: %v want %v", has, c.want)
+			}
+		})
+	}
+
+	if _, err := g.HasBranch(filepath.Join(filepath.Dir(testRepo), "unknown.git"), "master"); err == nil {
+		t.Error("has branch of unknown repo: want error")
+	}
+}
+
+func TestParseNumstat(t *testing.T) {
+	cases := []struct {
+		name    string
+		output  string
+		files   []FileStat
+		added   int
+		deleted int
+	}{
+		{
+			name:    "text",
+			output:  "2\t1\tmain.py\n10\t0\tconf/app.yaml\n",
+			files:   []FileStat{{Path: "main.py", Added: 2, Deleted: 1}, {Path: "conf/app.yaml", Added: 10}},
+			added:   12,
+			deleted: 1,
+		},
+		{
+			name:    "binary",
+			output:  "-\t-\tlogo.png\n3\t3\tmain.py\n",
+			files:   []FileStat{{Path: "logo.png", Added: -1, Deleted: -1}, {Path: "main.py", Added: 3, Deleted: 3}},
+			added:   3,
+			deleted: 3,
+		},
+		{
+			name:   "path with tab",
+			output: "1\t0\tdocs/a\tb.md\n",
+			files:  []FileStat{{Path: "docs/a\tb.md", Added: 1}},
+			added:  1,
+		},
+		{
+			name:  "empty",
+			files: []FileStat{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			changelog := &Changelog{Files: []FileStat{}}
+			parseNumstat(changelog, c.output)
+			if !reflect.DeepEqual(changelog.Files, c.files) {
+				t.Errorf("files: %+v want %+v", changelog.Files, c.files)
+			}
+			if changelog.Added != c.added || changelog.Deleted != c.deleted {
+				t.Errorf("added: %d deleted: %d want %d %d", changelog.Added, changelog.Deleted, c.added, c.deleted)
+			}
+		})
+	}
+}
+
+func TestParseGitLog(t *testing.T) {
+	output := "a1\x1ftester\x1f2022-06-01T10:00:00+08:00\x1fupdate main\nbroken line\nb2\x1ftester\x1f2022-06-01T09:00:00+08:00\x1finit\n"
+	want := []Commit{
+		{ID: "a1", Author: "tester", Date: "2022-06-01T10:00:00+08:00", Message: "update main"},
+		{ID: "b2", Author: "tester", Date: "2022-06-01T09:00:00+08:00", Message: "init"},
+	}
+	if commits := parseGitLog(output); !reflect.DeepEqual(commits, want) {
+		t.Errorf("commits: %+v want %+v", commits, want)
+	}
+	if commits := parseGitLog(""); len(commits) != 0 {
+		t.Errorf("empty log commits: %+v", commits)
+	}
+}
+
+func TestGitChangelog(t *testing.T) {
+	g := &Git{}
+
+	changelog, err := g.Changelog(testRepo, "v1", "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]string, 0, len(changelog.Commits))
+	for _, commit := range changelog.Commits {
+		messages = append(messages, commit.Message)
+	}
+	if !reflect.DeepEqual(messages, []string{"add logo", "update main"}) {
+		t.Errorf("commits: %v", messages)
+	}
+	files := []FileStat{{Path: "logo.png", Added: -1, Deleted: -1}, {Path: "main.py", Added: 2, Deleted: 1}}
+	if !reflect.DeepEqual(changelog.Files, files) {
+		t.Errorf("files: %+v want %+v", changelog.Files, files)
+	}
+	if changelog.Added != 2 || changelog.Deleted != 1 {
+		t.Errorf("added: %d deleted: %d", changelog.Added, changelog.Deleted)
+	}
+
+	// 首次上线只列出提交
+	changelog, err = g.Changelog(testRepo, "", "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changelog.Commits) != 3 || len(changelog.Files) != 0 {
+		t.Errorf("first release commits: %d files: %d", len(changelog.Commits), len(changelog.Files))
+	}
+}
+
+func TestMirrorPath(t *testing.T) {
+	root := config.Config().Build.Mirror
+
+	dir := mirrorPath("https://git.local/ops/ivr.git")
+	if filepath.Dir(dir) != root || !strings.HasPrefix(filepath.Base(dir), "ivr-") {
+		t.Errorf("mirror path: %s", dir)
+	}
+	if mirrorPath("https://git.local/ops/ivr.git") != dir {
+		t.Error("mirror path not stable")
+	}
+	// 同名的不同仓库使用不同的镜像
+	if other := mirrorPath("https://git.local/dev/ivr.git"); other == dir {
+		t.Errorf("mirror path conflict: %s", other)
+	}
+
+	mirror, err := (&Git{}).Mirror(testRepo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mirror != mirrorPath(testRepo) {
+		t.Errorf("mirror: %s want %s", mirror, mirrorPath(testRepo))
+	}
+	if _, err := os.Stat(filepath.Join(mirror, "HEAD")); err != nil {
+		t.Errorf("mirror not cloned: %s", err)
+	}
+	// 已存在时增量更新
+	if _, err := (&Git{}).Mirror(testRepo); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,184 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package vcs
+
+import (
+	"encoding/xml"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SVN仓库采用标准布局: trunk、branches、tags
+const (
+	SVNTrunk    = "trunk"
+	SVNBranches = "branches"
+	SVNTags     = "tags"
+)
+
+// Subversion 分支、tag均为仓库内的目录, 打tag即svn copy到tags/下
+type Subversion struct{}
+
+type svnLog struct {
+	Entries []struct {
+		Revision string `xml:"revision,attr"`
+		Author   string `xml:"author"`
+		Date     string `xml:"date"`
+		Msg      string `xml:"msg"`
+	} `xml:"logentry"`
+}
+
+func (s *Subversion) Kind() string {
+	return SVN
+}
+
+// HasBranch 列出分支的上级目录, 区分分支不存在与访问仓库失败
+func (s *Subversion) HasBranch(addr, branch string) (bool, error) {
+	parent, name := path.Split(branchURL(addr, branch))
+	output, err := run("svn", "ls", "--non-interactive", parent)
+	if err != nil {
+		return false, err
+	}
+	return listed(output, name+"/"), nil
+}
+
+// Changelog tag为copy出的目录, 沿to的历史列出from之后的提交, 以两个目录的diff统计行数
+func (s *Subversion) Changelog(addr, from, to string) (*Changelog, error) {
+	toURL := tagURL(addr, to)
+	args := []string{"log", "--non-interactive", "--xml"}
+	if from == "" {
+		args = append(args, "-l", strconv.Itoa(firstReleaseCommits), toURL)
+	} else {
+		output, err := run("svn", "info", "--non-interactive", "--show-item", "last-changed-revision", tagURL(addr, from))
+		if err != nil {
+			return nil, err
+		}
+		rev, err := strconv.Atoi(strings.TrimSpace(output))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-r", "HEAD:"+strconv.Itoa(rev+1), toURL)
+	}
+
+	output, err := run("svn", args...)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := parseSVNLog(output)
+	if err != nil {
+		return nil, err
+	}
+	changelog := &Changelog{Commits: commits, Files: []FileStat{}}
+	if from == "" {
+		return changelog, nil
+	}
+
+	output, err = run("svn", "diff", "--non-interactive", tagURL(addr, from), toURL)
+	if err != nil {
+		return nil, err
+	}
+	parseSVNDiff(changelog, output)
+	return changelog, nil
+}
+
+// parseSVNLog 解析svn log --xml的输出, 提交说明只取第一行
+func parseSVNLog(output string) ([]Commit, error) {
+	var logs svnLog
+	if err := xml.Unmarshal([]byte(output), &logs); err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+	for _, entry := range logs.Entries {
+		message := strings.TrimSpace(entry.Msg)
+		if i := strings.Index(message, "\n"); i >= 0 {
+			message = message[:i]
+		}
+		commits = append(commits, Commit{ID: "r" + entry.Revision, Author: entry.Author, Date: entry.Date, Message: message})
+	}
+	return commits, nil
+}
+
+// parseSVNDiff 按Index:分隔文件, 统计+、-开头的行, 跳过+++、---文件头.
+// 二进制文件svn只输出Cannot display, 行数与git一致记为-1
+func parseSVNDiff(changelog *Changelog, output string) {
+	var stat *FileStat
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Index: "):
+			if stat != nil {
+				changelog.addFile(*stat)
+			}
+			stat = &FileStat{Path: strings.TrimPrefix(line, "Index: ")}
+		case stat == nil, strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "Cannot display: file marked as a binary type."):
+			stat.Added, stat.Deleted = -1, -1
+		case strings.HasPrefix(line, "+"):
+			stat.Added++
+		case strings.HasPrefix(line, "-"):
+			stat.Deleted++
+		}
+	}
+	if stat != nil {
+		changelog.addFile(*stat)
+	}
+}
+
+// ReadFile 先列出文件所在目录, 区分文件不存在与访问仓库失败
+func (s *Subversion) ReadFile(addr, branch, file string) ([]byte, error) {
+	fileURL := branchURL(addr, branch) + "/" + strings.TrimPrefix(file, "/")
+	parent, name := path.Split(fileURL)
+	output, err := run("svn", "ls", "--non-interactive", parent)
+	if err != nil {
+		return nil, err
+	}
+
+	if !listed(output, name) {
+		return nil, ErrNotExist
+	}
+
+	output, err = run("svn", "cat", "--non-interactive", fileURL)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+func (s *Subversion) Resolve(addr, branch string) (string, error) {
+	output, err := run("svn", "info", "--non-interactive", "--show-item", "last-changed-revision", branchURL(addr, branch))
+	if err != nil {
+		return "", err
+	}
+	return "r" + strings.TrimSpace(output), nil
+}
+
+// Mirror svn检出只获取单个版本, 不维护本地镜像
+func (s *Subversion) Mirror(addr string) (string, error) {
+	return "", nil
+}
+
+// listed svn ls的输出中是否有name, 目录以/结尾
+func listed(output, name string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// branchURL trunk为主干, 其他为branches下的分支, 与maketag中svn_branch_url一致
+func branchURL(addr, branch string) string {
+	addr = strings.TrimSuffix(addr, "/")
+	if branch == SVNTrunk {
+		return addr + "/" + SVNTrunk
+	}
+	return addr + "/" + SVNBranches + "/" + branch
+}
+
+func tagURL(addr, tag string) string {
+	return strings.TrimSuffix(addr, "/") + "/" + SVNTags + "/" + tag
+}
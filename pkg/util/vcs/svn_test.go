@@ -0,0 +1,162 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package vcs
+
+import (
+	"reflect"
+	"testing"
+)
+
+// svn log --xml的输出, 版本从新到旧
+const svnLogFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<log>
+<logentry revision="12">
+<author>tester</author>
+<date>2022-06-01T02:00:00.000000Z</date>
+<msg>add logo
+
+detail of the change</msg>
+</logentry>
+<logentry revision="11">
+<author>tester</author>
+<date>2022-06-01T01:00:00.000000Z</date>
+<msg>  update main
+</msg>
+</logentry>
+</log>
+`
+
+// svn diff两个tag目录的输出, 包含文本修改、新增文件和二进制文件
+const svnDiffFixture = `Index: main.py
+===================================================================
+--- main.py	(.../tags/released_ivr_1)	(revision 10)
++++ main.py	(.../tags/released_ivr_2)	(revision 12)
+@@ -1 +1,2 @@
+-print('v1')
++print('v2')
++print('done')
+Index: conf/app.yaml
+===================================================================
+--- conf/app.yaml	(nonexistent)
++++ conf/app.yaml	(.../tags/released_ivr_2)	(revision 12)
+@@ -0,0 +1,2 @@
++--- 
++port: 8080
+Index: logo.png
+===================================================================
+Cannot display: file marked as a binary type.
+svn:mime-type = application/octet-stream
+`
+
+func TestListed(t *testing.T) {
+	// svn ls的输出, 目录以/结尾
+	output := "ivr_release/\nivr_release-1/\nREADME.md\r\n"
+
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{name: "ivr_release/", want: true},
+		{name: "ivr_release-1/", want: true},
+		{name: "README.md", want: true},
+		{name: "ivr/", want: false},
+		{name: "ivr_release", want: false},
+		{name: "README.md/", want: false},
+	}
+	for _, c := range cases {
+		if got := listed(output, c.name); got != c.want {
+			t.Errorf("listed %s: %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSVNURL(t *testing.T) {
+	cases := []struct {
+		addr   string
+		branch string
+		want   string
+	}{
+		{addr: "svn://svn.local/ivr", branch: SVNTrunk, want: "svn://svn.local/ivr/trunk"},
+		{addr: "svn://svn.local/ivr/", branch: SVNTrunk, want: "svn://svn.local/ivr/trunk"},
+		{addr: "svn://svn.local/ivr", branch: "release", want: "svn://svn.local/ivr/branches/release"},
+	}
+	for _, c := range cases {
+		if got := branchURL(c.addr, c.branch); got != c.want {
+			t.Errorf("branch url %s %s: %s want %s", c.addr, c.branch, got, c.want)
+		}
+	}
+
+	if got := tagURL("svn://svn.local/ivr/", "released_ivr_1"); got != "svn://svn.local/ivr/tags/released_ivr_1" {
+		t.Errorf("tag url: %s", got)
+	}
+}
+
+func TestParseSVNLog(t *testing.T) {
+	commits, err := parseSVNLog(svnLogFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Commit{
+		{ID: "r12", Author: "tester", Date: "2022-06-01T02:00:00.000000Z", Message: "add logo"},
+		{ID: "r11", Author: "tester", Date: "2022-06-01T01:00:00.000000Z", Message: "update main"},
+	}
+	if !reflect.DeepEqual(commits, want) {
+		t.Errorf("commits: %+v want %+v", commits, want)
+	}
+
+	if commits, err := parseSVNLog("<?xml version=\"1.0\"?>\n<log>\n</log>\n"); err != nil || len(commits) != 0 {
+		t.Errorf("empty log commits: %+v %v", commits, err)
+	}
+	if _, err := parseSVNLog("svn: E170013: Unable to connect"); err == nil {
+		t.Error("parse invalid log: want error")
+	}
+}
+
+func TestParseSVNDiff(t *testing.T) {
+	cases := []struct {
+		name    string
+		output  string
+		files   []FileStat
+		added   int
+		deleted int
+	}{
+		{
+			name:   "fixture",
+			output: svnDiffFixture,
+			files: []FileStat{
+				{Path: "main.py", Added: 2, Deleted: 1},
+				{Path: "conf/app.yaml", Added: 2},
+				{Path: "logo.png", Added: -1, Deleted: -1},
+			},
+			added:   4,
+			deleted: 1,
+		},
+		{
+			name:  "empty",
+			files: []FileStat{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			changelog := &Changelog{Files: []FileStat{}}
+			parseSVNDiff(changelog, c.output)
+			if !reflect.DeepEqual(changelog.Files, c.files) {
+				t.Errorf("files: %+v want %+v", changelog.Files, c.files)
+			}
+			if changelog.Added != c.added || changelog.Deleted != c.deleted {
+				t.Errorf("added: %d deleted: %d want %d %d", changelog.Added, changelog.Deleted, c.added, c.deleted)
+			}
+		})
+	}
+}
+
+func TestSVNMirror(t *testing.T) {
+	// svn不维护本地镜像
+	if mirror, err := (&Subversion{}).Mirror("svn://svn.local/ivr"); err != nil || mirror != "" {
+		t.Errorf("svn mirror: %s %v", mirror, err)
+	}
+}
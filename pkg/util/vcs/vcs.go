@@ -0,0 +1,95 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// 代码仓库类型, 与code_module.repo_name一致
+const (
+	GIT = "GIT"
+	SVN = "SVN"
+)
+
+// VCS 代码仓库操作. 检出、打tag由maketag脚本按仓库类型(-r)执行, 与这里的实现保持一致.
+type VCS interface {
+	// Kind 仓库类型
+	Kind() string
+	// HasBranch 检查远程仓库是否存在分支
+	HasBranch(addr, branch string) (bool, error)
+	// Changelog 两个tag之间的提交及文件变更, from为空时(首次上线)只列出to最近的提交
+	Changelog(addr, from, to string) (*Changelog, error)
+	// ReadFile 读取分支上的文件, 文件不存在时返回ErrNotExist
+	ReadFile(addr, branch, file string) ([]byte, error)
+	// Resolve 分支当前的提交, git为sha, svn为r版本号
+	Resolve(addr, branch string) (string, error)
+	// Mirror 更新并返回仓库的本地镜像, 检出代码时作为参考仓库增量获取; 不支持时返回空
+	Mirror(addr string) (string, error)
+}
+
+// ErrNotExist 仓库中文件不存在
+var ErrNotExist = errors.New("file not exist in repo")
+
+// 首次上线没有对比的tag时, 最多列出的提交数
+const firstReleaseCommits = 50
+
+// Commit 一次提交
+type Commit struct {
+	ID      string `json:"id"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Message string `json:"message"`
+}
+
+// FileStat 单个文件的变更行数, 二进制文件为-1
+type FileStat struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+}
+
+// Changelog 变更记录及diffstat
+type Changelog struct {
+	Commits []Commit   `json:"commits"`
+	Files   []FileStat `json:"files"`
+	Added   int        `json:"added"`
+	Deleted int        `json:"deleted"`
+}
+
+func (c *Changelog) addFile(stat FileStat) {
+	c.Files = append(c.Files, stat)
+	if stat.Added > 0 {
+		c.Added += stat.Added
+	}
+	if stat.Deleted > 0 {
+		c.Deleted += stat.Deleted
+	}
+}
+
+// New 按模块的仓库类型选择实现
+func New(repoName string) (VCS, error) {
+	switch strings.ToUpper(repoName) {
+	case GIT:
+		return &Git{}, nil
+	case SVN:
+		return &Subversion{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported repo: %s", repoName)
+	}
+}
+
+// run 直接执行命令, 不经过shell, 分支名等参数不会被解释
+func run(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %s: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
@@ -0,0 +1,38 @@
+// copyright @ 2022 ops inc.
+//
+// author: jinlong yang
+//
+
+package version
+
+import (
+	"runtime"
+)
+
+// 构建信息, 编译时通过-ldflags注入, 例如:
+//
+//	go build -ldflags "-X nautilus/pkg/version.Version=v1.0.0 -X nautilus/pkg/version.GitCommit=$(git rev-parse HEAD)"
+var (
+	Version   = "unknown"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get 返回当前二进制的构建信息
+func Get() Info {
+	return Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
@@ -52,6 +52,33 @@ function report_pkg() {
     request $url $errmsg
 }
 
+# 落后的提交可能包含特殊字符, 以POST表单上报
+function report_merge() {
+    taskid=$1
+    module=$2
+    status=$3
+    errmsg="上报分支合并检查结果失败"
+
+    url="$BASE_URL/v1/deploy/merge"
+    for i in $(seq 1 3); do
+        res=$(curl -s -X POST "$url" \
+            --data-urlencode "taskid=$taskid" \
+            --data-urlencode "module=$module" \
+            --data-urlencode "status=$status" \
+            --data-urlencode "base=$merge_base" \
+            --data-urlencode "ahead=$merge_ahead" \
+            --data-urlencode "behind=$merge_behind" \
+            --data-urlencode "commits=$merge_commits")
+        if [ "$res" == "ok" ]; then
+            break
+        elif [ $i -ge 3 ]; then
+            echo "$errmsg: $res"
+            exit $err
+        fi
+    done
+    echo $res
+}
+
 function report_img() {
     taskid=$1
     module=$2
@@ -62,3 +89,12 @@ function report_img() {
     url="$BASE_URL/v1/deploy/image/update?taskid=$taskid&module=$module&image_url=$image_url&image_tag=$image_tag"
     request $url $errmsg
 }
+
+function report_release() {
+    taskid=$1
+    image=$2
+    errmsg="上报发布镜像信息失败"
+
+    url="$BASE_URL/v1/deploy/image/release?taskid=$taskid&image=$image"
+    request $url $errmsg
+}
@@ -6,3 +6,4 @@ CODE_PATH="/tmp/code"               # 代码打包、编译路径
 
 IMAGE_PATH="/tmp/image"             # 代码打镜像目录
 IMAGE_REGISTRY="10.12.28.4:80/code" # 代码镜像仓库
+RELEASE_REGISTRY="10.12.28.4:80/release" # single构建方式的发布镜像仓库
@@ -0,0 +1,20 @@
+-- 开发环境测试数据, 需要先执行数据库迁移: ./server migrate up
+
+start transaction;
+
+-- 插入集群
+insert into cluster(name, creator) values('hp', 'yangjinlong');
+
+-- 插入命名空间
+insert into namespace (name, cluster, creator) values('default', 'hp', 'yangjinlong');
+
+-- 插入测试服务
+insert into service(name, namespace, image_addr, quota_cpu, quota_max_cpu, quota_mem, quota_max_mem, replicas, port, container_port, rd, op) values('ivr', 'default', '10.12.28.4:80/service/ivr:1.1.1', '500m', '1000m', '512Mi', '1024Mi', 2, 5000, 5000, 'yangjinlong', 'yangjinlong');
+update service set configmap='{"LOG_PATH": "/home/tong/www/log", "LOG_FILE": "application.log"}' where id = 1;
+
+-- 插入测试代码模块
+insert into code_module(name, language, repo_name, repo_addr) values('ivr', 'python', 'GIT', 'http://127.0.0.1:4567/devops/ivr');
+insert into code_module(name, language, repo_name, repo_addr) values('ivr-ui', 'js', 'GIT', 'http://127.0.0.1:4567/devops/ivr-ui');
+insert into module_binding(service_id, code_module_id) values(1, 1), (1, 2);
+
+commit;
@@ -0,0 +1,183 @@
+#!/bin/bash
+
+# 代码仓库操作, 按仓库类型(GIT/SVN)分派到git_*、svn_*实现
+# 与pkg/util/vcs保持一致: svn采用标准布局, trunk为主干, 其他分支位于branches/下, tag位于tags/下
+
+# 输出: git|svn
+function vcs_kind() {
+    case $1 in
+        GIT|git) echo "git";;
+        SVN|svn) echo "svn";;
+        *) echo "";;
+    esac
+}
+
+# 下载代码到当前目录下的模块目录, 参数: 仓库地址 分支 目录 [提交] [本地镜像]
+function vcs_download() {
+    ${vcs}_download "$@"
+}
+
+# 切换到发布分支, 指定提交时检出该提交
+function vcs_checkout() {
+    ${vcs}_checkout "$@"
+}
+
+# 为发布分支(或指定提交)打tag并推送到仓库
+function vcs_tag() {
+    ${vcs}_tag "$@"
+}
+
+# 列出模块最新的5个tag
+function vcs_tags() {
+    ${vcs}_tags "$@"
+}
+
+# 删除仓库元数据, 避免打进release包
+function vcs_clean() {
+    ${vcs}_clean "$@"
+}
+
+# 主干分支名, 主干发布不做合并检查
+function vcs_main_branch() {
+    ${vcs}_main_branch "$@"
+}
+
+# 分支合并检查, 在模块目录下执行
+# 输出变量: merge_base 对比基准, merge_ahead 领先提交数, merge_behind 落后提交数, merge_commits 落后的提交
+function vcs_merge_check() {
+    merge_base=""
+    merge_ahead=0
+    merge_behind=0
+    merge_commits=""
+    ${vcs}_merge_check "$@"
+}
+
+# 有本地镜像时以其为参考仓库, 只从远端获取增量对象; --dissociate使检出不依赖镜像
+function git_download() {
+    addr=$1
+    branch=$2
+    dir=$3
+    mirror=$5
+    if [ -n "$mirror" ] && [ -d "$mirror" ]; then
+        git clone --recursive --reference-if-able $mirror --dissociate $addr $dir -q
+    else
+        git clone --recursive $addr $dir -q
+    fi
+}
+
+function git_checkout() {
+    branch=$1
+    commit=$2
+    git checkout $branch -q || return 1
+    if [ -n "$commit" ]; then
+        git reset --hard $commit -q
+    fi
+}
+
+# 指定提交时分支可能已前进, 只推送tag
+function git_tag() {
+    addr=$1
+    branch=$2
+    tag=$3
+    git tag $tag -am "make tag for branch: $branch" && git push origin $tag
+}
+
+function git_tags() {
+    addr=$1
+    module=$2
+    git tag | grep $module | tail -n 5
+}
+
+function git_clean() {
+    rm -rf .git .gitignore
+}
+
+function git_main_branch() {
+    echo "master"
+}
+
+# 优先对比主干, 没有主干时对比模块上次发布的tag
+function git_merge_check() {
+    addr=$1
+    branch=$2
+    module=$3
+
+    if git rev-parse --verify -q origin/master > /dev/null; then
+        merge_base="master"
+        base_ref="origin/master"
+    else
+        merge_base=$(git tag -l "released_${module}_*" | sort | tail -n 1)
+        base_ref=$merge_base
+    fi
+    if [ -z "$base_ref" ]; then
+        return 0
+    fi
+
+    head_ref=${4:-origin/$branch}
+    merge_ahead=$(git rev-list --count $base_ref..$head_ref) || return 1
+    merge_behind=$(git rev-list --count $head_ref..$base_ref) || return 1
+    merge_commits=$(git log --oneline -n 20 $head_ref..$base_ref)
+}
+
+function svn_branch_url() {
+    addr=${1%/}
+    branch=$2
+    if [ "$branch" == "trunk" ]; then
+        echo "$addr/trunk"
+    else
+        echo "$addr/branches/$branch"
+    fi
+}
+
+# 提交为r版本号
+function svn_download() {
+    addr=$1
+    branch=$2
+    dir=$3
+    commit=$4
+    svn checkout --non-interactive -q ${commit:+-r ${commit#r}} $(svn_branch_url $addr $branch) $dir
+}
+
+# svn下载时已检出发布分支
+function svn_checkout() {
+    svn info --non-interactive > /dev/null
+}
+
+function svn_tag() {
+    addr=$1
+    branch=$2
+    tag=$3
+    commit=$4
+    svn copy --non-interactive ${commit:+-r ${commit#r}} $(svn_branch_url $addr $branch) ${addr%/}/tags/$tag -m "make tag for branch: $branch"
+}
+
+function svn_tags() {
+    addr=$1
+    module=$2
+    svn ls --non-interactive ${addr%/}/tags | grep $module | tail -n 5
+}
+
+function svn_clean() {
+    find . -name .svn -type d -prune -exec rm -rf {} +
+}
+
+function svn_main_branch() {
+    echo "trunk"
+}
+
+# 以svn mergeinfo统计双方未合并的版本
+function svn_merge_check() {
+    addr=$1
+    branch=$2
+    module=$3
+
+    merge_base="trunk"
+    trunk_url=$(svn_branch_url $addr trunk)
+    branch_url=$(svn_branch_url $addr $branch)
+
+    behind=$(svn mergeinfo --non-interactive --show-revs eligible $trunk_url $branch_url) || return 1
+    ahead=$(svn mergeinfo --non-interactive --show-revs eligible $branch_url $trunk_url) || return 1
+    merge_behind=$(echo -n "$behind" | grep -c .)
+    merge_ahead=$(echo -n "$ahead" | grep -c .)
+    merge_commits=$(echo "$behind" | tail -n 20)
+}